@@ -4,64 +4,212 @@ import (
 	"context"
 	data "easyRide/db"
 	"easyRide/models"
+	"easyRide/signals"
 	"go.temporal.io/sdk/activity"
-	"log"
-	"math/rand"
+	"math"
 	"time"
 )
 
-// InTrip is the mock process of riding.
-func InTrip(ctx context.Context, passengerID int) error {
-	log.Printf("Passenger %d is on a trip to destination....", passengerID)
-	activity.RecordHeartbeat(ctx, "in-trip not response")
-	// generate random number as trip duration time
-	rand.Seed(time.Now().UnixNano())
-	randInt := rand.Int63n(60)
-	time.Sleep(time.Duration(randInt) * time.Second)
+var (
+	// TripTick is how often the trip progress is updated and heartbeated.
+	TripTick = 5 * time.Second
+	// RouteStopTimeout is how long a pooled route waits at the pickup of a rider, past it the rider's stops are
+	// taken off the route and the driver goes on with the other riders.
+	RouteStopTimeout = 10 * time.Minute
+)
+
+// TripProgress is heartbeated along the trip, a retried trip resumes from the last one.
+type TripProgress struct {
+	DriverID    int     `json:"driver_id"`
+	Position    float64 `json:"position"`
+	Destination int     `json:"destination"`
+	Elapsed     int     `json:"elapsed_seconds"`
+	// StopWait is how long a pooled route has waited at its next stop
+	StopWait int `json:"stop_wait_seconds"`
+}
+
+// InTrip moves the driver along the route towards the destination of the passenger at DriverSpeed.
+func InTrip(ctx context.Context, passengerID int, match models.MatchResult) error {
+	logger := activity.GetLogger(ctx)
+	logger.Info("Passenger is on a trip to destination.", "PassengerID", passengerID)
+	db, err := data.Initialize()
+	if err != nil {
+		return err
+	}
+	defer db.Conn.Close()
+
+	var progress TripProgress
+	if activity.HasHeartbeatDetails(ctx) && activity.GetHeartbeatDetails(ctx, &progress) == nil {
+		logger.Info("Resuming trip from the last heartbeat.", "PassengerID", passengerID, "Position", progress.Position)
+	} else {
+		progress.DriverID = match.DriverID
+		if progress.Destination, err = db.GetDestination(passengerID); err != nil {
+			return err
+		}
+		pickupLoc, err := db.GetPickupLoc(passengerID)
+		if err != nil {
+			return err
+		}
+		progress.Position = float64(pickupLoc)
+	}
+
+	ticker := time.NewTicker(TripTick)
+	defer ticker.Stop()
+	if match.Pooled {
+		return followRoute(ctx, &db, passengerID, &progress, ticker)
+	}
+	step := DriverSpeed * TripTick.Seconds()
+	for progress.Position != float64(progress.Destination) {
+		activity.RecordHeartbeat(ctx, progress)
+		select {
+		case <-ctx.Done():
+			// the driver reported the arrival, or the trip timed out
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		progress.Position = advance(progress.Position, progress.Destination, step)
+		progress.Elapsed += int(TripTick.Seconds())
+		if err := db.UpdateDriverLoc(progress.DriverID, int(math.Round(progress.Position))); err != nil {
+			return err
+		}
+	}
+	activity.RecordHeartbeat(ctx, progress)
+	logger.Info("Driver reached the destination.", "PassengerID", passengerID, "Elapsed", progress.Elapsed)
 	return nil
 }
 
+// followRoute drives a pooled route until the drop of the passenger. The rider dropped first on the route drives
+// the car, the other riders follow along. The driver waits at the pickups of the riders joining on the way.
+func followRoute(ctx context.Context, db *data.Database, passengerID int, progress *TripProgress,
+	ticker *time.Ticker) error {
+	logger := activity.GetLogger(ctx)
+	tripID := activity.GetInfo(ctx).WorkflowExecution.ID
+	step := DriverSpeed * TripTick.Seconds()
+	for {
+		activity.RecordHeartbeat(ctx, *progress)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		progress.Elapsed += int(TripTick.Seconds())
+		stops, err := db.GetRoute(progress.DriverID)
+		if err != nil {
+			return err
+		}
+		left := remainingStops(stops)
+		leading := false
+		for _, s := range left {
+			if s.Kind == models.StopDrop {
+				leading = s.TripID == tripID
+				break
+			}
+		}
+		if !leading {
+			continue
+		}
+		loc, err := db.GetDriverLoc(progress.DriverID)
+		if err != nil {
+			return err
+		}
+		// the position kept between the ticks is finer than the location stored
+		if int(math.Round(progress.Position)) != loc {
+			progress.Position = float64(loc)
+		}
+		next := left[0]
+		if progress.Position == float64(next.Loc) {
+			if next.Kind == models.StopDrop {
+				logger.Info("Driver reached the destination.", "PassengerID", passengerID, "Elapsed", progress.Elapsed)
+				// the next rider drives on
+				_, err := db.CompleteStop(tripID, models.StopDrop)
+				return err
+			}
+			// waiting for the rider to get in
+			progress.StopWait += int(TripTick.Seconds())
+			if progress.StopWait < int(RouteStopTimeout.Seconds()) {
+				continue
+			}
+			logger.Warn("Rider did not get in, leaving the pickup.", "PassengerID", next.PassengerID,
+				"TripID", next.TripID)
+			if _, err := completeStops(db, next.TripID); err != nil {
+				return err
+			}
+			progress.StopWait = 0
+			continue
+		}
+		progress.StopWait = 0
+		progress.Position = advance(progress.Position, next.Loc, step)
+		if err := db.UpdateDriverLoc(progress.DriverID, int(math.Round(progress.Position))); err != nil {
+			return err
+		}
+	}
+}
+
+// advance moves a position a step towards the target, without passing it.
+func advance(position float64, target int, step float64) float64 {
+	remaining := float64(target) - position
+	if math.Abs(remaining) <= step {
+		return float64(target)
+	}
+	return position + math.Copysign(step, remaining)
+}
+
 // Arrive marks the passenger has arrived at the destination, update the driver status.
-func Arrive(ctx context.Context, passengerID int) error {
-	log.Printf("Passenger %d arrive the destination...", passengerID)
-	// update the driver status
+// Each update can be done again, a retry after a failure halfway ends in the same state.
+func Arrive(ctx context.Context, passengerID int, match models.MatchResult) error {
+	activity.GetLogger(ctx).Info("Passenger arrived at the destination.", "PassengerID", passengerID)
 	db, err := data.Initialize()
 	if err != nil {
-		log.Fatal("Cannot connect to database.")
+		return err
 	}
-	driverID, err := db.GetMatchedDriver(passengerID)
+	defer db.Conn.Close()
+	driverID := match.DriverID
 	destination, err := db.GetDestination(passengerID)
 	if err != nil {
 		return err
 	}
-	// change the drive availability to true
-	if err := db.UpdateDriverStatus(driverID, &models.Passenger{}, true); err != nil {
+	if match.Pooled {
+		remaining, err := db.CompleteStop(activity.GetInfo(ctx).WorkflowExecution.ID, models.StopDrop)
+		if err != nil && err != data.ErrNoMatch {
+			return err
+		}
+		if remaining > 0 {
+			// other riders are still on the route
+			return db.UpdateDriverLoc(driverID, destination)
+		}
+	}
+	// the driver is matched again once available, so the location and the last trip time go first
+	if err := db.UpdateDriverLoc(driverID, destination); err != nil {
 		return err
 	}
-	// change the last trip time of driver
 	if err := db.UpdateLastTripEndTime(driverID); err != nil {
-		return nil
+		return err
 	}
-	// change the driver loc
-	if err := db.UpdateDriverLoc(driverID, destination); err != nil {
-		return nil
+	// change the drive availability to true
+	if err := db.UpdateDriverStatus(driverID, &models.Passenger{}, true); err != nil {
+		return err
+	}
+	change := models.DriverStateChange{State: models.DriverAvailable, Loc: destination}
+	if err := signals.SendDriverSignal(driverID, signals.SIGNAL_DRIVER_STATE, change); err != nil {
+		activity.GetLogger(ctx).Warn("Driver has no shift running", "DriverID", driverID, "Error", err)
 	}
 	return nil
 }
 
+// notifyDriver moves the shift of the passenger's driver to the given state.
+func notifyDriver(ctx context.Context, driverID int, passengerID int, state models.DriverState) {
+	change := models.DriverStateChange{State: state, PassengerID: passengerID}
+	if err := signals.SendDriverSignal(driverID, signals.SIGNAL_DRIVER_STATE, change); err != nil {
+		activity.GetLogger(ctx).Warn("Driver has no shift running", "DriverID", driverID, "Error", err)
+	}
+}
+
+// PassengerEndTrip ends the trip of the passenger once paid and rated.
 func PassengerEndTrip(ctx context.Context, passengerID int) error {
 	db, err := data.Initialize()
-	if err != nil {
-		log.Fatal("Cannot connect to database.")
-	}
-	err = db.SetPassengerTripEnd(passengerID)
 	if err != nil {
 		return err
 	}
-	return nil
-}
-
-func Rate(ctx context.Context) error {
-	time.Sleep(15 * time.Second)
-	return nil
+	defer db.Conn.Close()
+	return db.SetPassengerTripEnd(passengerID)
 }
@@ -0,0 +1,120 @@
+// Package auction solves the assignment problem with Bertsekas' auction algorithm: the rows bid for the columns
+// they are cheapest with, and the prices of the columns rise until every row holds one. The prices reached are
+// kept so that the next solve of a similar matrix can start from them instead of from zero.
+package auction
+
+import (
+	"easyRide/activities/hungarian"
+)
+
+// ScaleFactor is how much the bid increment shrinks between the phases of epsilon scaling.
+var ScaleFactor = 5.0
+
+// WarmEpsilon is the first bid increment of a warm started auction, relative to the largest cost. Warm prices are
+// close to the final ones already, the coarse phases would only undo them, while too fine a start turns the prices
+// of a changed matrix, and the identical rows padding a wide one, into long bidding wars.
+var WarmEpsilon = 1e-2
+
+// relative precision of the last phase, the assignment found is optimal up to n times the last increment
+const relativeEpsilon = 1e-9
+
+// Solve returns the assignment of the rows, with the same contract as hungarian.Solve.
+func Solve(costs [][]float64) ([]int, error) {
+	res, _, err := SolveWarm(costs, nil)
+	return res, err
+}
+
+// SolveWarm solves the assignment starting from the given prices of the columns, the missing prices start at 0.
+// It returns the assignment and the prices it ended at, one per column of the matrix padded to a square.
+func SolveWarm(costs [][]float64, prices []float64) ([]int, []float64, error) {
+	if err := hungarian.Validate(costs); err != nil {
+		return []int{}, nil, err
+	}
+	square := hungarian.Square(costs)
+	n := len(square)
+
+	max := 0.0
+	for _, row := range square {
+		for _, c := range row {
+			if c > max {
+				max = c
+			}
+		}
+	}
+	final := relativeEpsilon * (max + 1) / float64(n)
+
+	a := makeAuction(square)
+	copy(a.price, prices)
+	eps := (max + 1) / ScaleFactor
+	if len(prices) > 0 {
+		eps = WarmEpsilon * (max + 1)
+	}
+	for ; eps > final; eps /= ScaleFactor {
+		a.run(eps)
+	}
+	a.run(final)
+
+	res := make([]int, len(costs))
+	for i := range res {
+		j := a.owned[i]
+		if j >= len(costs[i]) || costs[i][j] == hungarian.Infeasible {
+			j = -1
+		}
+		res[i] = j
+	}
+	return res, a.price, nil
+}
+
+type auction struct {
+	n     int
+	costs [][]float64
+	price []float64
+	owned []int // column held by each row
+	owner []int // row holding each column
+}
+
+func makeAuction(costs [][]float64) auction {
+	n := len(costs)
+	return auction{n, costs, make([]float64, n), make([]int, n), make([]int, n)}
+}
+
+// run is a phase of the auction: every row bids until they all hold a column, the bids rising by at least eps.
+func (a *auction) run(eps float64) {
+	for i := 0; i < a.n; i++ {
+		a.owned[i] = -1
+		a.owner[i] = -1
+	}
+	free := make([]int, a.n)
+	for i := range free {
+		free[i] = i
+	}
+	for len(free) > 0 {
+		i := free[len(free)-1]
+		free = free[:len(free)-1]
+
+		// the best and second best values of the columns to the row, a value being minus cost and price
+		best, second := -1, -1
+		bestValue, secondValue := 0.0, 0.0
+		for j := 0; j < a.n; j++ {
+			value := -a.costs[i][j] - a.price[j]
+			if best == -1 || value > bestValue {
+				second, secondValue = best, bestValue
+				best, bestValue = j, value
+			} else if second == -1 || value > secondValue {
+				second, secondValue = j, value
+			}
+		}
+		bid := eps
+		if second != -1 {
+			bid += bestValue - secondValue
+		}
+		a.price[best] += bid
+
+		if prev := a.owner[best]; prev != -1 {
+			a.owned[prev] = -1
+			free = append(free, prev)
+		}
+		a.owner[best] = i
+		a.owned[i] = best
+	}
+}
@@ -0,0 +1,45 @@
+package auction
+
+import (
+	"easyRide/activities/hungarian"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSolve(t *testing.T) {
+	res, err := Solve([][]float64{
+		{0.5, 1.2, 0.3},
+		{0.1, 0.6, 0.4},
+		{0.2, 1.4, 0.5},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []int{2, 1, 0}, res)
+}
+
+func TestSolveWarm(t *testing.T) {
+	inf := hungarian.Infeasible
+	costs := [][]float64{
+		{0.5, 1.2, inf},
+		{0.1, 0.6, 0.4},
+		{0.2, 1.4, 0.5},
+	}
+	res, prices, err := SolveWarm(costs, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{0, 1, 2}, res)
+	assert.Len(t, prices, 3)
+
+	// a row changed, the previous prices still lead to the optimum
+	costs[1] = []float64{0.1, 2.0, 0.4}
+	warm, _, err := SolveWarm(costs, prices)
+	assert.NoError(t, err)
+	cold, _, err := SolveWarm(costs, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, cold, warm)
+	assert.Equal(t, []int{1, 2, 0}, warm)
+
+	// prices of another shape are only a starting point
+	res, prices, err = SolveWarm([][]float64{{0.3, 0.1}}, []float64{7, 0, 1, 2})
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1}, res)
+	assert.Len(t, prices, 2)
+}
@@ -0,0 +1,89 @@
+package activities
+
+import (
+	"context"
+	data "easyRide/db"
+	"easyRide/models"
+	"easyRide/signals"
+	"fmt"
+	"go.temporal.io/sdk/activity"
+)
+
+// The trip undoes its steps with the activities below when it fails halfway. They may run more than once and
+// after a part of the trip was already undone, so each of them leaves alone what is already undone.
+
+// RecordPayment records the payment of the trip, which VoidPayment undoes.
+func RecordPayment(ctx context.Context, tripID string, payment models.PaymentResult) error {
+	db, err := data.Initialize()
+	if err != nil {
+		return err
+	}
+	defer db.Conn.Close()
+	return db.SetTripPaid(tripID, payment.Amount)
+}
+
+// VoidPayment voids the payment of the trip and tells the passenger.
+func VoidPayment(ctx context.Context, tripID string, passengerID int) error {
+	db, err := data.Initialize()
+	if err != nil {
+		return err
+	}
+	defer db.Conn.Close()
+	amount, voided, err := db.VoidTripPayment(tripID)
+	if err != nil || !voided {
+		return err
+	}
+	activity.GetLogger(ctx).Info("Payment voided.", "PassengerID", passengerID, "TripID", tripID, "Amount", amount)
+	return db.AddNotification(passengerID, fmt.Sprintf("Your payment of %.2f was voided.", amount))
+}
+
+// ReleaseDriver frees the driver matched with the passenger. The driver of a pooled route drives on while other
+// riders are on it.
+func ReleaseDriver(ctx context.Context, tripID string, passengerID int, match models.MatchResult) error {
+	db, err := data.Initialize()
+	if err != nil {
+		return err
+	}
+	defer db.Conn.Close()
+	driverID := match.DriverID
+	if match.Pooled {
+		remaining, err := completeStops(&db, tripID)
+		if err != nil {
+			return err
+		}
+		if remaining > 0 {
+			return nil
+		}
+	}
+	released, err := db.ReleaseDriver(driverID, passengerID)
+	if err != nil || !released {
+		return err
+	}
+	loc, err := db.GetDriverLoc(driverID)
+	if err != nil {
+		return err
+	}
+	activity.GetLogger(ctx).Info("Driver released.", "DriverID", driverID, "TripID", tripID)
+	change := models.DriverStateChange{State: models.DriverAvailable, Loc: loc}
+	if err := signals.SendDriverSignal(driverID, signals.SIGNAL_DRIVER_STATE, change); err != nil {
+		activity.GetLogger(ctx).Warn("Driver has no shift running", "DriverID", driverID, "Error", err)
+	}
+	return nil
+}
+
+// RestorePassenger takes the passenger out of the failed trip, marks the trip aborted and tells the passenger.
+func RestorePassenger(ctx context.Context, tripID string, passengerID int) error {
+	db, err := data.Initialize()
+	if err != nil {
+		return err
+	}
+	defer db.Conn.Close()
+	if err := db.RestorePassenger(passengerID, tripID); err != nil {
+		return err
+	}
+	if err := db.AbortTrip(tripID); err != nil {
+		return err
+	}
+	activity.GetLogger(ctx).Info("Passenger restored.", "PassengerID", passengerID, "TripID", tripID)
+	return db.AddNotification(passengerID, "Your trip could not be completed, you can request another one.")
+}
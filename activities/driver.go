@@ -0,0 +1,52 @@
+package activities
+
+import (
+	"context"
+	data "easyRide/db"
+	"easyRide/models"
+	"easyRide/signals"
+	"go.temporal.io/sdk/activity"
+)
+
+// SyncDriverState writes the driver's shift state to the database so that matching only sees available drivers.
+// Offered and trip states are written by the matching and the trip itself.
+func SyncDriverState(ctx context.Context, driverID int, state models.DriverState, loc int) error {
+	activity.GetLogger(ctx).Info("Driver state changed.", "DriverID", driverID, "State", state)
+	db, err := data.Initialize()
+	if err != nil {
+		return err
+	}
+	defer db.Conn.Close()
+
+	switch state {
+	case models.DriverAvailable:
+		if loc >= 0 {
+			if err := db.UpdateDriverLoc(driverID, loc); err != nil {
+				return err
+			}
+		}
+		if err := db.UpdateDriverStatus(driverID, &models.Passenger{}, true); err != nil {
+			return err
+		}
+		// let the matcher know right away instead of waiting for the next sweep
+		if err := signals.SendDispatchSignal(signals.SIGNAL_DRIVER_AVAILABLE, driverID); err != nil {
+			activity.GetLogger(ctx).Warn("Matching dispatcher is not running", "Error", err)
+		}
+		return nil
+	case models.DriverOnBreak:
+		return db.SetDriverUnavailable(driverID)
+	case models.DriverOffline:
+		return db.SetDriverOffline(driverID)
+	}
+	return nil
+}
+
+// UpdateDriverLocation records the latest location reported by the driver.
+func UpdateDriverLocation(ctx context.Context, driverID int, loc int) error {
+	db, err := data.Initialize()
+	if err != nil {
+		return err
+	}
+	defer db.Conn.Close()
+	return db.UpdateDriverLoc(driverID, loc)
+}
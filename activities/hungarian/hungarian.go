@@ -2,18 +2,31 @@ package hungarian
 
 // Adapted from https://github.com/oddg/hungarian-algorithm
 
-// Solve return array of integer, where item `i` matches with `arr[i]`
+// Solve return array of integer, where item `i` matches with `arr[i]`.
+// The costs matrix can be rectangular. Pairs costing Infeasible are never returned,
+// the rows left without a column or without a feasible pair are -1.
 func Solve(costs [][]float64) ([]int, error) {
+	res, _, err := SolveWarm(costs, nil, nil)
+	return res, err
+}
+
+// SolveWarm solves the assignment starting from the prices of the columns and the assignment of a previous solve,
+// the missing prices start at 0 and the pairs of the seed no longer tight are dropped.
+// It returns the assignment and the prices it ended at, one per column of the matrix padded to a square.
+func SolveWarm(costs [][]float64, prices []float64, seed []int) ([]int, []float64, error) {
 	// Validate the input
-	if err := validate(costs); err != nil {
-		return []int{}, err
+	if err := Validate(costs); err != nil {
+		return []int{}, nil, err
 	}
+	original := costs
+	costs = Square(costs)
 
 	n := len(costs)
-	label := makeLabel(n, costs) // labels on the row and columns
-	match := makeMatching(n)     // matching using tight edges
+	label := makeLabel(n, costs, epsilon(original)) // labels on the row and columns
+	match := makeMatching(n)                        // matching using tight edges
 
-	label.initialize()
+	label.initializePrices(prices)
+	match.seed(seed, label.isTight)
 	match.initialize(label.isTight)
 
 	// loop until the matching is perfect
@@ -49,5 +62,11 @@ func Solve(costs [][]float64) ([]int, error) {
 		}
 	}
 
-	return match.format(), nil
+	res := match.format()[:len(original)]
+	for i, j := range res {
+		if j >= len(original[i]) || original[i][j] == Infeasible {
+			res[i] = -1
+		}
+	}
+	return res, label.prices(), nil
 }
@@ -0,0 +1,59 @@
+package hungarian
+
+import "math"
+
+// Infeasible is the cost of an assignment that must not be made.
+//
+// Solve replaces it with a cost larger than any assignment made of feasible pairs only, so that
+// the most rows get a feasible pair, and among those assignments the cheapest is picked.
+// A row left without a feasible pair is reported unassigned, as -1.
+const Infeasible = math.MaxFloat64
+
+// Square copies the costs into a square matrix, the infeasible pairs replaced by a cost above the sum of all the
+// feasible ones, and the missing rows or columns padded with free dummy pairs.
+func Square(costs [][]float64) [][]float64 {
+	rows, cols := len(costs), len(costs[0])
+	n := rows
+	if cols > n {
+		n = cols
+	}
+	bigM := 1.0
+	for _, row := range costs {
+		for _, c := range row {
+			if c != Infeasible {
+				bigM += c
+			}
+		}
+	}
+	res := make([][]float64, n)
+	for i := range res {
+		res[i] = make([]float64, n)
+		if i >= rows {
+			continue
+		}
+		for j, c := range costs[i] {
+			if c == Infeasible {
+				c = bigM
+			}
+			res[i][j] = c
+		}
+	}
+	return res
+}
+
+// tolerance of the tight edges against float drift, relative to the largest feasible cost
+const relativeEpsilon = 1e-9
+
+// epsilon takes the costs before Square, the bigM of the infeasible pairs would scale
+// the tolerance past the gaps between the feasible costs.
+func epsilon(costs [][]float64) float64 {
+	max := 1.0
+	for _, row := range costs {
+		for _, c := range row {
+			if c != Infeasible && c > max {
+				max = c
+			}
+		}
+	}
+	return relativeEpsilon * max
+}
@@ -2,6 +2,8 @@ package hungarian
 
 // Adapted from https://github.com/oddg/hungarian-algorithm
 
+import "math"
+
 type label struct {
 	n      int
 	costs  [][]float64 //costs
@@ -9,31 +11,49 @@ type label struct {
 	right  []float64   // labels on the columns
 	slack  []float64   // min slack
 	slackI []int       // min slack index
+	eps    float64     // tolerance of the tight edges
 }
 
-func makeLabel(n int, costs [][]float64) label {
+func makeLabel(n int, costs [][]float64, eps float64) label {
 	left := make([]float64, n)
 	right := make([]float64, n)
 	slack := make([]float64, n)
 	slackI := make([]int, n)
-	return label{n, costs, left, right, slack, slackI}
+	return label{n, costs, left, right, slack, slackI, eps}
 }
 
-// initialize left = min_j cost[i][j] for each row i
-func (l *label) initialize() {
+// initializePrices sets the labels of the columns to minus their prices, and left = min_j cost[i][j]-right[j]
+// for each row i, the labels are then feasible whatever the prices.
+func (l *label) initializePrices(prices []float64) {
+	for j := 0; j < l.n && j < len(prices); j++ {
+		l.right[j] = -prices[j]
+	}
 	for i := 0; i < l.n; i++ {
-		l.left[i] = l.costs[i][0]
+		l.left[i] = l.costs[i][0] - l.right[0]
 		for j := 1; j < l.n; j++ {
-			if l.costs[i][j] < l.left[i] {
-				l.left[i] = l.costs[i][j]
+			if l.costs[i][j]-l.right[j] < l.left[i] {
+				l.left[i] = l.costs[i][j] - l.right[j]
 			}
 		}
 	}
 }
 
-// Returns whether a given edge is tight
+// prices returns the prices of the columns, minus their labels
+func (l *label) prices() []float64 {
+	prices := make([]float64, l.n)
+	for j, r := range l.right {
+		prices[j] = -r
+	}
+	return prices
+}
+
+// Returns whether a given edge is tight, up to the float drift of the labels
 func (l *label) isTight(i int, j int) bool {
-	return l.costs[i][j]-l.left[i]-l.right[j] == 0
+	return l.tight(l.costs[i][j] - l.left[i] - l.right[j])
+}
+
+func (l *label) tight(slack float64) bool {
+	return math.Abs(slack) <= l.eps
 }
 
 // Given a set s of row indices and a set of column indices update the labels.
@@ -71,7 +91,7 @@ func (l *label) update(s []int, t []int) []edge {
 			continue
 		}
 		l.slack[j] -= min
-		if l.slack[j] == 0 {
+		if l.tight(l.slack[j]) {
 			edges = append(edges, edge{l.slackI[j], j})
 		}
 	}
@@ -84,7 +104,7 @@ func (l *label) initializeSlacks(i int) []edge {
 	for j := 0; j < l.n; j++ {
 		l.slack[j] = l.costs[i][j] - l.left[i] - l.right[j]
 		l.slackI[j] = i
-		if l.slack[j] == 0 {
+		if l.tight(l.slack[j]) {
 			edges = append(edges, edge{i, j})
 		}
 	}
@@ -98,7 +118,7 @@ func (l *label) updateSlacks(i int) []edge {
 		if s < l.slack[j] {
 			l.slack[j] = s
 			l.slackI[j] = i
-			if l.slack[j] == 0 {
+			if l.tight(l.slack[j]) {
 				edges = append(edges, edge{i, j})
 			}
 		}
@@ -19,9 +19,22 @@ func makeMatching(n int) matching {
 	return matching{n, ij, ji}
 }
 
-// Greedily build a matching
+// Starts the matching from the tight pairs of a previous assignment
+func (m *matching) seed(seed []int, isTight func(int, int) bool) {
+	for i, j := range seed {
+		if i < m.n && j >= 0 && j < m.n && m.ji[j] == -1 && isTight(i, j) {
+			m.ij[i] = j
+			m.ji[j] = i
+		}
+	}
+}
+
+// Greedily build a matching of the rows left unmatched
 func (m *matching) initialize(isTight func(int, int) bool) {
 	for i := 0; i < m.n; i++ {
+		if m.ij[i] != -1 {
+			continue
+		}
 		for j := 0; j < m.n; j++ {
 			if isTight(i, j) && (m.ji[j] == -1) {
 				m.ij[i] = j
@@ -46,9 +46,12 @@ func makeTree(n int, r int, e []edge) tree {
 // Returns a couple of values:
 // - a boolean: whether the extension has been successful
 // - the index of the new element in the tree (when successful)
+// The edges to a column already in the tree are skipped, they would rewire the tree into a cycle.
 func (t *tree) extend() (bool, int) {
-	b, e := t.edges.pop()
-	if b {
+	for b, e := t.edges.pop(); b; b, e = t.edges.pop() {
+		if t.rightPrec[e.j] != -1 {
+			continue
+		}
 		t.rightPrec[e.j] = e.i
 		return true, e.j
 	}
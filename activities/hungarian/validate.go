@@ -5,22 +5,28 @@ package hungarian
 import (
 	"errors"
 	"fmt"
+	"math"
 )
 
-func validate(costs [][]float64) error {
+// Validate checks that the costs matrix is a non empty rectangle of non negative numbers, Infeasible included.
+func Validate(costs [][]float64) error {
 	n := len(costs)
 
-	if n == 0 {
+	if n == 0 || len(costs[0]) == 0 {
 		return errors.New("The costs matrix is empty.")
 	}
 
-	if m := len(costs[0]); m != n {
-		return errors.New("The costs matrix is not square.")
-	}
-
+	m := len(costs[0])
 	for i := 0; i < n; i++ {
-		for j := 0; j < n; j++ {
-			if costs[i][j] < 0 {
+		if len(costs[i]) != m {
+			return fmt.Errorf("The row %d of the costs matrix has %d columns, expected %d.", i, len(costs[i]), m)
+		}
+		for j := 0; j < m; j++ {
+			c := costs[i][j]
+			if math.IsNaN(c) || math.IsInf(c, 0) {
+				return fmt.Errorf("The coefficient (%d,%d) is not a number.", i, j)
+			}
+			if c < 0 {
 				return fmt.Errorf("The coefficient (%d,%d) is negative.", i, j)
 			}
 		}
@@ -11,12 +11,31 @@ import (
 	"time"
 )
 
-func Match(ctx context.Context, lastRunTime, thisRunTime time.Time) error {
+// Match runs a match round over the waiting passengers and the available drivers, warm started from the state the
+// previous round left. It returns the state left to the next round.
+func Match(ctx context.Context, lastRunTime, thisRunTime time.Time, prev RoundState) (RoundState, error) {
 	activity.GetLogger(ctx).Info("Match job running.", "lastRunTime_exclude", lastRunTime, "thisRunTime_include", thisRunTime)
 	db, err := postgres.Initialize()
 	if err != nil {
 		activity.GetLogger(ctx).Error("Database connection failed", "Error", err)
+		return prev, err
 	}
+	defer db.Conn.Close()
+
+	// the cron and the rounds run on demand must not match the same passengers and drivers
+	release, locked, err := db.LockMatching(ctx)
+	if err != nil {
+		return prev, err
+	}
+	if !locked {
+		activity.GetLogger(ctx).Info("Another match round is running, skip this one.")
+		skipped := prev.idle()
+		skipped.Skipped = true
+		return skipped, nil
+	}
+	defer release()
+	roundID := roundIDOf(activity.GetInfo(ctx))
+	startedAt := time.Now()
 
 	// Fetch unmatched passengers and driver
 	p, errP := db.GetWaitingPassengers()
@@ -24,61 +43,154 @@ func Match(ctx context.Context, lastRunTime, thisRunTime time.Time) error {
 		activity.GetLogger(ctx).Error("Cannot fetch waiting passengers", "Error", errP)
 	}
 	d, errD := db.GetAvailableDrivers()
-	if errP != nil {
+	if errD != nil {
 		activity.GetLogger(ctx).Error("Cannot fetch available driver", "Error", errD)
 	}
 	if len(p.Passengers) == 0 || len(d.Drivers) == 0 {
+		// pooled passengers can still join the drivers on a pooled ride
 		activity.GetLogger(ctx).Info("No drivers/passengers online.")
-		return nil
+		matched := make(map[int]bool)
+		if err := joinPoolRoutes(ctx, &db, roundID, p, matched); err != nil {
+			return prev, err
+		}
+		notifyUnmatched(ctx, roundID, p, matched)
+		return prev.idle(), db.AddMatchRound(roundID, startedAt, len(matched))
 	}
-	graph := constructGraph(p, d)
-
-	// apply hungarian algo
-	res, errG := hungarian.Solve(graph)
+	plan, errG := PlanRound(MatchSolver, p, d, prev)
 	if errG != nil {
-		return errG
+		return prev, errG
+	}
+	state := plan.State
+	activity.GetLogger(ctx).Info("Match round solved.", "Solver", state.Solver, "WarmStarted", state.WarmStarted,
+		"SolveTime", state.SolveTime, "LatencySaved", state.LatencySaved())
+	// keep what the round saw and decided, to explain and replay it
+	if err := db.AddRoundAudit(plan.Audit(roundID)); err != nil {
+		activity.GetLogger(ctx).Warn("Cannot record the match round", "RoundID", roundID, "Error", err)
 	}
 	// update passenger and driver status in the database
 	// notify corresponding workflow the matching result
-	for p_idx, d_idx := range res {
-		passenger := p.Passengers[p_idx]
-		driver := d.Drivers[d_idx]
-		if err := db.UpdatePassengerStatus(passenger.ID, &driver, true); err != nil {
-			return nil
+	matched := make(map[int]bool)
+	for _, pair := range plan.Pairs {
+		passenger, driver := pair.Passenger, pair.Driver
+		workflowID := passenger.WorkflowID
+		eta := pickupETA(&passenger, &driver)
+		// each pair is matched as a whole, a round failing halfway leaves the pairs it did not get to waiting
+		paired, err := db.PairPassenger(workflowID, &passenger, &driver, eta)
+		if err != nil {
+			return state, err
+		}
+		if !paired {
+			activity.GetLogger(ctx).Info("Passenger or driver taken since the round started.",
+				"PassengerID", passenger.ID, "DriverID", driver.ID)
+			continue
+		}
+		result := models.MatchResult{
+			Matched:   true,
+			DriverID:  driver.ID,
+			DriverLoc: driver.Loc,
+			PickupETA: eta,
+			Cost:      pair.Cost,
+			RoundID:   roundID,
+			Pooled:    passenger.Pooled,
+		}
+		if passenger.Pooled {
+			err = startPoolRoute(&db, &passenger, &driver)
 		}
-		if err := db.UpdateDriverStatus(driver.ID, &passenger, false); err != nil {
-			return err
+		if err == nil {
+			err = signals.SendMatchSignal(workflowID, result)
 		}
-		workflowID, err := db.GetWorkFlowID(passenger.ID)
 		if err != nil {
-			return err
+			// the trip never started, the passenger and the driver are left to the next round
+			activity.GetLogger(ctx).Warn("Cannot start the trip, pair undone.", "PassengerID", passenger.ID,
+				"DriverID", driver.ID, "Error", err)
+			if err := db.UnpairPassenger(workflowID, passenger.ID, driver.ID); err != nil {
+				return state, err
+			}
+			continue
+		}
+		if requestedAt, err := time.Parse(time.RFC3339Nano, passenger.RequestedAt); err == nil {
+			activity.GetLogger(ctx).Info("Passenger matched.", "PassengerID", passenger.ID, "DriverID", driver.ID,
+				"TimeToMatch", time.Since(requestedAt))
+		}
+		offer := models.DriverStateChange{State: models.DriverOffered, PassengerID: passenger.ID}
+		if err := signals.SendDriverSignal(driver.ID, signals.SIGNAL_DRIVER_STATE, offer); err != nil {
+			activity.GetLogger(ctx).Warn("Driver has no shift running", "DriverID", driver.ID, "Error", err)
+		}
+		matched[passenger.ID] = true
+	}
+	if err := joinPoolRoutes(ctx, &db, roundID, p, matched); err != nil {
+		return state, err
+	}
+	notifyUnmatched(ctx, roundID, p, matched)
+	return state, db.AddMatchRound(roundID, startedAt, len(matched))
+}
+
+// roundIDOf identifies the round run by the activity. A dispatcher runs many rounds in one workflow run, each as an
+// activity of its own, the retries of a round keep its ID.
+func roundIDOf(info activity.Info) string {
+	return info.WorkflowExecution.RunID + "/" + info.ActivityID
+}
+
+// notifyUnmatched tells the passengers left out of the round, so that they can widen their search.
+func notifyUnmatched(ctx context.Context, roundID string, p models.PassengerList, matched map[int]bool) {
+	for _, passenger := range p.Passengers {
+		if matched[passenger.ID] {
+			continue
 		}
-		if err := signals.SendMatchSignal(workflowID, true); err != nil {
-			return err
+		if err := signals.SendMatchSignal(passenger.WorkflowID, models.MatchResult{RoundID: roundID}); err != nil {
+			activity.GetLogger(ctx).Warn("Cannot notify unmatched passenger", "PassengerID", passenger.ID, "Error", err)
 		}
 	}
-	return nil
 }
 
+// MaxRoundSize is the most passengers, and the most drivers, weighed against each other in a round.
+var MaxRoundSize = 10
+
 func constructGraph(p models.PassengerList, d models.DriverList) [][]float64 {
-	nodeNum := min(10, min(len(p.Passengers), len(d.Drivers)))
-	passenger := p.Passengers[:nodeNum]
-	driver := d.Drivers[:nodeNum]
+	passenger := p.Passengers[:min(MaxRoundSize, len(p.Passengers))]
+	driver := d.Drivers[:min(MaxRoundSize, len(d.Drivers))]
 
-	// calculate the graph weight
-	graph := make([][]float64, nodeNum)
+	// calculate the graph weight, a row per passenger and a column per driver
+	graph := make([][]float64, len(passenger))
 	for row := range graph {
-		graph[row] = make([]float64, nodeNum)
+		graph[row] = make([]float64, len(driver))
 	}
 	for i, ps := range passenger {
 		for j, dr := range driver {
+			if !feasible(&ps, &dr) {
+				graph[i][j] = hungarian.Infeasible
+				continue
+			}
 			// metric: distance/rating sum
-			graph[i][j] = math.Abs(float64(ps.PickupLoc-dr.Loc)) / (ps.Rating + dr.Rating)
+			graph[i][j] = math.Abs(float64(ps.PickupLoc-dr.Loc)) / (ratingWeight(ps.Rating) + ratingWeight(dr.Rating))
 		}
 	}
 	return graph
 }
 
+// ratingWeight counts a missing or out of range rating as the lowest one, so that the rating sum is never 0.
+func ratingWeight(rating float64) float64 {
+	if math.IsNaN(rating) || rating < models.MinRating {
+		return models.MinRating
+	}
+	return rating
+}
+
+// feasible tells whether the driver can take the passenger at all: the driver must be within the passenger's
+// match radius, drive a vehicle of the class asked for, not be blocked by the passenger, and accept the trip.
+func feasible(p *models.Passenger, d *models.Driver) bool {
+	if p.MatchRadius > 0 && math.Abs(float64(p.PickupLoc-d.Loc)) > float64(p.MatchRadius) {
+		return false
+	}
+	return d.Vehicle.Serves(p.RideClass, p.NeedsAccessible) && !p.Blocks(d.ID) && d.Preferences.Allows(p, d.Loc)
+}
+
+// pickupETA estimates when the driver reaches the passenger.
+func pickupETA(p *models.Passenger, d *models.Driver) time.Time {
+	distance := math.Abs(float64(p.PickupLoc - d.Loc))
+	return time.Now().Add(time.Duration(distance / DriverSpeed * float64(time.Second)))
+}
+
 func min(a, b int) int {
 	if a < b {
 		return a
@@ -4,6 +4,7 @@ import (
 	"easyRide/activities/hungarian"
 	"easyRide/models"
 	"github.com/stretchr/testify/assert"
+	"math"
 	"testing"
 	"time"
 )
@@ -46,3 +47,229 @@ func TestHungarianAlgo(t *testing.T) {
 	expected := []int{2, 1, 0}
 	assert.Equal(t, expected, res)
 }
+
+func TestConstructGraphMatchRadius(t *testing.T) {
+	pl, dl := setUp()
+	pl.Passengers[0].MatchRadius = 5
+	pl.Passengers[1].MatchRadius = 5
+	res := constructGraph(pl, dl)
+	expected := [][]float64{
+		{0.5, hungarian.Infeasible},
+		{0.1, hungarian.Infeasible},
+	}
+	assert.Equal(t, expected, res)
+}
+
+func TestConstructGraphRideClass(t *testing.T) {
+	pl, dl := setUp()
+	pl.Passengers[0].RideClass = models.ClassPremium
+	pl.Passengers[1].NeedsAccessible = true
+	dl.Drivers[1].Vehicle = models.Vehicle{Seats: 4, Class: models.ClassPremium, WheelchairAccessible: true}
+	res := constructGraph(pl, dl)
+	expected := [][]float64{
+		{hungarian.Infeasible, 1.2},
+		{hungarian.Infeasible, hungarian.Infeasible},
+	}
+	assert.Equal(t, expected, res)
+}
+
+func TestConstructGraphPreferences(t *testing.T) {
+	pl, dl := setUp()
+	home := 0
+	pl.Passengers[0].BlockedDrivers = []int64{2}
+	pl.Passengers[1].Rating = 3.0
+	dl.Drivers[0].ID = 1
+	dl.Drivers[0].Preferences = models.DriverPreferences{MinPassengerRating: 4.0}
+	dl.Drivers[1].ID = 2
+	dl.Drivers[1].Preferences = models.DriverPreferences{HomeLoc: &home}
+	res := constructGraph(pl, dl)
+	expected := [][]float64{
+		{0.5, hungarian.Infeasible},
+		{hungarian.Infeasible, 6.0 / 8.0},
+	}
+	assert.Equal(t, expected, res)
+}
+
+func TestHungarianInfeasible(t *testing.T) {
+	inf := hungarian.Infeasible
+	graph := [][]float64{
+		{0.5, inf, inf},
+		{0.1, inf, inf},
+		{0.2, 1.4, 0.5},
+	}
+	// only one of the first two rows can be matched, the cheaper one
+	res, err := hungarian.Solve(graph)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{-1, 0, 2}, res)
+}
+
+func TestConstructGraphUnevenRound(t *testing.T) {
+	pl, dl := setUp()
+	dl.Drivers = dl.Drivers[:1]
+	pl.Passengers[1].Rating = 0
+	dl.Drivers[0].Rating = 0
+	res := constructGraph(pl, dl)
+	// a missing rating counts as the lowest one instead of dividing by 0
+	expected := [][]float64{
+		{5.0 / 6.0},
+		{0.5},
+	}
+	assert.Equal(t, expected, res)
+
+	match, err := hungarian.Solve(res)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{-1, 0}, match)
+}
+
+func TestHungarianRectangular(t *testing.T) {
+	wide := [][]float64{
+		{0.5, 1.2, 0.3},
+		{0.1, 0.6, 0.4},
+	}
+	res, err := hungarian.Solve(wide)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{2, 0}, res)
+
+	tall := [][]float64{
+		{0.5, 1.2},
+		{0.1, 0.6},
+		{0.2, 1.4},
+	}
+	res, err = hungarian.Solve(tall)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{-1, 1, 0}, res)
+}
+
+func TestHungarianInvalid(t *testing.T) {
+	for _, graph := range [][][]float64{
+		{},
+		{{}},
+		{{0.5, 1.2}, {0.1}},
+		{{0.5, -1}},
+		{{0.5, math.NaN()}},
+		{{math.Inf(1), 1.2}},
+		{{0.5, math.Inf(-1)}},
+	} {
+		_, err := hungarian.Solve(graph)
+		assert.Error(t, err, "%v", graph)
+	}
+}
+
+// FuzzHungarian checks Solve against a brute force search on small matrices. The first two bytes give the
+// shape, and each following byte a cost in tenths, the 0xff byte being an infeasible pair.
+func FuzzHungarian(f *testing.F) {
+	f.Add([]byte{3, 3, 5, 12, 3, 1, 6, 4, 2, 14, 5})
+	f.Add([]byte{2, 4, 1, 2, 3, 4, 4, 3, 2, 1})
+	f.Add([]byte{4, 2, 0xff, 1, 0xff, 0xff, 7, 0xff, 3, 3})
+	f.Add([]byte{5, 5, 1, 2, 3, 1, 2, 3, 1, 2, 3, 1, 2, 3, 1, 2, 3, 1, 2, 3, 1, 2, 3, 1, 2, 3, 1})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if len(data) < 2 {
+			return
+		}
+		rows, cols := int(data[0]%5)+1, int(data[1]%5)+1
+		data = data[2:]
+		if len(data) < rows*cols {
+			return
+		}
+		graph := make([][]float64, rows)
+		for i := range graph {
+			graph[i] = make([]float64, cols)
+			for j := range graph[i] {
+				b := data[i*cols+j]
+				if b == 0xff {
+					graph[i][j] = hungarian.Infeasible
+				} else {
+					graph[i][j] = float64(b) / 10
+				}
+			}
+		}
+
+		res, err := hungarian.Solve(graph)
+		if err != nil {
+			t.Fatalf("Solve(%v): %v", graph, err)
+		}
+		if len(res) != rows {
+			t.Fatalf("Solve(%v) = %v, expected %d rows", graph, res, rows)
+		}
+		count, cost := 0, 0.0
+		used := make(map[int]bool)
+		for i, j := range res {
+			if j < 0 {
+				continue
+			}
+			if j >= cols || used[j] || graph[i][j] == hungarian.Infeasible {
+				t.Fatalf("Solve(%v) = %v, invalid pair (%d,%d)", graph, res, i, j)
+			}
+			used[j] = true
+			count++
+			cost += graph[i][j]
+		}
+		bestCount, bestCost := bruteForce(graph, 0, make([]bool, cols))
+		if count != bestCount || math.Abs(cost-bestCost) > 1e-6 {
+			t.Fatalf("Solve(%v) = %v matching %d for %v, expected %d for %v", graph, res, count, cost, bestCount, bestCost)
+		}
+	})
+}
+
+// bruteForce returns the most feasible pairs the rows from row on can be matched with, and the lowest cost of it.
+func bruteForce(graph [][]float64, row int, used []bool) (int, float64) {
+	if row == len(graph) {
+		return 0, 0
+	}
+	bestCount, bestCost := bruteForce(graph, row+1, used)
+	for j, c := range graph[row] {
+		if used[j] || c == hungarian.Infeasible {
+			continue
+		}
+		used[j] = true
+		count, cost := bruteForce(graph, row+1, used)
+		used[j] = false
+		count, cost = count+1, cost+c
+		if count > bestCount || count == bestCount && cost < bestCost {
+			bestCount, bestCost = count, cost
+		}
+	}
+	return bestCount, bestCost
+}
+
+func TestHungarianRevisitedColumn(t *testing.T) {
+	inf := hungarian.Infeasible
+	// used to loop forever, an edge to a column already in the tree rewired it into a cycle
+	graph := [][]float64{
+		{22.5, 16.8, 17.7},
+		{19.6, 23.9, 23.8},
+		{10.6, 4.7, 4.3},
+		{inf, inf, 15.4},
+		{22, 11.7, 20},
+	}
+	res, err := hungarian.Solve(graph)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{-1, 0, 2, -1, 1}, res)
+}
+
+func TestHungarianWarm(t *testing.T) {
+	graph := [][]float64{
+		{0.5, 1.2, 0.3},
+		{0.1, 0.6, 0.4},
+		{0.2, 1.4, 0.5},
+	}
+	res, prices, err := hungarian.SolveWarm(graph, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{2, 1, 0}, res)
+	assert.Len(t, prices, 3)
+
+	// the previous solution and prices lead to the same optimum, even once a cost changed
+	graph[1][1] = 0.05
+	warm, _, err := hungarian.SolveWarm(graph, prices, res)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{2, 1, 0}, warm)
+
+	// a stale seed and stray prices are only a starting point
+	graph[1][1] = 2.0
+	graph[2][2] = 0.6
+	warm, _, err = hungarian.SolveWarm(graph, []float64{9, 0, 4, 1}, []int{1, 1, 7})
+	assert.NoError(t, err)
+	cold, err := hungarian.Solve(graph)
+	assert.NoError(t, err)
+	assert.Equal(t, cold, warm)
+}
@@ -0,0 +1,158 @@
+// Package mincostflow finds the cheapest maximum flow of a network by successive shortest augmenting paths. Unlike
+// the matrix solvers, it only walks the edges given, and the edges carry capacities: an assignment where a column
+// takes several rows, like a pooled car taking several riders, is a flow too.
+package mincostflow
+
+import (
+	"easyRide/activities/hungarian"
+	"fmt"
+	"math"
+)
+
+// tolerance of the path costs against float drift
+const epsilon = 1e-9
+
+// Graph is a flow network over the nodes 0 to n-1.
+type Graph struct {
+	n     int
+	edges []edge
+	out   [][]int // edges leaving each node, the reverse edges included
+}
+
+type edge struct {
+	to       int
+	capacity int
+	flow     int
+	cost     float64
+}
+
+// New returns a network of n nodes without edges.
+func New(n int) *Graph {
+	return &Graph{n: n, out: make([][]int, n)}
+}
+
+// AddEdge adds an edge and returns its index, to read its flow once the network is run.
+func (g *Graph) AddEdge(from, to, capacity int, cost float64) int {
+	id := len(g.edges)
+	g.edges = append(g.edges, edge{to, capacity, 0, cost}, edge{from, 0, 0, -cost})
+	g.out[from] = append(g.out[from], id)
+	g.out[to] = append(g.out[to], id+1)
+	return id
+}
+
+// Flow returns the flow through the edge.
+func (g *Graph) Flow(id int) int {
+	return g.edges[id].flow
+}
+
+// Run pushes the most flow from source to sink, at the lowest cost among the maximum flows.
+// It returns the flow and its cost.
+func (g *Graph) Run(source, sink int) (int, float64) {
+	flow, cost := 0, 0.0
+	for {
+		prev, ok := g.shortestPath(source, sink)
+		if !ok {
+			return flow, cost
+		}
+		push := math.MaxInt
+		for v := sink; v != source; v = g.edges[prev[v]^1].to {
+			e := g.edges[prev[v]]
+			if e.capacity-e.flow < push {
+				push = e.capacity - e.flow
+			}
+		}
+		for v := sink; v != source; v = g.edges[prev[v]^1].to {
+			g.edges[prev[v]].flow += push
+			g.edges[prev[v]^1].flow -= push
+			cost += float64(push) * g.edges[prev[v]].cost
+		}
+		flow += push
+	}
+}
+
+// shortestPath finds the cheapest path of the residual network with Bellman-Ford, the reverse edges having negative
+// costs. It returns the edge reaching each node of the path.
+func (g *Graph) shortestPath(source, sink int) ([]int, bool) {
+	dist := make([]float64, g.n)
+	prev := make([]int, g.n)
+	for v := range dist {
+		dist[v] = math.Inf(1)
+		prev[v] = -1
+	}
+	dist[source] = 0
+	// a shortest path has at most n-1 edges, bounding the rounds keeps float drift from looping forever
+	for round := 1; round < g.n; round++ {
+		changed := false
+		for u := 0; u < g.n; u++ {
+			if math.IsInf(dist[u], 1) {
+				continue
+			}
+			for _, id := range g.out[u] {
+				e := g.edges[id]
+				if e.flow < e.capacity && dist[u]+e.cost < dist[e.to]-epsilon {
+					dist[e.to] = dist[u] + e.cost
+					prev[e.to] = id
+					changed = true
+				}
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+	return prev, !math.IsInf(dist[sink], 1)
+}
+
+// Solve returns the assignment of the rows, with the same contract as hungarian.Solve.
+func Solve(costs [][]float64) ([]int, error) {
+	if err := hungarian.Validate(costs); err != nil {
+		return []int{}, err
+	}
+	capacity := make([]int, len(costs[0]))
+	for j := range capacity {
+		capacity[j] = 1
+	}
+	return SolveCapacity(costs, capacity)
+}
+
+// SolveCapacity assigns each row to a column, the column j taking up to capacity[j] rows. It assigns the most rows
+// to feasible columns, at the lowest total cost, the rows left without a column being -1.
+func SolveCapacity(costs [][]float64, capacity []int) ([]int, error) {
+	if err := hungarian.Validate(costs); err != nil {
+		return []int{}, err
+	}
+	rows, cols := len(costs), len(costs[0])
+	if len(capacity) != cols {
+		return []int{}, fmt.Errorf("The costs matrix has %d columns but %d capacities.", cols, len(capacity))
+	}
+
+	// nodes: the source, the rows, the columns and the sink
+	source, sink := 0, rows+cols+1
+	g := New(rows + cols + 2)
+	pairs := make([][]int, rows)
+	for i, row := range costs {
+		g.AddEdge(source, 1+i, 1, 0)
+		pairs[i] = make([]int, cols)
+		for j, c := range row {
+			pairs[i][j] = -1
+			if c != hungarian.Infeasible {
+				pairs[i][j] = g.AddEdge(1+i, 1+rows+j, 1, c)
+			}
+		}
+	}
+	for j, c := range capacity {
+		g.AddEdge(1+rows+j, sink, c, 0)
+	}
+	g.Run(source, sink)
+
+	res := make([]int, rows)
+	for i := range res {
+		res[i] = -1
+		for j, id := range pairs[i] {
+			if id >= 0 && g.Flow(id) > 0 {
+				res[i] = j
+			}
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,41 @@
+package mincostflow
+
+import (
+	"easyRide/activities/hungarian"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	// two paths to the sink, the cheap one too narrow for the whole flow
+	g := New(4)
+	cheap := g.AddEdge(0, 1, 1, 1)
+	g.AddEdge(1, 3, 1, 1)
+	dear := g.AddEdge(0, 2, 5, 2)
+	g.AddEdge(2, 3, 2, 2)
+	flow, cost := g.Run(0, 3)
+	assert.Equal(t, 3, flow)
+	assert.Equal(t, 10.0, cost)
+	assert.Equal(t, 1, g.Flow(cheap))
+	assert.Equal(t, 2, g.Flow(dear))
+}
+
+func TestSolveCapacity(t *testing.T) {
+	inf := hungarian.Infeasible
+	costs := [][]float64{
+		{0.5, 1.2},
+		{0.1, 0.6},
+		{0.2, inf},
+	}
+	// the first column is a car with two seats
+	res, err := SolveCapacity(costs, []int{2, 1})
+	assert.NoError(t, err)
+	assert.Equal(t, []int{0, 1, 0}, res)
+
+	res, err = SolveCapacity(costs, []int{1, 1})
+	assert.NoError(t, err)
+	assert.Equal(t, []int{-1, 1, 0}, res)
+
+	_, err = SolveCapacity(costs, []int{1})
+	assert.Error(t, err)
+}
@@ -0,0 +1,130 @@
+package activities
+
+import (
+	"context"
+	data "easyRide/db"
+	"easyRide/models"
+	"easyRide/signals"
+	"go.temporal.io/sdk/activity"
+)
+
+// DriverSpeed is how fast drivers move, in location units per second.
+var DriverSpeed = 0.1
+
+// DriverArrivedAtPickup records that the driver is waiting at the pickup location.
+func DriverArrivedAtPickup(ctx context.Context, tripID string, passengerID int, match models.MatchResult) error {
+	db, err := data.Initialize()
+	if err != nil {
+		return err
+	}
+	defer db.Conn.Close()
+	if err := db.SetDriverArrivedAtPickup(tripID); err != nil {
+		return err
+	}
+	// the driver may not have confirmed the trip before heading to the passenger,
+	// a driver picking up a rider on the way is already on a trip
+	if !match.JoinedRoute {
+		notifyDriver(ctx, match.DriverID, passengerID, models.DriverEnRoute)
+	}
+	return nil
+}
+
+// PickUp records the pickup time against the ETA given at matching, and starts the trip of the driver.
+func PickUp(ctx context.Context, tripID string, passengerID int, match models.MatchResult) error {
+	db, err := data.Initialize()
+	if err != nil {
+		return err
+	}
+	defer db.Conn.Close()
+	eta, pickedUpAt, err := db.SetPickedUp(tripID)
+	if err != nil {
+		return err
+	}
+	activity.GetLogger(ctx).Info("Passenger picked up.", "PassengerID", passengerID,
+		"PickupETA", eta, "PickedUpAt", pickedUpAt, "Delay", pickedUpAt.Sub(eta))
+	if match.Pooled {
+		if _, err := db.CompleteStop(tripID, models.StopPickup); err != nil && err != data.ErrNoMatch {
+			return err
+		}
+	}
+	if !match.JoinedRoute {
+		notifyDriver(ctx, match.DriverID, passengerID, models.DriverOnTrip)
+	}
+	return nil
+}
+
+// DriverLate takes the driver who did not reach the pickup location in time off the trip. The trip is aborted and
+// the passenger is told to request another one.
+func DriverLate(ctx context.Context, tripID string, passengerID int, match models.MatchResult) error {
+	activity.GetLogger(ctx).Info("Driver did not reach the pickup location.", "PassengerID", passengerID,
+		"DriverID", match.DriverID)
+	if err := ReleaseDriver(ctx, tripID, passengerID, match); err != nil {
+		return err
+	}
+	db, err := data.Initialize()
+	if err != nil {
+		return err
+	}
+	defer db.Conn.Close()
+	if err := db.RestorePassenger(passengerID, tripID); err != nil {
+		return err
+	}
+	if err := db.AbortTrip(tripID); err != nil {
+		return err
+	}
+	return db.AddNotification(passengerID, "Your driver could not reach you in time, you can request another trip.")
+}
+
+// NoShow charges the passenger the no-show fee, ends the trip and frees the driver at the pickup location.
+func NoShow(ctx context.Context, tripID string, passengerID int, match models.MatchResult, fee float64) error {
+	activity.GetLogger(ctx).Info("Passenger did not show up.", "PassengerID", passengerID, "Fee", fee)
+	db, err := data.Initialize()
+	if err != nil {
+		return err
+	}
+	defer db.Conn.Close()
+	driverID := match.DriverID
+	pickupLoc, err := db.GetPickupLoc(passengerID)
+	if err != nil {
+		return err
+	}
+	if err := db.SetNoShow(tripID, fee); err != nil {
+		return err
+	}
+	if match.Pooled {
+		remaining, err := completeStops(&db, tripID)
+		if err != nil {
+			return err
+		}
+		if remaining > 0 {
+			// the driver goes on with the other riders
+			return db.SetPassengerTripEnd(passengerID)
+		}
+	}
+	if err := db.UpdateDriverLoc(driverID, pickupLoc); err != nil {
+		return err
+	}
+	if err := db.UpdateDriverStatus(driverID, &models.Passenger{}, true); err != nil {
+		return err
+	}
+	if err := db.SetPassengerTripEnd(passengerID); err != nil {
+		return err
+	}
+	change := models.DriverStateChange{State: models.DriverAvailable, Loc: pickupLoc}
+	if err := signals.SendDriverSignal(driverID, signals.SIGNAL_DRIVER_STATE, change); err != nil {
+		activity.GetLogger(ctx).Warn("Driver has no shift running", "DriverID", driverID, "Error", err)
+	}
+	return nil
+}
+
+// completeStops takes both stops of a pooled trip off the route and returns how many stops the driver has left.
+func completeStops(db *data.Database, tripID string) (remaining int, e error) {
+	for _, kind := range []models.StopKind{models.StopPickup, models.StopDrop} {
+		n, err := db.CompleteStop(tripID, kind)
+		if err != nil && err != data.ErrNoMatch {
+			return 0, err
+		}
+		remaining = n
+	}
+	return remaining, nil
+}
@@ -0,0 +1,170 @@
+// Package pool plans the routes of pooled rides: a new rider is inserted into the route of a driver at the
+// cheapest place that keeps every rider's detour bounded, and the fare of the route is split between the riders.
+package pool
+
+import (
+	"easyRide/models"
+	"math"
+)
+
+// tolerance of the detour bound against float drift
+const epsilon = 1e-9
+
+// Insertion is the cheapest way found to add a rider to a route.
+type Insertion struct {
+	Stops []models.Stop
+	// Cost is the length added to the route
+	Cost float64
+	// PickupDistance is how far the driver drives before picking the new rider up
+	PickupDistance float64
+}
+
+// Insert finds the cheapest places of the pickup and drop of a new rider in the route, the stops already done stay
+// in place. The route must keep at most capacity riders aboard, no rider may ride farther than (1+maxDetour) times
+// the direct distance, and the driver must reach the new rider within maxPickup, 0 means no limit.
+// It reports false when no insertion is feasible.
+func Insert(route models.PoolRoute, pickup, drop models.Stop, capacity int, maxDetour float64,
+	maxPickup float64) (Insertion, bool) {
+	first := firstUndone(route.Stops)
+	base := pathLength(route.DriverLoc, route.Stops)
+
+	best := Insertion{Cost: math.Inf(1)}
+	found := false
+	for i := first; i <= len(route.Stops); i++ {
+		withPickup := insertAt(route.Stops, i, pickup)
+		for j := i + 1; j <= len(withPickup); j++ {
+			stops := insertAt(withPickup, j, drop)
+			if !Feasible(route.DriverLoc, stops, capacity, maxDetour) {
+				continue
+			}
+			at, driverAt := distances(route.DriverLoc, stops)
+			if maxPickup > 0 && at[i]-driverAt > maxPickup+epsilon {
+				continue
+			}
+			cost := pathLength(route.DriverLoc, stops) - base
+			if cost < best.Cost {
+				best = Insertion{Stops: stops, Cost: cost, PickupDistance: at[i] - driverAt}
+				found = true
+			}
+		}
+	}
+	return best, found
+}
+
+// Feasible checks the capacity and the detour bound of a route driven from the driver location.
+func Feasible(driverLoc int, stops []models.Stop, capacity int, maxDetour float64) bool {
+	at, _ := distances(driverLoc, stops)
+
+	aboard := 0
+	pickedUp := make(map[int]int)
+	for k, s := range stops {
+		switch s.Kind {
+		case models.StopPickup:
+			pickedUp[s.PassengerID] = k
+			aboard++
+		case models.StopDrop:
+			if s.Done {
+				aboard--
+				continue
+			}
+			p, ok := pickedUp[s.PassengerID]
+			if !ok {
+				// dropped before being picked up
+				return false
+			}
+			direct := math.Abs(float64(s.Loc - stops[p].Loc))
+			if at[k]-at[p] > direct*(1+maxDetour)+epsilon {
+				return false
+			}
+			aboard--
+		}
+		if aboard > capacity {
+			return false
+		}
+	}
+	return true
+}
+
+// SplitFare shares the length of the route between the riders: each leg is split equally between the riders
+// aboard, and nobody pays more than the direct distance of their own ride.
+func SplitFare(stops []models.Stop) map[int]float64 {
+	fares := make(map[int]float64)
+	direct := make(map[int]float64)
+	pickupLoc := make(map[int]int)
+	aboard := make(map[int]bool)
+	for k, s := range stops {
+		if k > 0 && len(aboard) > 0 {
+			share := math.Abs(float64(s.Loc-stops[k-1].Loc)) / float64(len(aboard))
+			for id := range aboard {
+				fares[id] += share
+			}
+		}
+		switch s.Kind {
+		case models.StopPickup:
+			aboard[s.PassengerID] = true
+			pickupLoc[s.PassengerID] = s.Loc
+		case models.StopDrop:
+			delete(aboard, s.PassengerID)
+			direct[s.PassengerID] = math.Abs(float64(s.Loc - pickupLoc[s.PassengerID]))
+		}
+	}
+	for id, fare := range fares {
+		if d, ok := direct[id]; ok && fare > d {
+			fares[id] = d
+		}
+	}
+	return fares
+}
+
+// distances gives how far along the path each stop and the driver are. The stops done are followed by the driver
+// location, then by the stops left.
+func distances(driverLoc int, stops []models.Stop) (at []float64, driverAt float64) {
+	first := firstUndone(stops)
+	at = make([]float64, len(stops))
+	total := 0.0
+	prev := driverLoc
+	if first > 0 {
+		prev = stops[0].Loc
+	}
+	for k, s := range stops {
+		if k == first {
+			total += math.Abs(float64(driverLoc - prev))
+			driverAt = total
+			prev = driverLoc
+		}
+		total += math.Abs(float64(s.Loc - prev))
+		prev = s.Loc
+		at[k] = total
+	}
+	if first == len(stops) {
+		driverAt = total + math.Abs(float64(driverLoc-prev))
+	}
+	return at, driverAt
+}
+
+// pathLength is the distance left to drive from the driver location through the stops not done.
+func pathLength(driverLoc int, stops []models.Stop) float64 {
+	length := 0.0
+	prev := driverLoc
+	for _, s := range stops[firstUndone(stops):] {
+		length += math.Abs(float64(s.Loc - prev))
+		prev = s.Loc
+	}
+	return length
+}
+
+func firstUndone(stops []models.Stop) int {
+	for k, s := range stops {
+		if !s.Done {
+			return k
+		}
+	}
+	return len(stops)
+}
+
+func insertAt(stops []models.Stop, i int, s models.Stop) []models.Stop {
+	res := make([]models.Stop, 0, len(stops)+1)
+	res = append(res, stops[:i]...)
+	res = append(res, s)
+	return append(res, stops[i:]...)
+}
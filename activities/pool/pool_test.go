@@ -0,0 +1,59 @@
+package pool
+
+import (
+	"easyRide/models"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func pickup(id int, loc int, done bool) models.Stop {
+	return models.Stop{PassengerID: id, Kind: models.StopPickup, Loc: loc, Done: done}
+}
+
+func drop(id int, loc int) models.Stop {
+	return models.Stop{PassengerID: id, Kind: models.StopDrop, Loc: loc}
+}
+
+func TestInsertEmptyRoute(t *testing.T) {
+	route := models.PoolRoute{DriverID: 1, DriverLoc: 0}
+	res, ok := Insert(route, pickup(2, 2, false), drop(2, 8), 3, 0.5, 0)
+	assert.True(t, ok)
+	assert.Equal(t, []models.Stop{pickup(2, 2, false), drop(2, 8)}, res.Stops)
+	assert.Equal(t, 8.0, res.Cost)
+}
+
+func TestInsertOnTheWay(t *testing.T) {
+	route := models.PoolRoute{DriverID: 1, DriverLoc: 1, Stops: []models.Stop{pickup(1, 0, true), drop(1, 10)}}
+	res, ok := Insert(route, pickup(2, 2, false), drop(2, 6), 2, 0.5, 0)
+	assert.True(t, ok)
+	assert.Equal(t, []models.Stop{pickup(1, 0, true), pickup(2, 2, false), drop(2, 6), drop(1, 10)}, res.Stops)
+	assert.Equal(t, 0.0, res.Cost)
+}
+
+func TestInsertCapacity(t *testing.T) {
+	route := models.PoolRoute{DriverID: 1, DriverLoc: 0, Stops: []models.Stop{pickup(1, 0, true), drop(1, 10)}}
+	res, ok := Insert(route, pickup(2, 2, false), drop(2, 6), 1, 0.5, 0)
+	assert.True(t, ok)
+	assert.Equal(t, []models.Stop{pickup(1, 0, true), drop(1, 10), pickup(2, 2, false), drop(2, 6)}, res.Stops)
+	assert.Equal(t, 12.0, res.Cost)
+}
+
+func TestInsertDetourBound(t *testing.T) {
+	route := models.PoolRoute{DriverID: 1, DriverLoc: 0, Stops: []models.Stop{pickup(1, 0, true), drop(1, 10)}}
+	// after the drop of the first rider the new one would wait too long, before it the detour is too long
+	_, ok := Insert(route, pickup(2, 5, false), drop(2, -5), 3, 0.2, 10)
+	assert.False(t, ok)
+	_, ok = Insert(route, pickup(2, 5, false), drop(2, -5), 3, 0.2, 0)
+	assert.True(t, ok)
+}
+
+func TestSplitFare(t *testing.T) {
+	stops := []models.Stop{pickup(1, 0, true), pickup(2, 2, false), drop(2, 6), drop(1, 10)}
+	assert.Equal(t, map[int]float64{1: 8, 2: 2}, SplitFare(stops))
+
+	// a detour is never charged beyond the direct distance
+	stops = []models.Stop{pickup(1, 0, true), pickup(2, 12, false), drop(1, 10), drop(2, 4)}
+	fares := SplitFare(stops)
+	assert.Equal(t, 10.0, fares[1])
+	assert.Equal(t, 7.0, fares[2])
+}
@@ -0,0 +1,163 @@
+package activities
+
+import (
+	"context"
+	"easyRide/activities/pool"
+	postgres "easyRide/db"
+	"easyRide/models"
+	"easyRide/signals"
+	"go.temporal.io/sdk/activity"
+	"time"
+)
+
+// Pooled ride rules.
+var (
+	// PoolCapacity is the most riders aboard a pooled ride at once.
+	PoolCapacity = 3
+	// PoolMaxDetour bounds how much longer than the direct distance a pooled rider may ride, as a fraction.
+	PoolMaxDetour = 0.5
+)
+
+// joinPoolRoutes adds the pooled passengers left out of the round to the routes of the drivers already carrying
+// pooled riders, at the cheapest insertion that keeps every rider's detour bounded.
+func joinPoolRoutes(ctx context.Context, db *postgres.Database, roundID string, p models.PassengerList,
+	matched map[int]bool) error {
+	routes, err := db.GetPoolRoutes()
+	if err != nil || len(routes) == 0 {
+		return err
+	}
+	for _, passenger := range p.Passengers {
+		if !passenger.Pooled || matched[passenger.ID] {
+			continue
+		}
+		pickup := models.Stop{TripID: passenger.WorkflowID, PassengerID: passenger.ID, Kind: models.StopPickup,
+			Loc: passenger.PickupLoc}
+		drop := models.Stop{TripID: passenger.WorkflowID, PassengerID: passenger.ID, Kind: models.StopDrop,
+			Loc: passenger.DropLoc}
+		best, found := -1, pool.Insertion{}
+		for r, route := range routes {
+			driver := models.Driver{ID: route.DriverID, Loc: route.DriverLoc, Vehicle: route.Vehicle,
+				Preferences: route.Preferences}
+			// the pickup distance is bounded along the route, not from where the driver is
+			maxPickup := passenger.MatchRadius
+			if limit := driver.Preferences.MaxPickupDistance; limit > 0 && (maxPickup == 0 || limit < maxPickup) {
+				maxPickup = limit
+			}
+			driver.Preferences.MaxPickupDistance = 0
+			unbounded := passenger
+			unbounded.MatchRadius = 0
+			if !feasible(&unbounded, &driver) {
+				continue
+			}
+			capacity := PoolCapacity
+			if route.Vehicle.Seats < capacity {
+				capacity = route.Vehicle.Seats
+			}
+			insertion, ok := pool.Insert(route, pickup, drop, capacity, PoolMaxDetour, float64(maxPickup))
+			if ok && (best < 0 || insertion.Cost < found.Cost) {
+				best, found = r, insertion
+			}
+		}
+		if best < 0 {
+			continue
+		}
+		joined, err := joinPoolRoute(ctx, db, roundID, &passenger, &routes[best], found)
+		if err != nil {
+			return err
+		}
+		if joined {
+			routes[best].Stops = found.Stops
+			matched[passenger.ID] = true
+		}
+	}
+	return nil
+}
+
+// joinPoolRoute matches the passenger with the driver of the route, and tells the riders already on it. It reports
+// false when the passenger is left to the next round: the request was withdrawn, or the trip could not be told.
+func joinPoolRoute(ctx context.Context, db *postgres.Database, roundID string, passenger *models.Passenger,
+	route *models.PoolRoute, insertion pool.Insertion) (bool, error) {
+	driver := models.Driver{ID: route.DriverID, Loc: route.DriverLoc, Vehicle: route.Vehicle}
+	eta := time.Now().Add(time.Duration(insertion.PickupDistance / DriverSpeed * float64(time.Second)))
+	joined, err := db.JoinPoolRoute(passenger.WorkflowID, passenger, &driver, eta, insertion.Stops,
+		poolFares(insertion.Stops, route.Vehicle.Class))
+	if err != nil || !joined {
+		return false, err
+	}
+	result := models.MatchResult{
+		Matched:     true,
+		DriverID:    driver.ID,
+		DriverLoc:   driver.Loc,
+		PickupETA:   eta,
+		Cost:        insertion.Cost,
+		RoundID:     roundID,
+		Pooled:      true,
+		JoinedRoute: true,
+	}
+	if err := signals.SendMatchSignal(passenger.WorkflowID, result); err != nil {
+		// the trip never started, the passenger is left to the next round and the route is as it was
+		activity.GetLogger(ctx).Warn("Cannot start the trip, join undone.", "PassengerID", passenger.ID,
+			"DriverID", driver.ID, "Error", err)
+		err := db.LeavePoolRoute(passenger.WorkflowID, passenger.ID, driver.ID, route.Stops,
+			poolFares(route.Stops, route.Vehicle.Class))
+		return false, err
+	}
+	activity.GetLogger(ctx).Info("Passenger joined a pooled route.", "PassengerID", passenger.ID,
+		"DriverID", driver.ID, "AddedLength", insertion.Cost)
+
+	left := remainingStops(insertion.Stops)
+	for _, s := range left {
+		if s.Kind != models.StopDrop || s.PassengerID == passenger.ID {
+			continue
+		}
+		if err := signals.SendTripSignal(s.TripID, signals.SIGNAL_ROUTE_CHANGED, left); err != nil {
+			activity.GetLogger(ctx).Warn("Cannot tell the rider about the new route", "PassengerID", s.PassengerID,
+				"Error", err)
+		}
+	}
+	return true, nil
+}
+
+// startPoolRoute opens the route of a free driver matched with a pooled passenger.
+func startPoolRoute(db *postgres.Database, passenger *models.Passenger, driver *models.Driver) error {
+	stops := []models.Stop{
+		{TripID: passenger.WorkflowID, PassengerID: passenger.ID, Kind: models.StopPickup, Loc: passenger.PickupLoc},
+		{TripID: passenger.WorkflowID, PassengerID: passenger.ID, Kind: models.StopDrop, Loc: passenger.DropLoc},
+	}
+	if err := db.SetRoute(driver.ID, stops); err != nil {
+		return err
+	}
+	return setPoolFares(db, stops, driver.Vehicle.Class)
+}
+
+// setPoolFares splits the fare of the route between the riders not dropped yet, at the rate of the ride class.
+func setPoolFares(db *postgres.Database, stops []models.Stop, class models.RideClass) error {
+	for tripID, fare := range poolFares(stops, class) {
+		if err := db.SetTripFare(tripID, fare); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// poolFares are the fares of the riders of the route not dropped yet, by trip.
+func poolFares(stops []models.Stop, class models.RideClass) map[string]float64 {
+	shares := pool.SplitFare(stops)
+	fares := map[string]float64{}
+	for _, s := range remainingStops(stops) {
+		if s.Kind == models.StopDrop {
+			fares[s.TripID] = models.Fare(class, shares[s.PassengerID])
+		}
+	}
+	return fares
+}
+
+func remainingStops(stops []models.Stop) []models.Stop {
+	var left []models.Stop
+	for _, s := range stops {
+		if !s.Done {
+			left = append(left, s)
+		}
+	}
+	return left
+}
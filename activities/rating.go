@@ -0,0 +1,53 @@
+package activities
+
+import (
+	"context"
+	data "easyRide/db"
+	"easyRide/models"
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/temporal"
+	"time"
+)
+
+// SubmitRating stores a rating received within the rating window and refreshes the rated user's average.
+// The trip, the rater and both parties are filled in by the trip workflow.
+func SubmitRating(ctx context.Context, rating models.Rating) error {
+	db, err := data.Initialize()
+	if err != nil {
+		return err
+	}
+	defer db.Conn.Close()
+
+	err = db.AddRating(&rating)
+	switch err {
+	case nil:
+	case data.ErrDuplicateRating:
+		// stored by a previous attempt
+		activity.GetLogger(ctx).Info("Rating already stored.", "TripID", rating.TripID, "Rater", rating.Rater)
+	case data.ErrInvalidRating:
+		return temporal.NewNonRetryableApplicationError(err.Error(), "InvalidRating", err)
+	default:
+		return err
+	}
+	if rating.Rater == models.RaterPassenger {
+		return db.UpdateDriverRating(rating.DriverID)
+	}
+	return db.UpdatePassengerRating(rating.PassengerID)
+}
+
+// MissRating records on the trip that the rater let the rating window pass.
+func MissRating(ctx context.Context, tripID string, rater string) error {
+	db, err := data.Initialize()
+	if err != nil {
+		return err
+	}
+	defer db.Conn.Close()
+	return db.SetRatingMissed(tripID, rater)
+}
+
+// Rate is the rating step of the trips started before the rating window: it waits the time given to rate and records
+// nothing. It stays registered for those trips only.
+func Rate(ctx context.Context) error {
+	time.Sleep(15 * time.Second)
+	return nil
+}
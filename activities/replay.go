@@ -0,0 +1,105 @@
+package activities
+
+import (
+	"easyRide/activities/hungarian"
+	"easyRide/models"
+	"fmt"
+	"math"
+)
+
+var ErrInvalidAudit = fmt.Errorf("the audit does not have a row of costs and an assignment per passenger")
+
+// RoundReplay compares a stored match round with its replay.
+type RoundReplay struct {
+	RoundID string `json:"round_id"`
+	// Solver is the solver of the replay, StoredSolver the one of the round
+	Solver       string `json:"solver"`
+	StoredSolver string `json:"stored_solver"`
+	// CostsChanged is set when the costs were rebuilt from the snapshot and differ from the stored ones
+	CostsChanged bool `json:"costs_changed"`
+	// Matched and Cost sum up the assignments of the round and of the replay, the cost counting the replayed costs
+	StoredMatched   int     `json:"stored_matched"`
+	ReplayedMatched int     `json:"replayed_matched"`
+	StoredCost      float64 `json:"stored_cost"`
+	ReplayedCost    float64 `json:"replayed_cost"`
+	// Diffs are the passengers assigned differently
+	Diffs []AssignmentDiff `json:"diffs"`
+}
+
+// AssignmentDiff is a passenger assigned differently by the round and by its replay, a driver ID is 0 when
+// the passenger was left unassigned.
+type AssignmentDiff struct {
+	PassengerID      int     `json:"passenger_id"`
+	StoredDriverID   int     `json:"stored_driver_id"`
+	ReplayedDriverID int     `json:"replayed_driver_id"`
+	StoredCost       float64 `json:"stored_cost"`
+	ReplayedCost     float64 `json:"replayed_cost"`
+}
+
+// ReplayRound solves a stored round again with the named solver. With recompute, the costs are rebuilt from the
+// snapshot of the passengers and drivers, to see what the current cost model would have decided.
+func ReplayRound(audit models.RoundAudit, solver string, recompute bool) (RoundReplay, error) {
+	replay := RoundReplay{RoundID: audit.RoundID, Solver: solver, StoredSolver: audit.Solver}
+	if len(audit.Costs) != len(audit.Passengers) || len(audit.Assignments) != len(audit.Passengers) {
+		return replay, ErrInvalidAudit
+	}
+	costs := audit.Costs
+	if recompute {
+		costs = constructGraph(models.PassengerList{Passengers: audit.Passengers}, models.DriverList{Drivers: audit.Drivers})
+		replay.CostsChanged = !sameCosts(costs, audit.Costs)
+	}
+	s, err := GetSolver(solver)
+	if err != nil {
+		return replay, err
+	}
+	res, err := s.Solve(costs)
+	if err != nil {
+		return replay, err
+	}
+	replayed := models.RoundAudit{Drivers: audit.Drivers, Assignments: res}
+
+	for i, passenger := range audit.Passengers {
+		stored, again := audit.DriverOf(i), replayed.DriverOf(i)
+		diff := AssignmentDiff{PassengerID: passenger.ID, StoredDriverID: stored, ReplayedDriverID: again}
+		if j := audit.Assignments[i]; j >= 0 {
+			replay.StoredMatched++
+			diff.StoredCost = costs[i][j]
+			// a pair the current cost model forbids is not summed up, the diff shows it as Infeasible
+			if diff.StoredCost != hungarian.Infeasible {
+				replay.StoredCost += diff.StoredCost
+			}
+		}
+		if j := res[i]; j >= 0 {
+			replay.ReplayedMatched++
+			diff.ReplayedCost = costs[i][j]
+			replay.ReplayedCost += diff.ReplayedCost
+		}
+		if stored != again {
+			replay.Diffs = append(replay.Diffs, diff)
+		}
+	}
+	return replay, nil
+}
+
+func sameCosts(a, b [][]float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if len(a[i]) != len(b[i]) {
+			return false
+		}
+		for j := range a[i] {
+			if a[i][j] == hungarian.Infeasible || b[i][j] == hungarian.Infeasible {
+				if a[i][j] != b[i][j] {
+					return false
+				}
+				continue
+			}
+			if math.Abs(a[i][j]-b[i][j]) > 1e-9 {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,45 @@
+package activities
+
+import (
+	"easyRide/activities/hungarian"
+	"easyRide/models"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestReplayRound(t *testing.T) {
+	pl, dl := setUp()
+	pl.Passengers[0].ID, pl.Passengers[1].ID = 1, 2
+	dl.Drivers[0].ID, dl.Drivers[1].ID = 11, 12
+	graph := constructGraph(pl, dl)
+	res, err := hungarian.Solve(graph)
+	assert.NoError(t, err)
+	audit := models.NewRoundAudit("round-1", "hungarian", pl.Passengers, dl.Drivers, graph, res)
+
+	replay, err := ReplayRound(audit, "auction", false)
+	assert.NoError(t, err)
+	assert.Equal(t, "hungarian", replay.StoredSolver)
+	assert.Equal(t, 2, replay.ReplayedMatched)
+	assert.InDelta(t, replay.StoredCost, replay.ReplayedCost, 1e-9)
+	assert.Empty(t, replay.Diffs)
+
+	// the second passenger blocked the driver of the round since
+	audit.Passengers[1].BlockedDrivers = []int64{12}
+	replay, err = ReplayRound(audit, "hungarian", true)
+	assert.NoError(t, err)
+	assert.True(t, replay.CostsChanged)
+	assert.Equal(t, 2, replay.StoredMatched)
+	assert.Equal(t, 2, replay.ReplayedMatched)
+	assert.Equal(t, []AssignmentDiff{
+		{PassengerID: 1, StoredDriverID: 11, ReplayedDriverID: 12, StoredCost: 0.5, ReplayedCost: 1.2},
+		{PassengerID: 2, StoredDriverID: 12, ReplayedDriverID: 11, StoredCost: hungarian.Infeasible, ReplayedCost: 0.1},
+	}, replay.Diffs)
+	// the forbidden pair is left out of the stored cost
+	assert.InDelta(t, 0.5, replay.StoredCost, 1e-9)
+
+	_, err = ReplayRound(audit, "greedy", false)
+	assert.ErrorIs(t, err, ErrUnknownSolver)
+	audit.Assignments = audit.Assignments[:1]
+	_, err = ReplayRound(audit, "hungarian", false)
+	assert.ErrorIs(t, err, ErrInvalidAudit)
+}
@@ -0,0 +1,58 @@
+package activities
+
+import (
+	"context"
+	data "easyRide/db"
+	"easyRide/models"
+	"easyRide/signals"
+	"fmt"
+	"go.temporal.io/sdk/activity"
+)
+
+// RequestTrip enters the passenger's request into the matching pool once the trip workflow runs, the match signals
+// go to that workflow. It reports false when another trip of the passenger holds the matching pool.
+func RequestTrip(ctx context.Context, tripWorkflowID string, request models.PassengerRequestBody) (bool, error) {
+	db, err := data.Initialize()
+	if err != nil {
+		return false, err
+	}
+	defer db.Conn.Close()
+	requested, err := db.RequestTrip(tripWorkflowID, &request)
+	if err != nil || !requested {
+		return false, err
+	}
+	// the cron picks the passenger up if the dispatcher cannot be reached
+	if err := signals.SendDispatchSignal(signals.SIGNAL_PASSENGER_REQUESTED, request.ID); err != nil {
+		activity.GetLogger(ctx).Warn("Matching dispatcher is not running", "Error", err)
+	}
+	return true, nil
+}
+
+// WidenMatchRadius lets the next match rounds look farther for the passenger's driver, and tells the passenger.
+func WidenMatchRadius(ctx context.Context, passengerID int, radius int) error {
+	db, err := data.Initialize()
+	if err != nil {
+		return err
+	}
+	defer db.Conn.Close()
+	if err := db.SetMatchRadius(passengerID, radius); err != nil {
+		return err
+	}
+	return db.AddNotification(passengerID, fmt.Sprintf("Still looking for a driver, now searching within %d.", radius))
+}
+
+// CancelTripRequest gives up the passenger's request once no driver was found in time.
+// It reports false when the passenger got matched in the meantime, the trip goes on then.
+func CancelTripRequest(ctx context.Context, passengerID int) (bool, error) {
+	db, err := data.Initialize()
+	if err != nil {
+		return false, err
+	}
+	defer db.Conn.Close()
+	cancelled, err := db.CancelTripRequest(passengerID, activity.GetInfo(ctx).WorkflowExecution.ID)
+	if err != nil || !cancelled {
+		return false, err
+	}
+	activity.GetLogger(ctx).Info("Trip request timed out.", "PassengerID", passengerID)
+	return true, db.AddNotification(passengerID, "No driver is available right now, your request was cancelled.")
+}
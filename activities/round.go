@@ -0,0 +1,202 @@
+package activities
+
+import (
+	"easyRide/models"
+	"time"
+)
+
+// RoundPlan is what a match round decides, before anything is written or signalled.
+type RoundPlan struct {
+	// Passengers and Drivers are the rows and the columns of the cost matrix
+	Passengers []models.Passenger
+	Drivers    []models.Driver
+	Costs      [][]float64
+	// Assignments is the column assigned to each row, -1 when unassigned
+	Assignments []int
+	// Pairs are the passengers matched with a driver, in the order of the rows
+	Pairs []Pair
+	// State is left to the next round
+	State RoundState
+}
+
+// Pair is a passenger matched with a driver.
+type Pair struct {
+	Passenger models.Passenger
+	Driver    models.Driver
+	Cost      float64
+}
+
+// PlanRound weighs the waiting passengers against the available drivers and assigns them with the named solver,
+// warm started from the previous round. It only computes, so that the simulator plans rounds as Match does.
+func PlanRound(solver string, p models.PassengerList, d models.DriverList, prev RoundState) (RoundPlan, error) {
+	graph := constructGraph(p, d)
+	plan := RoundPlan{Passengers: p.Passengers[:len(graph)], Costs: graph}
+	if len(graph) == 0 || len(graph[0]) == 0 {
+		plan.State = prev.idle()
+		return plan, nil
+	}
+	plan.Drivers = d.Drivers[:len(graph[0])]
+	res, state, err := solveRound(solver, graph, plan.Passengers, plan.Drivers, prev)
+	if err != nil {
+		return plan, err
+	}
+	plan.Assignments, plan.State = res, state
+	for i, j := range res {
+		if j < 0 {
+			// no feasible driver left for the passenger
+			continue
+		}
+		plan.Pairs = append(plan.Pairs, Pair{Passenger: plan.Passengers[i], Driver: plan.Drivers[j], Cost: graph[i][j]})
+	}
+	return plan, nil
+}
+
+// Audit snapshots the plan for the audit log.
+func (r RoundPlan) Audit(roundID string) models.RoundAudit {
+	return models.NewRoundAudit(roundID, r.State.Solver, r.Passengers, r.Drivers, r.Costs, r.Assignments)
+}
+
+// WarmStartMaxChange is the largest share of new passengers and drivers in a round that still starts from the
+// previous round's solution, past it the round is solved from scratch.
+var WarmStartMaxChange = 0.25
+
+// RoundState is what a match round leaves to the next one, to warm start it.
+type RoundState struct {
+	// Solver is the solver of the round, the prices of another solver are not reused
+	Solver string
+	// Passengers and Drivers are the IDs of the rows and the columns of the round
+	Passengers []int
+	Drivers    []int
+	// Prices are the dual labels of the drivers, by driver ID
+	Prices map[int]float64
+	// Assignments is the solution of the round, driver ID by passenger ID. The pairs confirmed leave the waiting
+	// lists, so only the pairs the round could not confirm seed the next one.
+	Assignments map[int]int
+	// WarmStarted tells whether the round started from the previous one
+	WarmStarted bool
+	// Skipped tells the round did not run, another round held the match lock
+	Skipped bool
+	// SolveTime is how long the solver ran
+	SolveTime time.Duration
+	// ColdSolveTime is the running average of the solves from scratch, to estimate what the warm starts save
+	ColdSolveTime time.Duration
+}
+
+// LatencySaved estimates the solve time the warm start saved, it is negative when the warm start was slower.
+func (r RoundState) LatencySaved() time.Duration {
+	if !r.WarmStarted || r.ColdSolveTime == 0 {
+		return 0
+	}
+	return r.ColdSolveTime - r.SolveTime
+}
+
+// idle is the state carried over a round that solved nothing.
+func (r RoundState) idle() RoundState {
+	r.WarmStarted = false
+	r.Skipped = false
+	r.SolveTime = 0
+	return r
+}
+
+// changedSince returns the share of the passengers and drivers of the round that were not in the previous one.
+func (r RoundState) changedSince(prev RoundState) float64 {
+	total := len(r.Passengers) + len(r.Drivers)
+	if total == 0 {
+		return 0
+	}
+	changed := countNew(r.Passengers, prev.Passengers) + countNew(r.Drivers, prev.Drivers)
+	return float64(changed) / float64(total)
+}
+
+func countNew(ids []int, prev []int) int {
+	seen := make(map[int]bool, len(prev))
+	for _, id := range prev {
+		seen[id] = true
+	}
+	count := 0
+	for _, id := range ids {
+		if !seen[id] {
+			count++
+		}
+	}
+	return count
+}
+
+// solveRound assigns the drivers to the passengers of the round with the named solver, the rows and the columns of
+// the graph being the first passengers and drivers. When the solver can warm start and few passengers or drivers
+// changed since the previous round, it starts from the previous prices and solution.
+// It returns the assignment and the state left to the next round.
+func solveRound(name string, graph [][]float64, p []models.Passenger, d []models.Driver,
+	prev RoundState) ([]int, RoundState, error) {
+	solver, err := GetSolver(name)
+	if err != nil {
+		return nil, prev, err
+	}
+	state := RoundState{Solver: name, ColdSolveTime: prev.ColdSolveTime}
+	for _, passenger := range p[:len(graph)] {
+		state.Passengers = append(state.Passengers, passenger.ID)
+	}
+	for _, driver := range d[:len(graph[0])] {
+		state.Drivers = append(state.Drivers, driver.ID)
+	}
+
+	var res []int
+	var prices []float64
+	start := time.Now()
+	if warm, ok := solver.(WarmSolver); ok {
+		var startPrices []float64
+		var seed []int
+		if prev.Solver == name && len(prev.Prices) > 0 && state.changedSince(prev) <= WarmStartMaxChange {
+			state.WarmStarted = true
+			startPrices, seed = state.warmStart(prev)
+		}
+		res, prices, err = warm.SolveWarm(graph, startPrices, seed)
+	} else {
+		res, err = solver.Solve(graph)
+	}
+	state.SolveTime = time.Since(start)
+	if err != nil {
+		return nil, prev, err
+	}
+
+	if !state.WarmStarted {
+		if state.ColdSolveTime == 0 {
+			state.ColdSolveTime = state.SolveTime
+		} else {
+			state.ColdSolveTime = (3*state.ColdSolveTime + state.SolveTime) / 4
+		}
+	}
+	if prices != nil {
+		state.Prices = make(map[int]float64, len(state.Drivers))
+		for j, id := range state.Drivers {
+			state.Prices[id] = prices[j]
+		}
+	}
+	state.Assignments = make(map[int]int)
+	for i, j := range res {
+		if j >= 0 {
+			state.Assignments[state.Passengers[i]] = state.Drivers[j]
+		}
+	}
+	return res, state, nil
+}
+
+// warmStart maps the previous prices and assignments onto the columns and rows of the round.
+func (r RoundState) warmStart(prev RoundState) ([]float64, []int) {
+	prices := make([]float64, len(r.Drivers))
+	column := make(map[int]int, len(r.Drivers))
+	for j, id := range r.Drivers {
+		prices[j] = prev.Prices[id]
+		column[id] = j
+	}
+	seed := make([]int, len(r.Passengers))
+	for i, id := range r.Passengers {
+		seed[i] = -1
+		if driverID, ok := prev.Assignments[id]; ok {
+			if j, ok := column[driverID]; ok {
+				seed[i] = j
+			}
+		}
+	}
+	return prices, seed
+}
@@ -0,0 +1,124 @@
+package activities
+
+import (
+	"context"
+	"easyRide/activities/hungarian"
+	"easyRide/models"
+	"github.com/stretchr/testify/assert"
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/workflow"
+	"strings"
+	"testing"
+	"time"
+)
+
+func roundOf(passengers, drivers []int) ([]models.Passenger, []models.Driver) {
+	p := make([]models.Passenger, len(passengers))
+	for i, id := range passengers {
+		p[i].ID = id
+	}
+	d := make([]models.Driver, len(drivers))
+	for j, id := range drivers {
+		d[j].ID = id
+	}
+	return p, d
+}
+
+func TestSolveRoundWarmStart(t *testing.T) {
+	graph := [][]float64{
+		{0.5, 1.2, 0.3},
+		{0.1, 0.6, 0.4},
+		{0.2, 1.4, 0.5},
+		{0.7, 0.3, 0.9},
+	}
+	p, d := roundOf([]int{1, 2, 3, 4}, []int{11, 12, 13})
+
+	res, first, err := solveRound("hungarian", graph, p, d, RoundState{})
+	assert.NoError(t, err)
+	assert.False(t, first.WarmStarted)
+	assert.Equal(t, []int{1, 2, 3, 4}, first.Passengers)
+	assert.Equal(t, []int{11, 12, 13}, first.Drivers)
+	assert.Len(t, first.Prices, 3)
+	assert.Equal(t, map[int]int{1: 13, 2: 11, 4: 12}, first.Assignments)
+	assert.Equal(t, []int{2, 0, -1, 1}, res)
+	assert.NotZero(t, first.ColdSolveTime)
+
+	// a passenger left and another came, the drivers are the same
+	graph[1] = []float64{0.9, 0.2, 1.1}
+	p[1].ID = 5
+	res, second, err := solveRound("hungarian", graph, p, d, first)
+	assert.NoError(t, err)
+	assert.True(t, second.WarmStarted)
+	cold, err := hungarian.Solve(graph)
+	assert.NoError(t, err)
+	assert.Equal(t, cold, res)
+	assert.Equal(t, first.ColdSolveTime, second.ColdSolveTime)
+
+	// the prices of another solver are not reused
+	_, other, err := solveRound("auction", graph, p, d, second)
+	assert.NoError(t, err)
+	assert.False(t, other.WarmStarted)
+	_, warm, err := solveRound("auction", graph, p, d, other)
+	assert.NoError(t, err)
+	assert.True(t, warm.WarmStarted)
+
+	// too many new passengers and drivers
+	p, d = roundOf([]int{6, 7, 8, 4}, []int{14, 12, 13})
+	_, third, err := solveRound("hungarian", graph, p, d, second)
+	assert.NoError(t, err)
+	assert.False(t, third.WarmStarted)
+	assert.Zero(t, third.LatencySaved())
+
+	// min-cost flow always solves from scratch and has no prices
+	_, flow, err := solveRound("mincostflow", graph, p, d, third)
+	assert.NoError(t, err)
+	assert.False(t, flow.WarmStarted)
+	assert.Nil(t, flow.Prices)
+
+	_, _, err = solveRound("greedy", graph, p, d, third)
+	assert.ErrorIs(t, err, ErrUnknownSolver)
+}
+
+func TestRoundStateIdle(t *testing.T) {
+	state := RoundState{Solver: "hungarian", Prices: map[int]float64{11: 0.2}, WarmStarted: true, SolveTime: 5}
+	idle := state.idle()
+	assert.False(t, idle.WarmStarted)
+	assert.Zero(t, idle.SolveTime)
+	assert.Equal(t, state.Prices, idle.Prices)
+}
+
+func roundIDActivity(ctx context.Context) (string, error) {
+	return roundIDOf(activity.GetInfo(ctx)), nil
+}
+
+func twoRoundsWorkflow(ctx workflow.Context) ([]string, error) {
+	ctx = workflow.WithActivityOptions(ctx, workflow.ActivityOptions{StartToCloseTimeout: time.Second})
+	var ids []string
+	for i := 0; i < 2; i++ {
+		var id string
+		if err := workflow.ExecuteActivity(ctx, roundIDActivity).Get(ctx, &id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func TestRoundIDOfTwoRoundsInOneRun(t *testing.T) {
+	var ts testsuite.WorkflowTestSuite
+	env := ts.NewTestWorkflowEnvironment()
+	env.RegisterWorkflow(twoRoundsWorkflow)
+	env.RegisterActivity(roundIDActivity)
+
+	env.ExecuteWorkflow(twoRoundsWorkflow)
+
+	assert.NoError(t, env.GetWorkflowError())
+	var ids []string
+	assert.NoError(t, env.GetWorkflowResult(&ids))
+	assert.Len(t, ids, 2)
+	assert.NotEqual(t, ids[0], ids[1])
+	run0, _, _ := strings.Cut(ids[0], "/")
+	run1, _, _ := strings.Cut(ids[1], "/")
+	assert.Equal(t, run0, run1)
+}
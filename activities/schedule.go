@@ -0,0 +1,38 @@
+package activities
+
+import (
+	"context"
+	data "easyRide/db"
+	"easyRide/models"
+	"easyRide/signals"
+	"go.temporal.io/sdk/activity"
+)
+
+// NotifyPassenger leaves a message to the passenger.
+func NotifyPassenger(ctx context.Context, passengerID int, message string) error {
+	db, err := data.Initialize()
+	if err != nil {
+		return err
+	}
+	defer db.Conn.Close()
+	return db.AddNotification(passengerID, message)
+}
+
+// DispatchScheduledTrip enters a trip booked ahead into the matching pool with priority.
+// It reports false while the passenger is busy with another trip, the dispatch is retried later then.
+func DispatchScheduledTrip(ctx context.Context, tripWorkflowID string, trip models.ScheduledTrip) (bool, error) {
+	db, err := data.Initialize()
+	if err != nil {
+		return false, err
+	}
+	defer db.Conn.Close()
+	dispatched, err := db.DispatchScheduledTrip(tripWorkflowID, &trip)
+	if err != nil || !dispatched {
+		return false, err
+	}
+	// the sweep of the dispatcher, or the cron, picks the passenger up otherwise
+	if err := signals.SendDispatchSignal(signals.SIGNAL_PASSENGER_REQUESTED, trip.PassengerID); err != nil {
+		activity.GetLogger(ctx).Warn("Matching dispatcher is not running", "Error", err)
+	}
+	return true, db.AddNotification(trip.PassengerID, "Your scheduled trip is being matched with a driver.")
+}
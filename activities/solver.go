@@ -0,0 +1,71 @@
+package activities
+
+import (
+	"easyRide/activities/auction"
+	"easyRide/activities/hungarian"
+	"easyRide/activities/mincostflow"
+	"fmt"
+)
+
+// Solver assigns the rows of a cost matrix, the passengers, to distinct columns, the drivers. Every solver
+// follows the contract of hungarian.Solve: the matrix may be rectangular, the most rows get a feasible column,
+// at the lowest total cost, and the rows left without one are -1.
+type Solver interface {
+	Solve(costs [][]float64) ([]int, error)
+}
+
+// SolverFunc makes a solve function a Solver.
+type SolverFunc func(costs [][]float64) ([]int, error)
+
+func (f SolverFunc) Solve(costs [][]float64) ([]int, error) {
+	return f(costs)
+}
+
+// WarmSolver is a Solver that can start from the column prices and the assignment of a previous solve, and
+// returns the prices it ended at. The prices are the dual labels of the columns.
+type WarmSolver interface {
+	Solver
+	SolveWarm(costs [][]float64, prices []float64, seed []int) ([]int, []float64, error)
+}
+
+type hungarianSolver struct{}
+
+func (hungarianSolver) Solve(costs [][]float64) ([]int, error) {
+	return hungarian.Solve(costs)
+}
+
+func (hungarianSolver) SolveWarm(costs [][]float64, prices []float64, seed []int) ([]int, []float64, error) {
+	return hungarian.SolveWarm(costs, prices, seed)
+}
+
+type auctionSolver struct{}
+
+func (auctionSolver) Solve(costs [][]float64) ([]int, error) {
+	return auction.Solve(costs)
+}
+
+// SolveWarm ignores the seed, the prices already lead the rows back to the columns they held.
+func (auctionSolver) SolveWarm(costs [][]float64, prices []float64, seed []int) ([]int, []float64, error) {
+	return auction.SolveWarm(costs, prices)
+}
+
+var ErrUnknownSolver = fmt.Errorf("unknown solver")
+
+// Solvers are the assignment solvers by name.
+var Solvers = map[string]Solver{
+	"hungarian":   hungarianSolver{},
+	"auction":     auctionSolver{},
+	"mincostflow": SolverFunc(mincostflow.Solve),
+}
+
+// MatchSolver is the name of the solver the match rounds use.
+var MatchSolver = "hungarian"
+
+// GetSolver returns the solver of the given name.
+func GetSolver(name string) (Solver, error) {
+	solver, ok := Solvers[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownSolver, name)
+	}
+	return solver, nil
+}
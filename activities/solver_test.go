@@ -0,0 +1,90 @@
+package activities
+
+import (
+	"easyRide/activities/hungarian"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestSolversConformance(t *testing.T) {
+	inf := hungarian.Infeasible
+	cases := []struct {
+		costs    [][]float64
+		expected []int
+	}{
+		{[][]float64{{0.5, 1.2, 0.3}, {0.1, 0.6, 0.4}, {0.2, 1.4, 0.5}}, []int{2, 1, 0}},
+		{[][]float64{{0.5, inf, inf}, {0.1, inf, inf}, {0.2, 1.4, 0.5}}, []int{-1, 0, 2}},
+		{[][]float64{{0.5, 1.2, 0.3}, {0.1, 0.6, 0.4}}, []int{2, 0}},
+		{[][]float64{{0.5, 1.2}, {0.1, 0.6}, {0.2, 1.4}}, []int{-1, 1, 0}},
+		{[][]float64{{inf, inf}, {inf, inf}}, []int{-1, -1}},
+		{[][]float64{{0}}, []int{0}},
+	}
+	for name, solver := range Solvers {
+		for _, c := range cases {
+			res, err := solver.Solve(c.costs)
+			assert.NoError(t, err, name)
+			assert.Equal(t, c.expected, res, "%s %v", name, c.costs)
+		}
+		for _, costs := range [][][]float64{{}, {{0.5, math.NaN()}}, {{0.5, -1}}, {{0.5, 1.2}, {0.1}}} {
+			_, err := solver.Solve(costs)
+			assert.Error(t, err, "%s %v", name, costs)
+		}
+	}
+}
+
+func TestSolversAgainstBruteForce(t *testing.T) {
+	r := rand.New(rand.NewSource(41))
+	for it := 0; it < 300; it++ {
+		rows, cols := r.Intn(6)+1, r.Intn(6)+1
+		costs := make([][]float64, rows)
+		for i := range costs {
+			costs[i] = make([]float64, cols)
+			for j := range costs[i] {
+				costs[i][j] = float64(r.Intn(100)) / 10
+				if r.Intn(4) == 0 {
+					costs[i][j] = hungarian.Infeasible
+				}
+			}
+		}
+		bestCount, bestCost := bruteForce(costs, 0, make([]bool, cols))
+		// warm solvers start from random prices and a random seed
+		prices := make([]float64, cols)
+		seed := make([]int, rows)
+		for j := range prices {
+			prices[j] = r.Float64() * 5
+		}
+		for i := range seed {
+			seed[i] = r.Intn(cols+1) - 1
+		}
+		for name, solver := range Solvers {
+			res, err := solver.Solve(costs)
+			if warm, ok := solver.(WarmSolver); ok && it%2 == 1 {
+				res, _, err = warm.SolveWarm(costs, prices, seed)
+			}
+			assert.NoError(t, err, name)
+			count, cost := 0, 0.0
+			used := make(map[int]bool)
+			for i, j := range res {
+				if j < 0 {
+					continue
+				}
+				assert.False(t, used[j] || costs[i][j] == hungarian.Infeasible, "%s %v: %v", name, costs, res)
+				used[j] = true
+				count++
+				cost += costs[i][j]
+			}
+			assert.Equal(t, bestCount, count, "%s %v: %v", name, costs, res)
+			assert.InDelta(t, bestCost, cost, 1e-6, "%s %v: %v", name, costs, res)
+		}
+	}
+}
+
+func TestGetSolver(t *testing.T) {
+	solver, err := GetSolver("auction")
+	assert.NoError(t, err)
+	assert.NotNil(t, solver)
+	_, err = GetSolver("greedy")
+	assert.ErrorIs(t, err, ErrUnknownSolver)
+}
@@ -2,33 +2,61 @@ package main
 
 import (
 	"database/sql"
+	"easyRide/config"
 	data "easyRide/db"
 	"easyRide/models"
 	"easyRide/signals"
 	"easyRide/starter"
+	"easyRide/temporalclient"
+	"easyRide/workflows"
 	"encoding/json"
+	"flag"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
+	"go.temporal.io/api/serviceerror"
 	"golang.org/x/crypto/bcrypt"
 	"log"
 	"math"
 	"net/http"
+	"os"
 	"strconv"
+	"time"
 )
 
-var db data.Database
+var (
+	db  data.Database
+	cfg config.Config
+)
 
 func main() {
-	router := mux.NewRouter()
-
 	var err error
+	cfg, err = config.Load(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		log.Fatalln("Invalid configuration", err)
+	}
+	data.Configure(cfg.Database)
+	temporalclient.Configure(cfg.Temporal.Options())
+	starter.Configure(cfg.TaskQueues)
+
+	router := mux.NewRouter()
 	db, err = data.Initialize()
 	if err != nil {
 		panic(err)
 	}
+	// one Temporal client shared by all the handlers
+	if _, err := temporalclient.Shared(); err != nil {
+		log.Fatalln("Unable to create Temporal client", err)
+	}
+	defer temporalclient.Close()
 
 	router.HandleFunc("/about", GetAbout)
 	router.HandleFunc("/start-engine", Start)
+	// matching engine administration
+	router.HandleFunc("/admin/match/pause", PauseMatchHandler).Methods(http.MethodPost)
+	router.HandleFunc("/admin/match/resume", ResumeMatchHandler).Methods(http.MethodPost)
+	router.HandleFunc("/admin/match/cadence", MatchCadenceHandler).Methods(http.MethodPost)
+	router.HandleFunc("/admin/match/run", RunMatchHandler).Methods(http.MethodPost)
+	router.HandleFunc("/admin/match/status", MatchStatusHandler).Methods(http.MethodGet)
 	// User sign up
 	router.HandleFunc("/passenger/signup", PassengerSignUpHandler)
 	router.HandleFunc("/driver/signup", DriverSignUpHandler)
@@ -39,8 +67,23 @@ func main() {
 
 	// passenger request a trip
 	router.HandleFunc("/passenger/start-trip", StartTripHandler)
+	router.HandleFunc("/passenger/status", TripStatusHandler)
+	router.HandleFunc("/passenger/schedule-trip", ScheduleTripHandler).Methods(http.MethodPost)
+	router.HandleFunc("/passenger/scheduled-trip", ScheduledTripHandler).Methods(http.MethodGet)
+	router.HandleFunc("/passenger/scheduled-trip/reschedule", RescheduleTripHandler).Methods(http.MethodPost)
+	router.HandleFunc("/passenger/scheduled-trip/cancel", CancelScheduledTripHandler).Methods(http.MethodPost)
+	router.HandleFunc("/passenger/notifications", NotificationsHandler)
 	// driver start serving passenger
+	router.HandleFunc("/driver/vehicle", VehicleHandler).Methods(http.MethodPost)
+	router.HandleFunc("/driver/preferences", DriverPreferencesHandler).Methods(http.MethodPost)
+	router.HandleFunc("/passenger/block-driver", BlockDriverHandler).Methods(http.MethodPost)
+	router.HandleFunc("/passenger/unblock-driver", UnblockDriverHandler).Methods(http.MethodPost)
 	router.HandleFunc("/driver/start-work", StartWorkHandler)
+	router.HandleFunc("/driver/location", DriverLocationHandler)
+	router.HandleFunc("/driver/confirm-trip", ConfirmTripHandler)
+	router.HandleFunc("/driver/arrived-pickup", ArrivedPickupHandler)
+	router.HandleFunc("/driver/start-trip", PickedUpHandler)
+	router.HandleFunc("/driver/arrived", DropOffHandler)
 
 	// After trip, rate and pay
 	router.HandleFunc("/passenger/payment/{pay}", PaymentHandler)
@@ -51,15 +94,103 @@ func main() {
 	router.HandleFunc("/passenger/end-trip", EndTripHandler)
 	//router.HandleFunc("/match-true/{workflow}", sendMatchTrue)
 	// more features
-	//router.HandleFunc("/driver/confirm-trip/{confirm}", ConfirmTripHandler)
 	//router.HandleFunc("/passenger/report-danger", DangerHandler)
 	//router.HandleFunc("/passenger/cancel", CancelHandler)
 	//router.HandleFunc("/passenger/change-destination", DestinationChangeHandler)
-	log.Fatal(http.ListenAndServe(":3310", router))
+	log.Fatal(http.ListenAndServe(cfg.Listen, router))
 }
 
+// Start starts the matching engine: the event-driven matcher and the cron as a fallback.
+// Starting it again has no effect.
 func Start(writer http.ResponseWriter, request *http.Request) {
-	starter.StartMatchWorkflow()
+	if err := starter.StartMatchDispatcher(workflows.DefaultDispatchOptions); err != nil {
+		writer.WriteHeader(http.StatusInternalServerError)
+		writer.Write([]byte(err.Error()))
+		return
+	}
+	if err := starter.StartMatchWorkflow(cfg.MatchInterval); err != nil {
+		writer.WriteHeader(http.StatusInternalServerError)
+		writer.Write([]byte(err.Error()))
+		return
+	}
+}
+
+// Match engine administration
+
+func PauseMatchHandler(writer http.ResponseWriter, request *http.Request) {
+	if err := starter.PauseMatchWorkflow(); err != nil {
+		writer.WriteHeader(http.StatusInternalServerError)
+		writer.Write([]byte(err.Error()))
+		return
+	}
+}
+
+func ResumeMatchHandler(writer http.ResponseWriter, request *http.Request) {
+	if err := starter.ResumeMatchWorkflow(cfg.MatchInterval); err != nil {
+		writer.WriteHeader(http.StatusInternalServerError)
+		writer.Write([]byte(err.Error()))
+		return
+	}
+}
+
+// MatchCadenceHandler changes the interval of the matching cron, e.g. {"interval": "45s"}.
+func MatchCadenceHandler(writer http.ResponseWriter, request *http.Request) {
+	body := &struct {
+		Interval string `json:"interval"`
+	}{}
+	if err := json.NewDecoder(request.Body).Decode(body); err != nil {
+		writer.WriteHeader(http.StatusBadRequest)
+		writer.Write([]byte(err.Error()))
+		return
+	}
+	interval, err := time.ParseDuration(body.Interval)
+	if err != nil || interval <= 0 {
+		writer.WriteHeader(http.StatusBadRequest)
+		writer.Write([]byte("invalid interval"))
+		return
+	}
+	if err := starter.RescheduleMatchWorkflow(interval); err != nil {
+		writer.WriteHeader(http.StatusInternalServerError)
+		writer.Write([]byte(err.Error()))
+		return
+	}
+}
+
+// RunMatchHandler runs a matching round now.
+func RunMatchHandler(writer http.ResponseWriter, request *http.Request) {
+	err := starter.TriggerMatchRound()
+	switch err {
+	case nil:
+	case starter.ErrMatchRoundRunning:
+		writer.WriteHeader(http.StatusConflict)
+		writer.Write([]byte(err.Error()))
+	default:
+		writer.WriteHeader(http.StatusInternalServerError)
+		writer.Write([]byte(err.Error()))
+	}
+}
+
+// MatchStatusHandler reports whether the matching cron runs and when the last successful round happened.
+func MatchStatusHandler(writer http.ResponseWriter, request *http.Request) {
+	status, err := starter.GetMatchStatus()
+	if err != nil {
+		writer.WriteHeader(http.StatusInternalServerError)
+		writer.Write([]byte(err.Error()))
+		return
+	}
+	lastRoundAt, matched, err := db.GetLastMatchRound()
+	switch err {
+	case nil:
+		status.LastRoundAt = lastRoundAt.Format(time.RFC3339)
+		status.LastMatched = matched
+	case data.ErrNoMatch:
+	default:
+		writer.WriteHeader(http.StatusInternalServerError)
+		writer.Write([]byte(err.Error()))
+		return
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(writer).Encode(status)
 }
 
 func GetAbout(writer http.ResponseWriter, request *http.Request) {
@@ -78,7 +209,7 @@ func PassengerSignUpHandler(writer http.ResponseWriter, request *http.Request) {
 		return
 	}
 	// Hash the password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(creds.Password), 8)
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(creds.Password), cfg.BcryptCost)
 	if err != nil {
 		panic(err)
 	}
@@ -101,7 +232,7 @@ func DriverSignUpHandler(writer http.ResponseWriter, request *http.Request) {
 	}
 	// Hash the password
 	var hashedPassword []byte
-	hashedPassword, err = bcrypt.GenerateFromPassword([]byte(creds.Password), 8)
+	hashedPassword, err = bcrypt.GenerateFromPassword([]byte(creds.Password), cfg.BcryptCost)
 	if err != nil {
 		panic(err)
 	}
@@ -138,19 +269,12 @@ func PassengerLogInHandler(writer http.ResponseWriter, request *http.Request) {
 		return
 	}
 
-	// Log in successfully, start the workflow
-	workFlowUUID, err := uuid.NewUUID()
-	if err != nil {
+	// Log in successfully, start the session or attach to it, the trips run in the session
+	if err := starter.StartPassengerSession(id); err != nil {
+		writer.WriteHeader(http.StatusInternalServerError)
 		writer.Write([]byte(err.Error()))
 		return
 	}
-	// Update user workflow ID
-	err = db.UpdateWorkFlowID(id, workFlowUUID.String())
-	if err != nil {
-		writer.WriteHeader(http.StatusInternalServerError)
-	}
-
-	starter.StartMainWorkflow(workFlowUUID.String(), id)
 	writer.WriteHeader(http.StatusOK)
 }
 
@@ -163,7 +287,7 @@ func DriverLogInHandler(writer http.ResponseWriter, request *http.Request) {
 		return
 	}
 	// Get the existing entry in the database for the given username
-	storedPassword, _, err := db.GetPassword(creds.Username, "driver")
+	storedPassword, id, err := db.GetPassword(creds.Username, "driver")
 	if err != nil {
 		// If the username does not exist
 		if err == sql.ErrNoRows {
@@ -175,7 +299,16 @@ func DriverLogInHandler(writer http.ResponseWriter, request *http.Request) {
 	}
 	if err := bcrypt.CompareHashAndPassword([]byte(storedPassword), []byte(creds.Password)); err != nil {
 		writer.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	// Log in successfully, start the shift or attach to the running one
+	if err := starter.StartDriverShiftWorkflow(id); err != nil {
+		writer.WriteHeader(http.StatusInternalServerError)
+		writer.Write([]byte(err.Error()))
+		return
 	}
+	writer.WriteHeader(http.StatusOK)
 }
 
 func StartTripHandler(writer http.ResponseWriter, request *http.Request) {
@@ -187,14 +320,234 @@ func StartTripHandler(writer http.ResponseWriter, request *http.Request) {
 		writer.Write([]byte(err.Error()))
 		return
 	}
-	err = db.UpdatePassengerLoc(passenger)
+	if passenger.RideClass != "" && !models.ValidRideClass(passenger.RideClass) {
+		writer.WriteHeader(http.StatusBadRequest)
+		writer.Write([]byte("unknown ride class"))
+		return
+	}
+	// the session starts the trip, then enters the request into the matching pool
+	if err := starter.RequestTrip(*passenger); err != nil {
+		writer.WriteHeader(http.StatusInternalServerError)
+		writer.Write([]byte(err.Error()))
+		return
+	}
+}
+
+// ScheduleTripHandler books a trip for a later pickup time and returns the ID of the schedule.
+func ScheduleTripHandler(writer http.ResponseWriter, request *http.Request) {
+	body := &models.ScheduleRequestBody{}
+	if err := json.NewDecoder(request.Body).Decode(body); err != nil {
+		writer.WriteHeader(http.StatusBadRequest)
+		writer.Write([]byte(err.Error()))
+		return
+	}
+	if body.RideClass != "" && !models.ValidRideClass(body.RideClass) {
+		writer.WriteHeader(http.StatusBadRequest)
+		writer.Write([]byte("unknown ride class"))
+		return
+	}
+	trip := models.ScheduledTrip{
+		PassengerID:     body.ID,
+		PickupLoc:       body.PickupLoc,
+		DropLoc:         body.DropLoc,
+		PickupAt:        body.PickupAt,
+		RideClass:       body.RideClass,
+		NeedsAccessible: body.NeedsAccessible,
+	}
+	scheduleID, err := starter.ScheduleTrip(trip)
+	if err != nil {
+		scheduleError(writer, err)
+		return
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(writer).Encode(models.ScheduleRequestBody{ID: body.ID, ScheduleID: scheduleID,
+		PickupLoc: body.PickupLoc, DropLoc: body.DropLoc, PickupAt: body.PickupAt})
+}
+
+// ScheduledTripHandler reports a trip booked ahead.
+func ScheduledTripHandler(writer http.ResponseWriter, request *http.Request) {
+	body := &models.ScheduleRequestBody{}
+	if err := json.NewDecoder(request.Body).Decode(body); err != nil {
+		writer.WriteHeader(http.StatusBadRequest)
+		writer.Write([]byte(err.Error()))
+		return
+	}
+	trip, err := starter.GetScheduledTrip(body.ScheduleID)
 	if err != nil {
+		writer.WriteHeader(http.StatusNotFound)
+		writer.Write([]byte(err.Error()))
+		return
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(writer).Encode(trip)
+}
+
+// RescheduleTripHandler moves the pickup time of a trip booked ahead.
+func RescheduleTripHandler(writer http.ResponseWriter, request *http.Request) {
+	body := &models.ScheduleRequestBody{}
+	if err := json.NewDecoder(request.Body).Decode(body); err != nil {
+		writer.WriteHeader(http.StatusBadRequest)
+		writer.Write([]byte(err.Error()))
+		return
+	}
+	if err := starter.RescheduleTrip(body.ScheduleID, body.PickupAt); err != nil {
+		scheduleError(writer, err)
+	}
+}
+
+// CancelScheduledTripHandler cancels a trip booked ahead.
+func CancelScheduledTripHandler(writer http.ResponseWriter, request *http.Request) {
+	body := &models.ScheduleRequestBody{}
+	if err := json.NewDecoder(request.Body).Decode(body); err != nil {
+		writer.WriteHeader(http.StatusBadRequest)
+		writer.Write([]byte(err.Error()))
+		return
+	}
+	if err := starter.CancelScheduledTrip(body.ScheduleID); err != nil {
+		scheduleError(writer, err)
+	}
+}
+
+func scheduleError(writer http.ResponseWriter, err error) {
+	switch err {
+	case starter.ErrScheduleTooSoon:
+		writer.WriteHeader(http.StatusBadRequest)
+	case starter.ErrScheduleClosed:
+		writer.WriteHeader(http.StatusConflict)
+	default:
 		writer.WriteHeader(http.StatusInternalServerError)
+	}
+	writer.Write([]byte(err.Error()))
+}
+
+// TripStatusHandler reports where the passenger's trip stands.
+func TripStatusHandler(writer http.ResponseWriter, request *http.Request) {
+	passenger := &models.PassengerRequestBody{}
+	if err := json.NewDecoder(request.Body).Decode(passenger); err != nil {
+		writer.WriteHeader(http.StatusBadRequest)
 		writer.Write([]byte(err.Error()))
 		return
 	}
+	workflowID, err := db.GetWorkFlowID(passenger.ID)
+	if err != nil {
+		writer.WriteHeader(http.StatusNotFound)
+		writer.Write([]byte(err.Error()))
+		return
+	}
+	status, err := signals.QueryTripStatus(workflowID)
+	if err != nil {
+		writer.WriteHeader(http.StatusServiceUnavailable)
+		writer.Write([]byte(err.Error()))
+		return
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(writer).Encode(status)
 }
 
+// NotificationsHandler hands the passenger the messages left since the last call.
+func NotificationsHandler(writer http.ResponseWriter, request *http.Request) {
+	passenger := &models.PassengerRequestBody{}
+	if err := json.NewDecoder(request.Body).Decode(passenger); err != nil {
+		writer.WriteHeader(http.StatusBadRequest)
+		writer.Write([]byte(err.Error()))
+		return
+	}
+	notifications, err := db.GetNotifications(passenger.ID)
+	if err != nil {
+		writer.WriteHeader(http.StatusInternalServerError)
+		writer.Write([]byte(err.Error()))
+		return
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(writer).Encode(notifications)
+}
+
+// VehicleHandler registers the vehicle of a driver.
+func VehicleHandler(writer http.ResponseWriter, request *http.Request) {
+	body := &models.VehicleRequestBody{}
+	if err := json.NewDecoder(request.Body).Decode(body); err != nil {
+		writer.WriteHeader(http.StatusBadRequest)
+		writer.Write([]byte(err.Error()))
+		return
+	}
+	vehicle := &models.Vehicle{
+		DriverID:             body.ID,
+		Plate:                body.Plate,
+		Seats:                body.Seats,
+		Class:                body.Class,
+		WheelchairAccessible: body.WheelchairAccessible,
+	}
+	switch err := db.SetVehicle(vehicle); err {
+	case nil:
+	case data.ErrInvalidVehicle:
+		writer.WriteHeader(http.StatusBadRequest)
+		writer.Write([]byte(err.Error()))
+	case data.ErrDuplicatePlate:
+		writer.WriteHeader(http.StatusConflict)
+		writer.Write([]byte(err.Error()))
+	case data.ErrUnknownDriver:
+		writer.WriteHeader(http.StatusNotFound)
+		writer.Write([]byte(err.Error()))
+	default:
+		writer.WriteHeader(http.StatusInternalServerError)
+		writer.Write([]byte(err.Error()))
+	}
+}
+
+// DriverPreferencesHandler stores the constraints of a driver on the trips offered.
+func DriverPreferencesHandler(writer http.ResponseWriter, request *http.Request) {
+	body := &models.DriverPreferencesRequestBody{}
+	if err := json.NewDecoder(request.Body).Decode(body); err != nil {
+		writer.WriteHeader(http.StatusBadRequest)
+		writer.Write([]byte(err.Error()))
+		return
+	}
+	pref := &models.DriverPreferences{
+		DriverID:           body.ID,
+		HomeLoc:            body.HomeLoc,
+		MaxPickupDistance:  body.MaxPickupDistance,
+		MinPassengerRating: body.MinPassengerRating,
+	}
+	switch err := db.SetDriverPreferences(pref); err {
+	case nil:
+	case data.ErrInvalidPreferences:
+		writer.WriteHeader(http.StatusBadRequest)
+		writer.Write([]byte(err.Error()))
+	default:
+		writer.WriteHeader(http.StatusInternalServerError)
+		writer.Write([]byte(err.Error()))
+	}
+}
+
+// BlockDriverHandler keeps a driver from being matched with the passenger again.
+func BlockDriverHandler(writer http.ResponseWriter, request *http.Request) {
+	body := &models.BlockRequestBody{}
+	if err := json.NewDecoder(request.Body).Decode(body); err != nil {
+		writer.WriteHeader(http.StatusBadRequest)
+		writer.Write([]byte(err.Error()))
+		return
+	}
+	if err := db.BlockDriver(body.ID, body.DriverID); err != nil {
+		writer.WriteHeader(http.StatusInternalServerError)
+		writer.Write([]byte(err.Error()))
+	}
+}
+
+// UnblockDriverHandler lifts the block of a driver by the passenger.
+func UnblockDriverHandler(writer http.ResponseWriter, request *http.Request) {
+	body := &models.BlockRequestBody{}
+	if err := json.NewDecoder(request.Body).Decode(body); err != nil {
+		writer.WriteHeader(http.StatusBadRequest)
+		writer.Write([]byte(err.Error()))
+		return
+	}
+	if err := db.UnblockDriver(body.ID, body.DriverID); err != nil {
+		writer.WriteHeader(http.StatusInternalServerError)
+		writer.Write([]byte(err.Error()))
+	}
+}
+
+// StartWorkHandler is used by drivers to get online, the shift decides whether they can.
 func StartWorkHandler(writer http.ResponseWriter, request *http.Request) {
 	driver := &models.DriverRequestBody{}
 	// Decode the request body into a new Credential struct
@@ -204,21 +557,102 @@ func StartWorkHandler(writer http.ResponseWriter, request *http.Request) {
 		writer.Write([]byte(err.Error()))
 		return
 	}
+	change := models.DriverStateChange{State: models.DriverAvailable, Loc: driver.Loc}
+	sendDriverSignal(writer, driver.ID, signals.SIGNAL_DRIVER_STATE, change)
+}
 
-	err = db.UpdateDriverLoc(driver.ID, driver.Loc)
-	if err != nil {
-		writer.WriteHeader(http.StatusInternalServerError)
+// DriverLocationHandler is used by drivers to report their location.
+func DriverLocationHandler(writer http.ResponseWriter, request *http.Request) {
+	driver := &models.DriverRequestBody{}
+	if err := json.NewDecoder(request.Body).Decode(driver); err != nil {
+		writer.WriteHeader(http.StatusBadRequest)
 		writer.Write([]byte(err.Error()))
 		return
 	}
-	err = db.UpdateDriverStatus(driver.ID, &models.Passenger{}, true)
-	if err != nil {
+	sendDriverSignal(writer, driver.ID, signals.SIGNAL_DRIVER_LOCATION, driver.Loc)
+}
+
+// ConfirmTripHandler is used by drivers to accept the offered trip and head to the pickup location.
+func ConfirmTripHandler(writer http.ResponseWriter, request *http.Request) {
+	driver := &models.DriverRequestBody{}
+	if err := json.NewDecoder(request.Body).Decode(driver); err != nil {
+		writer.WriteHeader(http.StatusBadRequest)
+		writer.Write([]byte(err.Error()))
+		return
+	}
+	change := models.DriverStateChange{State: models.DriverEnRoute}
+	sendDriverSignal(writer, driver.ID, signals.SIGNAL_DRIVER_STATE, change)
+}
+
+// ArrivedPickupHandler is used by drivers to report they are waiting at the pickup location.
+func ArrivedPickupHandler(writer http.ResponseWriter, request *http.Request) {
+	signalPassengerTrip(writer, request, signals.SIGNAL_DRIVER_ARRIVED_PICKUP, models.StopPickup)
+}
+
+// PickedUpHandler is used by drivers to report the passenger is on board and the trip starts.
+func PickedUpHandler(writer http.ResponseWriter, request *http.Request) {
+	signalPassengerTrip(writer, request, signals.SIGNAL_PASSENGER_PICKED_UP, models.StopPickup)
+}
+
+// DropOffHandler is used by drivers to report the passenger has arrived at the destination.
+func DropOffHandler(writer http.ResponseWriter, request *http.Request) {
+	signalPassengerTrip(writer, request, signals.SIGNAL_DRIVER_ARRIVED, models.StopDrop)
+}
+
+// signalPassengerTrip forwards the driver's report to the trip workflow of the passenger at the stop reported.
+// A driver carrying pooled riders reports the next stop of the route, which belongs to one of the riders.
+func signalPassengerTrip(writer http.ResponseWriter, request *http.Request, signalName string, kind models.StopKind) {
+	driver := &models.DriverRequestBody{}
+	if err := json.NewDecoder(request.Body).Decode(driver); err != nil {
+		writer.WriteHeader(http.StatusBadRequest)
+		writer.Write([]byte(err.Error()))
+		return
+	}
+	var workflowID string
+	stop, err := db.GetNextStop(driver.ID)
+	switch {
+	case err == nil:
+		if stop.Kind != kind {
+			writer.WriteHeader(http.StatusConflict)
+			writer.Write([]byte("the next stop of the route is a " + string(stop.Kind)))
+			return
+		}
+		workflowID = stop.TripID
+	case err != data.ErrNoMatch:
 		writer.WriteHeader(http.StatusInternalServerError)
+		return
+	default:
+		passengerID, err := db.GetMatchedPassenger(driver.ID)
+		if err != nil {
+			writer.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if passengerID <= 0 {
+			writer.WriteHeader(http.StatusBadRequest)
+			writer.Write([]byte("no passenger matched"))
+			return
+		}
+		if workflowID, err = db.GetWorkFlowID(passengerID); err != nil {
+			writer.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := signals.SendTripSignal(workflowID, signalName, nil); err != nil {
+		writer.WriteHeader(http.StatusConflict)
 		writer.Write([]byte(err.Error()))
 		return
 	}
 }
 
+// sendDriverSignal forwards the driver's request to the shift workflow.
+func sendDriverSignal(writer http.ResponseWriter, driverID int, signalName string, arg interface{}) {
+	if err := signals.SendDriverSignal(driverID, signalName, arg); err != nil {
+		writer.WriteHeader(http.StatusConflict)
+		writer.Write([]byte("no shift running, please log in first"))
+		return
+	}
+}
+
 func PaymentHandler(writer http.ResponseWriter, request *http.Request) {
 	passenger := &models.PassengerRequestBody{}
 	if err := json.NewDecoder(request.Body).Decode(passenger); err != nil {
@@ -235,35 +669,59 @@ func PaymentHandler(writer http.ResponseWriter, request *http.Request) {
 	vars := mux.Vars(request)
 	actualPay, _ := strconv.ParseFloat(vars["pay"], 64)
 	expectedPay := math.Abs(float64(passenger.PickupLoc - passenger.DropLoc))
-	if actualPay < expectedPay {
-		signals.SendPaymentSignal(workflowID, false)
+	// the fare depends on the ride class, a pooled rider pays a share of the route
+	if fare, ok, err := db.GetTripFare(workflowID); err == nil && ok {
+		expectedPay = fare
+	}
+	result := models.PaymentResult{Paid: actualPay >= expectedPay, Amount: actualPay, Expected: expectedPay}
+	if err := signals.SendPaymentSignal(workflowID, result); err != nil {
+		writer.WriteHeader(http.StatusServiceUnavailable)
+		writer.Write([]byte(err.Error()))
 		return
 	}
-	signals.SendPaymentSignal(workflowID, true)
 }
 
+// PassengerRatingHandler is for passengers to rate their drivers, with optional feedback and tags.
 func PassengerRatingHandler(writer http.ResponseWriter, request *http.Request) {
 	vars := mux.Vars(request)
 	if vars["rating"] == "" {
 		return
 	}
-	passenger := &models.PassengerRequestBody{}
+	passenger := &models.RatingRequestBody{}
 	if err := json.NewDecoder(request.Body).Decode(passenger); err != nil {
 		writer.WriteHeader(http.StatusBadRequest)
 		writer.Write([]byte(err.Error()))
 		return
 	}
-	rating, _ := strconv.ParseFloat(vars["rating"], 64)
+	rating, err := strconv.ParseFloat(vars["rating"], 64)
+	if err != nil || !models.ValidRating(rating) {
+		writer.WriteHeader(http.StatusBadRequest)
+		writer.Write([]byte(data.ErrInvalidRating.Error()))
+		return
+	}
 	driverID, err := db.GetMatchedDriver(passenger.ID)
 	if err != nil {
 		writer.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	err = db.UpdateDriverRating(driverID, rating)
+	if driverID <= 0 {
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	tripID, err := db.GetWorkFlowID(passenger.ID)
 	if err != nil {
 		writer.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	sendRating(writer, signals.SIGNAL_RATE_DRIVER, &models.Rating{
+		TripID:      tripID,
+		Rater:       models.RaterPassenger,
+		PassengerID: passenger.ID,
+		DriverID:    driverID,
+		Score:       rating,
+		Feedback:    passenger.Feedback,
+		Tags:        passenger.Tags,
+	})
 }
 
 // DriverRatingHandler is for drivers to rate their passengers.
@@ -273,27 +731,105 @@ func DriverRatingHandler(writer http.ResponseWriter, request *http.Request) {
 	if vars["rating"] == "" {
 		return
 	}
-	driver := &models.DriverRequestBody{}
+	driver := &models.RatingRequestBody{}
 	if err := json.NewDecoder(request.Body).Decode(driver); err != nil {
 		writer.WriteHeader(http.StatusBadRequest)
 		writer.Write([]byte(err.Error()))
 		return
 	}
-	rating, _ := strconv.ParseFloat(vars["rating"], 64)
+	rating, err := strconv.ParseFloat(vars["rating"], 64)
+	if err != nil || !models.ValidRating(rating) {
+		writer.WriteHeader(http.StatusBadRequest)
+		writer.Write([]byte(data.ErrInvalidRating.Error()))
+		return
+	}
 	passengerID, err := db.GetMatchedPassenger(driver.ID)
 	if err != nil {
 		writer.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 	// Driver don't response to the rating popup window, miss the chance to rate the passenger.
-	if passengerID == 0 {
+	if passengerID <= 0 {
 		return
 	}
-	err = db.UpdatePassengerRating(passengerID, rating)
+	tripID, err := db.GetWorkFlowID(passengerID)
 	if err != nil {
 		writer.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	sendRating(writer, signals.SIGNAL_RATE_PASSENGER, &models.Rating{
+		TripID:      tripID,
+		Rater:       models.RaterDriver,
+		PassengerID: passengerID,
+		DriverID:    driver.ID,
+		Score:       rating,
+		Feedback:    driver.Feedback,
+		Tags:        driver.Tags,
+	})
+}
+
+// The trip replies to each rating signal, the reply is polled for at most ratingReplyTimeout.
+var (
+	ratingReplyTimeout      = 5 * time.Second
+	ratingReplyPollInterval = 100 * time.Millisecond
+)
+
+// sendRating hands the rating over to the trip workflow, which only accepts it within the rating window, and answers
+// with the reply of the trip. A rater who already rated the trip gets a 409, as does a rater not asked to rate yet,
+// a rater whose window is over gets a 410.
+func sendRating(writer http.ResponseWriter, signalName string, rating *models.Rating) {
+	rating.RequestID = uuid.NewString()
+	if err := signals.SendRatingSignal(rating.TripID, signalName, *rating); err != nil {
+		ratingError(writer, err)
+		return
+	}
+	reply, err := awaitRatingReply(rating)
+	if err != nil {
+		ratingError(writer, err)
+		return
+	}
+	switch reply {
+	case models.RatingAccepted:
+		return
+	case models.RatingDuplicate:
+		writer.WriteHeader(http.StatusConflict)
+		writer.Write([]byte(data.ErrDuplicateRating.Error()))
+	case models.RatingEarly:
+		writer.WriteHeader(http.StatusConflict)
+		writer.Write([]byte(data.ErrRatingNotOpen.Error()))
+	case models.RatingInvalid:
+		writer.WriteHeader(http.StatusBadRequest)
+		writer.Write([]byte(data.ErrInvalidRating.Error()))
+	case models.RatingLate:
+		writer.WriteHeader(http.StatusGone)
+		writer.Write([]byte(data.ErrRatingClosed.Error()))
+	default:
+		writer.WriteHeader(http.StatusServiceUnavailable)
+		writer.Write([]byte(data.ErrRatingPending.Error()))
+	}
+}
+
+// awaitRatingReply polls the trip for its reply to the rating, the reply is pending when the trip took too long.
+func awaitRatingReply(rating *models.Rating) (models.RatingReply, error) {
+	deadline := time.Now().Add(ratingReplyTimeout)
+	for {
+		reply, err := signals.QueryRatingReply(rating.TripID, rating.Rater, rating.RequestID)
+		if err != nil || reply != models.RatingPending || !time.Now().Before(deadline) {
+			return reply, err
+		}
+		time.Sleep(ratingReplyPollInterval)
+	}
+}
+
+// ratingError reports a trip workflow that could not be reached with a rating, a trip gone from the server is over.
+func ratingError(writer http.ResponseWriter, err error) {
+	if _, ok := err.(*serviceerror.NotFound); ok {
+		writer.WriteHeader(http.StatusGone)
+		writer.Write([]byte(data.ErrRatingClosed.Error()))
+		return
+	}
+	writer.WriteHeader(http.StatusServiceUnavailable)
+	writer.Write([]byte(err.Error()))
 }
 
 // EndWorkHandler is used by drivers to get offline.
@@ -304,12 +840,7 @@ func EndWorkHandler(writer http.ResponseWriter, request *http.Request) {
 		writer.Write([]byte(err.Error()))
 		return
 	}
-	err := db.SetDriverOffline(driver.ID)
-	if err != nil {
-		writer.WriteHeader(http.StatusBadRequest)
-		writer.Write([]byte(err.Error()))
-		return
-	}
+	sendDriverSignal(writer, driver.ID, signals.SIGNAL_DRIVER_GO_OFFLINE, nil)
 }
 
 func EndTripHandler(writer http.ResponseWriter, request *http.Request) {
@@ -0,0 +1,438 @@
+// Package config loads the settings shared by the client API and the workers. Each setting has a default, and can be
+// set in a JSON file keyed by the flag names, in the environment, and with a flag, each overriding the one before.
+package config
+
+import (
+	"easyRide/temporalclient"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/joho/godotenv"
+	"golang.org/x/crypto/bcrypt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// ErrInvalid is returned along with the settings that are out of range.
+var ErrInvalid = fmt.Errorf("invalid configuration")
+
+// Config holds the settings of the binaries.
+type Config struct {
+	// Listen is the address the client API is served on.
+	Listen string
+	// BcryptCost is the cost of the password hashes, raising it slows down the sign ups and logins.
+	BcryptCost int
+	// MatchInterval is the cadence of the matching cron.
+	MatchInterval time.Duration
+	Database      Database
+	Temporal      Temporal
+	TaskQueues    TaskQueues
+	Timeouts      Timeouts
+
+	// sources tell where each setting was set, keyed by the setting name
+	sources map[string]string
+}
+
+// Database is the connection to PostgreSQL.
+type Database struct {
+	Host     string
+	Port     int
+	User     string
+	Password string
+	Name     string
+	SSLMode  string
+}
+
+// DSN is the connection string of the database.
+func (d Database) DSN() string {
+	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		quote(d.Host), d.Port, quote(d.User), quote(d.Password), quote(d.Name), quote(d.SSLMode))
+}
+
+// quote quotes a value of the connection string, which may be empty or hold spaces.
+func quote(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	return "'" + strings.ReplaceAll(value, "'", `\'`) + "'"
+}
+
+// Temporal is the connection to the Temporal server.
+type Temporal struct {
+	HostPort      string
+	Namespace     string
+	TLSCertPath   string
+	TLSKeyPath    string
+	TLSCAPath     string
+	TLSServerName string
+}
+
+// Options are the options of the Temporal client.
+func (t Temporal) Options() temporalclient.Options {
+	return temporalclient.Options{
+		HostPort:      t.HostPort,
+		Namespace:     t.Namespace,
+		TLSCertPath:   t.TLSCertPath,
+		TLSKeyPath:    t.TLSKeyPath,
+		TLSCAPath:     t.TLSCAPath,
+		TLSServerName: t.TLSServerName,
+	}
+}
+
+// TaskQueues are the task queues the workers poll, and the workflows are started on.
+type TaskQueues struct {
+	// Main runs the trips, the passenger sessions and the driver shifts
+	Main string
+	// Matching runs the matching cron and the dispatcher
+	Matching string
+}
+
+// Timeouts of the workflows, the main worker runs the workflows with them.
+type Timeouts struct {
+	Match         time.Duration
+	EnRoute       time.Duration
+	NoShow        time.Duration
+	Rating        time.Duration
+	SessionIdle   time.Duration
+	MaxTrip       time.Duration
+	TripHeartbeat time.Duration
+}
+
+// Default returns the settings used when nothing else is set, for a local setup of engine/docker-compose.yml.
+func Default() Config {
+	return Config{
+		Listen:        ":3310",
+		BcryptCost:    8,
+		MatchInterval: 30 * time.Second,
+		Database: Database{
+			Host:    "localhost",
+			Port:    5432,
+			User:    "temporal",
+			Name:    "postgres",
+			SSLMode: "disable",
+		},
+		Temporal: Temporal{
+			HostPort:  "localhost:7233",
+			Namespace: "default",
+		},
+		TaskQueues: TaskQueues{
+			Main:     "worker-group-1",
+			Matching: "matching",
+		},
+		Timeouts: Timeouts{
+			Match:         10 * time.Minute,
+			EnRoute:       30 * time.Minute,
+			NoShow:        5 * time.Minute,
+			Rating:        15 * time.Second,
+			SessionIdle:   24 * time.Hour,
+			MaxTrip:       2 * time.Hour,
+			TripHeartbeat: 30 * time.Second,
+		},
+	}
+}
+
+// setting is a setting of Config, with the name of its flag and file key and its environment variable.
+type setting struct {
+	name  string
+	env   string
+	usage string
+	field func(c *Config) interface{}
+	// secret settings are masked when printed
+	secret bool
+}
+
+// settings are the settings of Config, the environment variables of the database are the ones of the .env file.
+var settings = []setting{
+	{name: "listen", env: "LISTEN_ADDR", usage: "address the client API is served on",
+		field: func(c *Config) interface{} { return &c.Listen }},
+	{name: "bcrypt-cost", env: "BCRYPT_COST", usage: "cost of the password hashes",
+		field: func(c *Config) interface{} { return &c.BcryptCost }},
+	{name: "match-interval", env: "MATCH_INTERVAL", usage: "cadence of the matching cron",
+		field: func(c *Config) interface{} { return &c.MatchInterval }},
+	{name: "db-host", env: "HOST", usage: "host of the database",
+		field: func(c *Config) interface{} { return &c.Database.Host }},
+	{name: "db-port", env: "PORT", usage: "port of the database",
+		field: func(c *Config) interface{} { return &c.Database.Port }},
+	{name: "db-user", env: "USR", usage: "user of the database",
+		field: func(c *Config) interface{} { return &c.Database.User }},
+	{name: "db-password", env: "PASS", usage: "password of the database user", secret: true,
+		field: func(c *Config) interface{} { return &c.Database.Password }},
+	{name: "db-name", env: "DB", usage: "name of the database",
+		field: func(c *Config) interface{} { return &c.Database.Name }},
+	{name: "db-sslmode", env: "DB_SSLMODE", usage: "SSL mode of the database connection",
+		field: func(c *Config) interface{} { return &c.Database.SSLMode }},
+	{name: "temporal-host-port", env: "TEMPORAL_HOST_PORT", usage: "address of the Temporal server",
+		field: func(c *Config) interface{} { return &c.Temporal.HostPort }},
+	{name: "temporal-namespace", env: "TEMPORAL_NAMESPACE", usage: "Temporal namespace of the workflows",
+		field: func(c *Config) interface{} { return &c.Temporal.Namespace }},
+	{name: "temporal-tls-cert", env: "TEMPORAL_TLS_CERT", usage: "client certificate for the Temporal server",
+		field: func(c *Config) interface{} { return &c.Temporal.TLSCertPath }},
+	{name: "temporal-tls-key", env: "TEMPORAL_TLS_KEY", usage: "key of the client certificate",
+		field: func(c *Config) interface{} { return &c.Temporal.TLSKeyPath }},
+	{name: "temporal-tls-ca", env: "TEMPORAL_TLS_CA", usage: "CA certificate of the Temporal server",
+		field: func(c *Config) interface{} { return &c.Temporal.TLSCAPath }},
+	{name: "temporal-tls-server-name", env: "TEMPORAL_TLS_SERVER_NAME", usage: "server name of the Temporal server",
+		field: func(c *Config) interface{} { return &c.Temporal.TLSServerName }},
+	{name: "task-queue", env: "TASK_QUEUE", usage: "task queue of the trips, sessions and shifts",
+		field: func(c *Config) interface{} { return &c.TaskQueues.Main }},
+	{name: "match-task-queue", env: "MATCH_TASK_QUEUE", usage: "task queue of the matching",
+		field: func(c *Config) interface{} { return &c.TaskQueues.Matching }},
+	{name: "match-timeout", env: "MATCH_TIMEOUT", usage: "time to find a driver before a trip request is cancelled",
+		field: func(c *Config) interface{} { return &c.Timeouts.Match }},
+	{name: "en-route-timeout", env: "EN_ROUTE_TIMEOUT", usage: "time to reach the pickup before the trip is given up",
+		field: func(c *Config) interface{} { return &c.Timeouts.EnRoute }},
+	{name: "no-show-timeout", env: "NO_SHOW_TIMEOUT", usage: "wait of the driver at the pickup before a no-show",
+		field: func(c *Config) interface{} { return &c.Timeouts.NoShow }},
+	{name: "rating-window", env: "RATING_WINDOW", usage: "time to rate a trip once asked to",
+		field: func(c *Config) interface{} { return &c.Timeouts.Rating }},
+	{name: "session-idle-timeout", env: "SESSION_IDLE_TIMEOUT", usage: "idle time before a passenger session ends",
+		field: func(c *Config) interface{} { return &c.Timeouts.SessionIdle }},
+	{name: "max-trip-duration", env: "MAX_TRIP_DURATION", usage: "bound of a single attempt of the trip progress",
+		field: func(c *Config) interface{} { return &c.Timeouts.MaxTrip }},
+	{name: "trip-heartbeat-timeout", env: "TRIP_HEARTBEAT_TIMEOUT",
+		usage: "silence of the trip progress before it is retried",
+		field: func(c *Config) interface{} { return &c.Timeouts.TripHeartbeat }},
+}
+
+// Sources of a setting.
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+// DefaultEnvFile is the file of environment variables loaded when neither -env-file nor $ENV_FILE is set, the one the
+// commands read the database credentials from before the settings could be given in other ways. It is relative to
+// the working directory, and skipped when missing.
+const DefaultEnvFile = "../.env"
+
+// envOr is the value of the environment variable, or the fallback when it is not set.
+func envOr(name string, fallback string) string {
+	if value, ok := os.LookupEnv(name); ok {
+		return value
+	}
+	return fallback
+}
+
+// Load registers the settings as flags on fs, parses args and returns the settings. The JSON file of -config and the
+// environment variables of -env-file are read first, the variables already set in the environment are kept.
+// The settings are returned along with ErrInvalid when some are out of range.
+func Load(fs *flag.FlagSet, args []string) (Config, error) {
+	file := fs.String("config", os.Getenv("CONFIG_FILE"), "JSON file of the settings, keyed by the flag names, $CONFIG_FILE")
+	envFile := fs.String("env-file", envOr("ENV_FILE", DefaultEnvFile), "file of environment variables to load, $ENV_FILE")
+	defaults := Default()
+	flagged := make(map[string]string)
+	for _, s := range settings {
+		s := s
+		usage := fmt.Sprintf("%s, $%s (default %q)", s.usage, s.env, format(s.field(&defaults)))
+		fs.Func(s.name, usage, func(value string) error {
+			// checked now for the flag package to report it
+			var scratch Config
+			if err := parse(s.field(&scratch), value); err != nil {
+				return err
+			}
+			flagged[s.name] = value
+			return nil
+		})
+	}
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	c := Default()
+	c.sources = make(map[string]string)
+	if *envFile != "" {
+		err := godotenv.Load(*envFile)
+		// the default file is optional, the variables may be set in the environment instead
+		if err != nil && !(*envFile == DefaultEnvFile && errors.Is(err, os.ErrNotExist)) {
+			return c, fmt.Errorf("cannot load %s: %w", *envFile, err)
+		}
+	}
+	if *file != "" {
+		if err := c.loadFile(*file); err != nil {
+			return c, err
+		}
+	}
+	for _, s := range settings {
+		// an empty variable is unset
+		if value := os.Getenv(s.env); value != "" {
+			if err := c.set(s, value, SourceEnv); err != nil {
+				return c, fmt.Errorf("$%s: %w", s.env, err)
+			}
+		}
+	}
+	for _, s := range settings {
+		if value, ok := flagged[s.name]; ok {
+			if err := c.set(s, value, SourceFlag); err != nil {
+				return c, err
+			}
+		}
+	}
+	return c, c.Validate()
+}
+
+// loadFile reads the settings of a JSON file, e.g. {"db-host": "db", "db-port": 5432, "match-interval": "45s"}.
+func (c *Config) loadFile(file string) error {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(content, &values); err != nil {
+		return fmt.Errorf("cannot read %s: %w", file, err)
+	}
+	for name, raw := range values {
+		s, ok := lookup(name)
+		if !ok {
+			return fmt.Errorf("unknown setting %q in %s", name, file)
+		}
+		// strings are given quoted, numbers as they are
+		value := string(raw)
+		var str string
+		if json.Unmarshal(raw, &str) == nil {
+			value = str
+		}
+		if err := c.set(s, value, SourceFile); err != nil {
+			return fmt.Errorf("%s in %s: %w", name, file, err)
+		}
+	}
+	return nil
+}
+
+// set parses the value of the setting and records where it was set.
+func (c *Config) set(s setting, value string, source string) error {
+	if err := parse(s.field(c), value); err != nil {
+		return err
+	}
+	if c.sources == nil {
+		c.sources = make(map[string]string)
+	}
+	c.sources[s.name] = source
+	return nil
+}
+
+// Validate checks the settings are in range.
+func (c Config) Validate() error {
+	var problems []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+	check(c.Listen != "", "listen is required")
+	check(c.BcryptCost >= bcrypt.MinCost && c.BcryptCost <= bcrypt.MaxCost,
+		"bcrypt-cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	check(c.MatchInterval >= time.Second, "match-interval must be at least a second")
+
+	check(c.Database.Host != "", "db-host is required")
+	check(c.Database.Port > 0 && c.Database.Port < 1<<16, "db-port must be between 1 and 65535")
+	check(c.Database.User != "", "db-user is required")
+	check(c.Database.Name != "", "db-name is required")
+	switch c.Database.SSLMode {
+	case "disable", "require", "verify-ca", "verify-full":
+	default:
+		check(false, "db-sslmode must be one of disable, require, verify-ca and verify-full")
+	}
+
+	check(c.Temporal.HostPort != "", "temporal-host-port is required")
+	check(c.Temporal.Namespace != "", "temporal-namespace is required")
+	check((c.Temporal.TLSCertPath == "") == (c.Temporal.TLSKeyPath == ""),
+		"temporal-tls-cert and temporal-tls-key go together")
+
+	check(c.TaskQueues.Main != "", "task-queue is required")
+	check(c.TaskQueues.Matching != "", "match-task-queue is required")
+	check(c.TaskQueues.Main != c.TaskQueues.Matching, "task-queue and match-task-queue must differ")
+
+	timeouts := c.Timeouts
+	for _, t := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"match-timeout", timeouts.Match},
+		{"en-route-timeout", timeouts.EnRoute},
+		{"no-show-timeout", timeouts.NoShow},
+		{"rating-window", timeouts.Rating},
+		{"session-idle-timeout", timeouts.SessionIdle},
+		{"max-trip-duration", timeouts.MaxTrip},
+		{"trip-heartbeat-timeout", timeouts.TripHeartbeat},
+	} {
+		check(t.value > 0, "%s must be positive", t.name)
+	}
+	check(timeouts.TripHeartbeat < timeouts.MaxTrip, "trip-heartbeat-timeout must be shorter than max-trip-duration")
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalid, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Print writes each setting with its value and where it was set, the secrets are masked.
+func (c Config) Print(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "SETTING\tVALUE\tSOURCE")
+	for _, s := range settings {
+		value := format(s.field(&c))
+		if s.secret && value != "" {
+			value = "********"
+		}
+		source := SourceDefault
+		if src, ok := c.sources[s.name]; ok {
+			source = src
+		}
+		if source == SourceEnv {
+			source += " $" + s.env
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", s.name, value, source)
+	}
+	return tw.Flush()
+}
+
+// lookup finds the setting of the name.
+func lookup(name string) (setting, bool) {
+	for _, s := range settings {
+		if s.name == name {
+			return s, true
+		}
+	}
+	return setting{}, false
+}
+
+// parse sets the field the pointer points to from its text.
+func parse(field interface{}, value string) error {
+	switch p := field.(type) {
+	case *string:
+		*p = value
+	case *int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", value)
+		}
+		*p = n
+	case *time.Duration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", value)
+		}
+		*p = d
+	default:
+		panic(fmt.Sprintf("config: unsupported setting type %T", field))
+	}
+	return nil
+}
+
+// format is the text of the field the pointer points to.
+func format(field interface{}) string {
+	switch p := field.(type) {
+	case *string:
+		return *p
+	case *int:
+		return strconv.Itoa(*p)
+	case *time.Duration:
+		return p.String()
+	}
+	panic(fmt.Sprintf("config: unsupported setting type %T", field))
+}
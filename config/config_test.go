@@ -0,0 +1,144 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// unsetEnv unsets the variables of the settings for the test, they are set back once it is over.
+func unsetEnv(t *testing.T) {
+	for _, name := range append([]string{"CONFIG_FILE", "ENV_FILE"}, envNames()...) {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+}
+
+func envNames() []string {
+	var names []string
+	for _, s := range settings {
+		names = append(names, s.env)
+	}
+	return names
+}
+
+// load loads the settings from args alone, whatever the environment of the test and the default env file.
+func load(t *testing.T, args ...string) (Config, error) {
+	unsetEnv(t)
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(&bytes.Buffer{})
+	return Load(fs, append([]string{"-env-file", ""}, args...))
+}
+
+func writeFile(t *testing.T, name string, content string) string {
+	file := filepath.Join(t.TempDir(), name)
+	assert.NoError(t, os.WriteFile(file, []byte(content), 0600))
+	return file
+}
+
+func TestLoadDefaults(t *testing.T) {
+	c, err := load(t)
+	assert.NoError(t, err)
+	assert.Equal(t, ":3310", c.Listen)
+	assert.Equal(t, TaskQueues{Main: "worker-group-1", Matching: "matching"}, c.TaskQueues)
+	assert.Equal(t, 8, c.BcryptCost)
+	assert.Equal(t, 30*time.Second, c.MatchInterval)
+	assert.Equal(t, Default().Database, c.Database)
+	assert.Equal(t, Default().Timeouts, c.Timeouts)
+	assert.NoError(t, Default().Validate())
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	file := writeFile(t, "easyride.json",
+		`{"db-host": "file-host", "db-port": 6543, "match-interval": "1m", "listen": ":8080"}`)
+	envFile := writeFile(t, ".env", "HOST = env-host\nPASS = secret\n")
+
+	// the flags override the environment, which overrides the file
+	unsetEnv(t)
+	t.Setenv("MATCH_INTERVAL", "45s")
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	c, err := Load(fs, []string{"-config", file, "-env-file", envFile, "-match-interval", "2m", "-bcrypt-cost", "10"})
+	assert.NoError(t, err)
+	assert.Equal(t, ":8080", c.Listen)
+	assert.Equal(t, "env-host", c.Database.Host)
+	assert.Equal(t, 6543, c.Database.Port)
+	assert.Equal(t, "secret", c.Database.Password)
+	assert.Equal(t, 2*time.Minute, c.MatchInterval)
+	assert.Equal(t, 10, c.BcryptCost)
+
+	var out bytes.Buffer
+	assert.NoError(t, c.Print(&out))
+	printed := out.String()
+	assert.Regexp(t, `listen\s+:8080\s+file\n`, printed)
+	assert.Regexp(t, `db-host\s+env-host\s+env \$HOST\n`, printed)
+	assert.Regexp(t, `db-password\s+\*+\s+env \$PASS\n`, printed)
+	assert.Regexp(t, `match-interval\s+2m0s\s+flag\n`, printed)
+	assert.Regexp(t, `task-queue\s+worker-group-1\s+default\n`, printed)
+	assert.NotContains(t, printed, "secret")
+}
+
+func TestLoadDefaultEnvFile(t *testing.T) {
+	// the commands run from their own directory, next to the .env file of the repository
+	root := t.TempDir()
+	dir := filepath.Join(root, "worker")
+	assert.NoError(t, os.Mkdir(dir, 0700))
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+
+	unsetEnv(t)
+	c, err := Load(flag.NewFlagSet("test", flag.ContinueOnError), nil)
+	assert.NoError(t, err, "the default env file is optional")
+	assert.Equal(t, Default().Database, c.Database)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(root, ".env"), []byte("HOST=env-host\nPASS=secret\n"), 0600))
+	unsetEnv(t)
+	c, err = Load(flag.NewFlagSet("test", flag.ContinueOnError), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "env-host", c.Database.Host)
+	assert.Equal(t, "secret", c.Database.Password)
+
+	// a file given explicitly must be there
+	_, err = load(t, "-env-file", filepath.Join(dir, ".env"))
+	assert.Error(t, err)
+}
+
+func TestLoadFileErrors(t *testing.T) {
+	file := writeFile(t, "unknown.json", `{"db-hots": "db"}`)
+	_, err := load(t, "-config", file)
+	assert.EqualError(t, err, `unknown setting "db-hots" in `+file)
+
+	_, err = load(t, "-config", writeFile(t, "port.json", `{"db-port": "high"}`))
+	assert.ErrorContains(t, err, `invalid number "high"`)
+
+	_, err = load(t, "-config", filepath.Join(t.TempDir(), "missing.json"))
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+}
+
+func TestLoadInvalid(t *testing.T) {
+	_, err := load(t, "-match-interval", "soon")
+	assert.ErrorContains(t, err, `invalid duration "soon"`)
+
+	c, err := load(t, "-bcrypt-cost", "40", "-match-task-queue", "worker-group-1", "-temporal-tls-cert", "cert.pem",
+		"-trip-heartbeat-timeout", "3h", "-db-sslmode", "prefer")
+	assert.True(t, errors.Is(err, ErrInvalid))
+	assert.EqualError(t, err, "invalid configuration: bcrypt-cost must be between 4 and 31; "+
+		"db-sslmode must be one of disable, require, verify-ca and verify-full; "+
+		"temporal-tls-cert and temporal-tls-key go together; task-queue and match-task-queue must differ; "+
+		"trip-heartbeat-timeout must be shorter than max-trip-duration")
+	// the settings are returned to print them
+	assert.Equal(t, 40, c.BcryptCost)
+}
+
+func TestDSN(t *testing.T) {
+	d := Default().Database
+	d.Password = `it's a \ secret`
+	assert.Equal(t, `host='localhost' port=5432 user='temporal' password='it\'s a \\ secret' dbname='postgres' sslmode='disable'`,
+		d.DSN())
+}
@@ -1,13 +1,16 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"easyRide/config"
 	"easyRide/models"
+	"encoding/json"
 	"fmt"
-	"github.com/joho/godotenv"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"log"
-	"os"
+	"math"
+	"sort"
 	"time"
 )
 
@@ -18,18 +21,28 @@ type Database struct {
 // ErrNoMatch is returned when we request a row that doesn't exist
 var ErrNoMatch = fmt.Errorf("no matching record")
 var ErrDuplicateRegister = fmt.Errorf("cannot register twice")
+var ErrInvalidRating = fmt.Errorf("rating must be between %v and %v", models.MinRating, models.MaxRating)
+var ErrDuplicateRating = fmt.Errorf("trip has already been rated")
+var ErrRatingClosed = fmt.Errorf("the rating window of this trip is closed")
+var ErrRatingNotOpen = fmt.Errorf("the rating window of this trip is not open yet")
+var ErrRatingPending = fmt.Errorf("the rating was not confirmed by the trip in time")
+var ErrInvalidVehicle = fmt.Errorf("a vehicle needs a plate, seats and one of the ride classes")
+var ErrDuplicatePlate = fmt.Errorf("the plate is registered to another driver")
+var ErrUnknownDriver = fmt.Errorf("no driver is registered with this id")
+var ErrInvalidPreferences = fmt.Errorf("preferences must not be negative, nor ask for a rating above %v", models.MaxRating)
+
+// settings of the connection, the defaults until Configure is called
+var settings = config.Default().Database
+
+// Configure sets the database the connections are established to.
+func Configure(c config.Database) {
+	settings = c
+}
 
 // Initialize will establish a db connection.
 func Initialize() (Database, error) {
 	db := Database{}
-	err := godotenv.Load("../.env")
-	if err != nil {
-		log.Println("Error loading environment variable. ", err)
-	}
-	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		os.Getenv("HOST"), os.Getenv("PORT"), os.Getenv("USR"),
-		os.Getenv("PASS"), os.Getenv("DB"))
-	conn, err := sql.Open("postgres", dsn)
+	conn, err := sql.Open("postgres", settings.DSN())
 	if err != nil {
 		return db, err
 	}
@@ -67,8 +80,14 @@ func (db *Database) AddDriver(id int, name string, password string) error {
 // GetAvailableDrivers fetch all available drivers in descending order of their waiting time.
 func (db *Database) GetAvailableDrivers() (models.DriverList, error) {
 	list := models.DriverList{}
-	query := `SELECT * FROM drivers WHERE available=TRUE AND loc>=0 ORDER BY last_trip_end_at ASC`
-	rows, err := db.Conn.Query(query)
+	query := `SELECT d.id, d.name, d.password, d.loc, d.available, d.rating, d.with_passenger, d.last_trip_end_at,
+		COALESCE(v.id, 0), COALESCE(v.plate, ''), COALESCE(v.seats, $1), COALESCE(v.class, $2),
+		COALESCE(v.wheelchair_accessible, FALSE),
+		pref.home_loc, COALESCE(pref.max_pickup_distance, 0), COALESCE(pref.min_passenger_rating, 0)
+		FROM drivers d LEFT JOIN vehicles v ON v.driver_id=d.id
+		LEFT JOIN driver_preferences pref ON pref.driver_id=d.id
+		WHERE d.available=TRUE AND d.loc>=0 ORDER BY d.last_trip_end_at ASC`
+	rows, err := db.Conn.Query(query, models.DefaultVehicle.Seats, models.DefaultVehicle.Class)
 	if err != nil {
 		return list, err
 	}
@@ -76,10 +95,18 @@ func (db *Database) GetAvailableDrivers() (models.DriverList, error) {
 
 	for rows.Next() {
 		var driver models.Driver
+		var homeLoc sql.NullInt64
+		v := &driver.Vehicle
+		pref := &driver.Preferences
 		if err := rows.Scan(&driver.ID, &driver.Name, &driver.Password, &driver.Loc,
-			&driver.Available, &driver.Rating, &driver.WithPassenger, &driver.LastTripEndAt); err != nil {
+			&driver.Available, &driver.Rating, &driver.WithPassenger, &driver.LastTripEndAt,
+			&v.ID, &v.Plate, &v.Seats, &v.Class, &v.WheelchairAccessible,
+			&homeLoc, &pref.MaxPickupDistance, &pref.MinPassengerRating); err != nil {
 			return list, err
 		}
+		v.DriverID = driver.ID
+		pref.DriverID = driver.ID
+		pref.HomeLoc = nullableLoc(homeLoc)
 		list.Drivers = append(list.Drivers, driver)
 	}
 	return list, nil
@@ -97,6 +124,13 @@ func (db *Database) UpdateDriverStatus(driverId int, withPassenger *models.Passe
 	}
 }
 
+// GetDriverLoc fetch the last location the driver reported, or was moved to along a trip.
+func (db *Database) GetDriverLoc(driverID int) (loc int, e error) {
+	query := `SELECT loc FROM drivers WHERE id=$1`
+	err := db.Conn.QueryRow(query, driverID).Scan(&loc)
+	return loc, err
+}
+
 // UpdateDriverLoc updates the driver's location regularly.
 func (db *Database) UpdateDriverLoc(driverID int, loc int) error {
 	query := `UPDATE drivers SET loc=$1 WHERE id=$2;`
@@ -116,6 +150,13 @@ func (db *Database) SetDriverOffline(DriverID int) error {
 	return nil
 }
 
+// SetDriverUnavailable keeps the driver online but out of matching, e.g. during a break.
+func (db *Database) SetDriverUnavailable(driverID int) error {
+	query := `UPDATE drivers SET available=FALSE WHERE id=$1;`
+	_, err := db.Conn.Exec(query, driverID)
+	return err
+}
+
 // UpdateLastTripEndTime updates the driver's last trip end time.
 func (db *Database) UpdateLastTripEndTime(driverId int) error {
 	query := `UPDATE drivers SET last_trip_end_at=$1 WHERE id=$2;`
@@ -128,21 +169,32 @@ func (db *Database) UpdateLastTripEndTime(driverId int) error {
 	}
 }
 
-// UpdateDriverRating updates the driver's rating when receiving passengers' feedback.
-func (db *Database) UpdateDriverRating(driverId int, newRating float64) error {
-	var prevRating float64
-	err := db.Conn.QueryRow(`SELECT rating FROM drivers WHERE id=$1`, driverId).Scan(&prevRating)
+// ReleaseDriver makes the driver available again, unless the driver carries another passenger than the given one.
+// It reports whether the driver was released.
+func (db *Database) ReleaseDriver(driverID int, passengerID int) (bool, error) {
+	query := `UPDATE drivers SET available=TRUE, with_passenger=0 WHERE id=$1 AND NOT EXISTS
+		(SELECT 1 FROM passengers WHERE with_driver=$1 AND in_ride=TRUE AND id<>$2);`
+	res, err := db.Conn.Exec(query, driverID, passengerID)
 	if err != nil {
-		prevRating = 5.0
+		return false, err
 	}
-	query := `UPDATE drivers SET rating=$1 WHERE id=$2;`
-	_, err = db.Conn.Exec(query, (newRating+prevRating)/2, driverId)
-	switch err {
-	case sql.ErrNoRows:
-		return ErrNoMatch
-	default:
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// UpdateDriverRating recomputes the driver's rating from the passengers' feedback of the recent trips.
+func (db *Database) UpdateDriverRating(driverId int) error {
+	scores, err := db.recentRatings(`SELECT rating FROM ratings WHERE driver_id=$1 AND rater=$2
+		ORDER BY created_at DESC LIMIT $3`, driverId, models.RaterPassenger)
+	if err != nil {
 		return err
 	}
+	query := `UPDATE drivers SET rating=$1 WHERE id=$2;`
+	_, err = db.Conn.Exec(query, models.AverageRating(scores), driverId)
+	return err
 }
 
 func (db *Database) GetMatchedPassenger(driverId int) (passengerID int, e error) {
@@ -176,10 +228,13 @@ func (db *Database) AddPassenger(id int, name string, password string) error {
 	return nil
 }
 
-// GetWaitingPassengers fetch all unmatched passengers in descending order of their waiting time.
+// GetWaitingPassengers fetch all unmatched passengers, the scheduled trips first,
+// then in descending order of their waiting time.
 func (db *Database) GetWaitingPassengers() (models.PassengerList, error) {
 	list := models.PassengerList{}
-	query := `SELECT * FROM passengers WHERE in_ride=FALSE AND drop_loc>=0 ORDER BY created_at ASC`
+	query := `SELECT id, name, password, pick_up_loc, drop_loc, rating, workflow_id, in_ride, with_driver,
+		created_at, requested_at, match_radius, pooled, ride_class, needs_accessible,
+		ARRAY(SELECT driver_id FROM passenger_blocks b WHERE b.passenger_id=passengers.id) FROM passengers WHERE in_ride=FALSE AND drop_loc>=0 ORDER BY priority DESC, requested_at ASC`
 	rows, err := db.Conn.Query(query)
 	if err != nil {
 		return list, err
@@ -190,7 +245,8 @@ func (db *Database) GetWaitingPassengers() (models.PassengerList, error) {
 		var passenger models.Passenger
 		if err := rows.Scan(&passenger.ID, &passenger.Name, &passenger.Password, &passenger.PickupLoc,
 			&passenger.DropLoc, &passenger.Rating, &passenger.WorkflowID, &passenger.InRide,
-			&passenger.WithDriver, &passenger.CreatedAt); err != nil {
+			&passenger.WithDriver, &passenger.CreatedAt, &passenger.RequestedAt, &passenger.MatchRadius, &passenger.Pooled,
+			&passenger.RideClass, &passenger.NeedsAccessible, pq.Array(&passenger.BlockedDrivers)); err != nil {
 			return list, err
 		}
 		list.Passengers = append(list.Passengers, passenger)
@@ -219,21 +275,66 @@ func (db *Database) SetPassengerTripEnd(passengerID int) error {
 	return nil
 }
 
-// UpdatePassengerRating updates passengers' rating when receiving feedback from drivers.
-func (db *Database) UpdatePassengerRating(passengerId int, newRating float64) error {
-	var prevRating float64
-	err := db.Conn.QueryRow(`SELECT rating FROM passengers WHERE id=$1`, passengerId).Scan(&prevRating)
+// RestorePassenger takes the passenger of the trip out of the ride, the passenger can request another trip.
+// The passenger is left alone once on another trip.
+func (db *Database) RestorePassenger(passengerID int, workflowID string) error {
+	query := `UPDATE passengers SET drop_loc=-100, in_ride=FALSE, with_driver=0 WHERE id=$1 AND workflow_id=$2;`
+	_, err := db.Conn.Exec(query, passengerID, workflowID)
+	return err
+}
+
+// SetMatchRadius widens the area searched for the passenger's driver.
+func (db *Database) SetMatchRadius(passengerID int, radius int) error {
+	query := `UPDATE passengers SET match_radius=$1 WHERE id=$2;`
+	_, err := db.Conn.Exec(query, radius, passengerID)
+	return err
+}
+
+// DispatchScheduledTrip enters a trip booked ahead into the matching pool, ahead of the immediate requests.
+// It reports false, and leaves the passenger as is, while the passenger is on a trip or waits for a match of another
+// trip workflow.
+func (db *Database) DispatchScheduledTrip(workflowID string, trip *models.ScheduledTrip) (bool, error) {
+	query := `UPDATE passengers SET workflow_id=$1, pick_up_loc=$2, drop_loc=$3, requested_at=$4, match_radius=$5,
+		priority=TRUE, pooled=FALSE, ride_class=$6, needs_accessible=$7 WHERE id=$8 AND in_ride=FALSE
+		AND (drop_loc<0 OR workflow_id=$1);`
+	return updated(db.Conn.Exec(query, workflowID, trip.PickupLoc, trip.DropLoc, time.Now(), models.InitialMatchRadius,
+		rideClass(trip.RideClass), trip.NeedsAccessible, trip.PassengerID))
+}
+
+// CancelTripRequest withdraws the passenger's request of the trip workflow from matching.
+// It reports false when the passenger got matched in the meantime, or the request belongs to another trip.
+func (db *Database) CancelTripRequest(passengerID int, workflowID string) (bool, error) {
+	tx, err := db.Conn.Begin()
 	if err != nil {
-		prevRating = 5.0
+		return false, err
 	}
-	query := `UPDATE passengers SET rating=$1 WHERE id=$2;`
-	_, err = db.Conn.Exec(query, (newRating+prevRating)/2, passengerId)
-	switch err {
-	case sql.ErrNoRows:
-		return ErrNoMatch
-	default:
+	defer tx.Rollback()
+	// a round in progress may be matching the passenger, wait for it to be over
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, matchLockKey); err != nil {
+		return false, err
+	}
+	query := `UPDATE passengers SET drop_loc=-100 WHERE id=$1 AND workflow_id=$2 AND in_ride=FALSE;`
+	res, err := tx.Exec(query, passengerID, workflowID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, tx.Commit()
+}
+
+// UpdatePassengerRating recomputes the passenger's rating from the drivers' feedback of the recent trips.
+func (db *Database) UpdatePassengerRating(passengerId int) error {
+	scores, err := db.recentRatings(`SELECT rating FROM ratings WHERE passenger_id=$1 AND rater=$2
+		ORDER BY created_at DESC LIMIT $3`, passengerId, models.RaterDriver)
+	if err != nil {
 		return err
 	}
+	query := `UPDATE passengers SET rating=$1 WHERE id=$2;`
+	_, err = db.Conn.Exec(query, models.AverageRating(scores), passengerId)
+	return err
 }
 
 func (db *Database) UpdateWorkFlowID(passengerId int, workflowId string) error {
@@ -272,6 +373,15 @@ func (db *Database) GetDestination(passengerId int) (destination int, e error) {
 	return destination, nil
 }
 
+func (db *Database) GetPickupLoc(passengerId int) (pickupLoc int, e error) {
+	query := `SELECT pick_up_loc FROM passengers WHERE id=$1`
+	err := db.Conn.QueryRow(query, passengerId).Scan(&pickupLoc)
+	if err != nil {
+		return 0, err
+	}
+	return pickupLoc, nil
+}
+
 func (db *Database) GetPassword(userName string, table string) (password string, id int, e error) {
 	var query string
 	if table == "passenger" {
@@ -286,15 +396,633 @@ func (db *Database) GetPassword(userName string, table string) (password string,
 	return password, id, nil
 }
 
-func (db *Database) UpdatePassengerLoc(body *models.PassengerRequestBody) error {
-	query := `UPDATE passengers SET pick_up_loc=$1, drop_loc=$2 WHERE id=$3;`
-	_, err := db.Conn.Exec(query, body.PickupLoc, body.DropLoc, body.ID)
+// RequestTrip enters the passenger's trip request into the matching pool, the match signals go to the trip workflow.
+// It reports false, and leaves the passenger as is, while the passenger is on a trip or waits for a match of another
+// trip workflow, such as a scheduled trip dispatched.
+func (db *Database) RequestTrip(workflowID string, body *models.PassengerRequestBody) (bool, error) {
+	query := `UPDATE passengers SET workflow_id=$1, pick_up_loc=$2, drop_loc=$3, requested_at=$4, match_radius=$5,
+		priority=FALSE, pooled=$6, ride_class=$7, needs_accessible=$8 WHERE id=$9 AND in_ride=FALSE
+		AND (drop_loc<0 OR workflow_id=$1);`
+	return updated(db.Conn.Exec(query, workflowID, body.PickupLoc, body.DropLoc, time.Now(), models.InitialMatchRadius,
+		body.Pooled, rideClass(body.RideClass), body.NeedsAccessible, body.ID))
+}
+
+// Rating database
+
+// AddRating stores the rating of a single trip. Each party can rate a trip at most once.
+func (db *Database) AddRating(r *models.Rating) error {
+	if !models.ValidRating(r.Score) {
+		return ErrInvalidRating
+	}
+	query := `INSERT INTO ratings (trip_id, rater, passenger_id, driver_id, rating, feedback, tags)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) ON CONFLICT (trip_id, rater) DO NOTHING`
+	res, err := db.Conn.Exec(query, r.TripID, r.Rater, r.PassengerID, r.DriverID, r.Score,
+		r.Feedback, pq.Array(r.Tags))
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
 	if err != nil {
 		return err
 	}
+	if n == 0 {
+		return ErrDuplicateRating
+	}
 	return nil
 }
 
+// recentRatings fetch the scores of the most recent trips, newest first.
+func (db *Database) recentRatings(query string, id int, rater string) ([]float64, error) {
+	rows, err := db.Conn.Query(query, id, rater, models.RatingWindow)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var scores []float64
+	for rows.Next() {
+		var score float64
+		if err := rows.Scan(&score); err != nil {
+			return nil, err
+		}
+		scores = append(scores, score)
+	}
+	return scores, rows.Err()
+}
+
+// Trip database
+
+// AddTrip records the trip of a matched passenger and driver, the trip is keyed by the passenger's workflow ID.
+func (db *Database) AddTrip(tripID string, passenger *models.Passenger, driver *models.Driver, pickupETA time.Time) error {
+	return addTrip(db.Conn, tripID, passenger, driver, pickupETA)
+}
+
+// execer runs a statement on the connection or within a transaction.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func addTrip(conn execer, tripID string, passenger *models.Passenger, driver *models.Driver, pickupETA time.Time) error {
+	query := `INSERT INTO trips (id, passenger_id, driver_id, pick_up_loc, drop_loc, pickup_eta, requested_at, pooled,
+		ride_class, fare) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) ON CONFLICT (id) DO NOTHING`
+	class := rideClass(passenger.RideClass)
+	fare := models.Fare(class, math.Abs(float64(passenger.PickupLoc-passenger.DropLoc)))
+	_, err := conn.Exec(query, tripID, passenger.ID, driver.ID, passenger.PickupLoc, passenger.DropLoc, pickupETA,
+		passenger.RequestedAt, passenger.Pooled, class, fare)
+	return err
+}
+
+// PairPassenger matches the waiting passenger with the available driver and records their trip, all of it or
+// nothing. It reports false when the request was withdrawn or the driver taken in the meantime.
+func (db *Database) PairPassenger(tripID string, passenger *models.Passenger, driver *models.Driver,
+	pickupETA time.Time) (bool, error) {
+	tx, err := db.Conn.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	query := `UPDATE passengers SET in_ride=TRUE, with_driver=$2 WHERE id=$1 AND workflow_id=$3 AND in_ride=FALSE
+		AND drop_loc>=0;`
+	if ok, err := updated(tx.Exec(query, passenger.ID, driver.ID, tripID)); err != nil || !ok {
+		return false, err
+	}
+	query = `UPDATE drivers SET available=FALSE, with_passenger=$2 WHERE id=$1 AND available=TRUE;`
+	if ok, err := updated(tx.Exec(query, driver.ID, passenger.ID)); err != nil || !ok {
+		return false, err
+	}
+	if err := addTrip(tx, tripID, passenger, driver, pickupETA); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// UnpairPassenger undoes the pairing of a passenger whose trip could not be started: the passenger waits for the
+// next round and the driver is available again.
+func (db *Database) UnpairPassenger(tripID string, passengerID int, driverID int) error {
+	tx, err := db.Conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	statements := []struct {
+		query string
+		args  []interface{}
+	}{
+		{`UPDATE passengers SET in_ride=FALSE, with_driver=0 WHERE id=$1 AND with_driver=$2;`,
+			[]interface{}{passengerID, driverID}},
+		{`UPDATE drivers SET available=TRUE, with_passenger=0 WHERE id=$1 AND with_passenger=$2;`,
+			[]interface{}{driverID, passengerID}},
+		{`DELETE FROM route_stops WHERE trip_id=$1;`, []interface{}{tripID}},
+		{`DELETE FROM trips WHERE id=$1 AND driver_id=$2 AND picked_up_at IS NULL;`, []interface{}{tripID, driverID}},
+	}
+	for _, s := range statements {
+		if _, err := tx.Exec(s.query, s.args...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// updated reports whether the statement changed a row.
+func updated(res sql.Result, err error) (bool, error) {
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// SetDriverArrivedAtPickup records when the driver reached the pickup location.
+func (db *Database) SetDriverArrivedAtPickup(tripID string) error {
+	query := `UPDATE trips SET driver_arrived_at=$1 WHERE id=$2 AND driver_arrived_at IS NULL;`
+	_, err := db.Conn.Exec(query, time.Now(), tripID)
+	return err
+}
+
+// SetPickedUp records when the passenger was picked up, and returns it along with the pickup ETA given at matching.
+func (db *Database) SetPickedUp(tripID string) (eta time.Time, pickedUpAt time.Time, e error) {
+	query := `UPDATE trips SET picked_up_at=COALESCE(picked_up_at, $1) WHERE id=$2 RETURNING COALESCE(pickup_eta, picked_up_at), picked_up_at;`
+	err := db.Conn.QueryRow(query, time.Now(), tripID).Scan(&eta, &pickedUpAt)
+	switch err {
+	case sql.ErrNoRows:
+		return eta, pickedUpAt, ErrNoMatch
+	default:
+		return eta, pickedUpAt, err
+	}
+}
+
+// SetNoShow charges the no-show fee of the trip.
+func (db *Database) SetNoShow(tripID string, fee float64) error {
+	query := `UPDATE trips SET no_show_fee=$1 WHERE id=$2;`
+	_, err := db.Conn.Exec(query, fee, tripID)
+	return err
+}
+
+// SetRatingMissed records that the rater let the rating window of the trip pass.
+func (db *Database) SetRatingMissed(tripID string, rater string) error {
+	var query string
+	if rater == models.RaterPassenger {
+		query = `UPDATE trips SET passenger_missed_rating=TRUE WHERE id=$1;`
+	} else {
+		query = `UPDATE trips SET driver_missed_rating=TRUE WHERE id=$1;`
+	}
+	_, err := db.Conn.Exec(query, tripID)
+	return err
+}
+
+// SetTripFare records the fare of the trip, the share of the route for a pooled rider.
+func (db *Database) SetTripFare(tripID string, fare float64) error {
+	query := `UPDATE trips SET fare=$1 WHERE id=$2;`
+	_, err := db.Conn.Exec(query, fare, tripID)
+	return err
+}
+
+// GetTripFare fetch the fare of the trip, ok is false when the trip has no fare recorded.
+func (db *Database) GetTripFare(tripID string) (fare float64, ok bool, e error) {
+	var f sql.NullFloat64
+	query := `SELECT fare FROM trips WHERE id=$1`
+	err := db.Conn.QueryRow(query, tripID).Scan(&f)
+	switch err {
+	case nil:
+		return f.Float64, f.Valid, nil
+	case sql.ErrNoRows:
+		return 0, false, ErrNoMatch
+	default:
+		return 0, false, err
+	}
+}
+
+// SetTripPaid records the payment of the trip, the time of the first payment is kept.
+func (db *Database) SetTripPaid(tripID string, amount float64) error {
+	query := `UPDATE trips SET paid=$1, paid_at=COALESCE(paid_at, $2) WHERE id=$3;`
+	_, err := db.Conn.Exec(query, amount, time.Now(), tripID)
+	return err
+}
+
+// VoidTripPayment voids the payment of the trip. It reports false when the trip has no payment left to void.
+func (db *Database) VoidTripPayment(tripID string) (amount float64, voided bool, e error) {
+	query := `UPDATE trips SET payment_voided_at=$1 WHERE id=$2 AND paid_at IS NOT NULL AND payment_voided_at IS NULL
+		RETURNING paid;`
+	err := db.Conn.QueryRow(query, time.Now(), tripID).Scan(&amount)
+	switch err {
+	case nil:
+		return amount, true, nil
+	case sql.ErrNoRows:
+		return 0, false, nil
+	default:
+		return 0, false, err
+	}
+}
+
+// AbortTrip records that the trip failed halfway and was undone.
+func (db *Database) AbortTrip(tripID string) error {
+	query := `UPDATE trips SET aborted_at=COALESCE(aborted_at, $1) WHERE id=$2;`
+	_, err := db.Conn.Exec(query, time.Now(), tripID)
+	return err
+}
+
+// rideClass is the class of a request, economy unless asked otherwise.
+func rideClass(class models.RideClass) models.RideClass {
+	if class == "" {
+		return models.ClassEconomy
+	}
+	return class
+}
+
+// Vehicle database
+
+// SetVehicle registers the vehicle of the driver, or replaces the one registered.
+// The driver must be registered, ErrUnknownDriver is returned otherwise.
+func (db *Database) SetVehicle(v *models.Vehicle) error {
+	if !models.ValidRideClass(v.Class) || v.Seats <= 0 || v.Plate == "" {
+		return ErrInvalidVehicle
+	}
+	query := `INSERT INTO vehicles (driver_id, plate, seats, class, wheelchair_accessible) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (driver_id) DO UPDATE SET plate=$2, seats=$3, class=$4, wheelchair_accessible=$5`
+	_, err := db.Conn.Exec(query, v.DriverID, v.Plate, v.Seats, v.Class, v.WheelchairAccessible)
+	if e, ok := err.(*pq.Error); ok {
+		switch e.Code {
+		case "23505":
+			return ErrDuplicatePlate
+		case "23503":
+			return ErrUnknownDriver
+		}
+	}
+	return err
+}
+
+// Preference database
+
+// SetDriverPreferences stores the constraints of the driver on the trips offered.
+func (db *Database) SetDriverPreferences(pref *models.DriverPreferences) error {
+	if !pref.Valid() {
+		return ErrInvalidPreferences
+	}
+	query := `INSERT INTO driver_preferences (driver_id, home_loc, max_pickup_distance, min_passenger_rating, updated_at)
+		VALUES ($1, $2, $3, $4, $5) ON CONFLICT (driver_id) DO UPDATE
+		SET home_loc=$2, max_pickup_distance=$3, min_passenger_rating=$4, updated_at=$5`
+	_, err := db.Conn.Exec(query, pref.DriverID, pref.HomeLoc, pref.MaxPickupDistance, pref.MinPassengerRating,
+		time.Now())
+	return err
+}
+
+// BlockDriver keeps the driver from ever being matched with the passenger again.
+func (db *Database) BlockDriver(passengerID int, driverID int) error {
+	query := `INSERT INTO passenger_blocks (passenger_id, driver_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+	_, err := db.Conn.Exec(query, passengerID, driverID)
+	return err
+}
+
+// UnblockDriver lifts the block of the driver by the passenger.
+func (db *Database) UnblockDriver(passengerID int, driverID int) error {
+	query := `DELETE FROM passenger_blocks WHERE passenger_id=$1 AND driver_id=$2`
+	_, err := db.Conn.Exec(query, passengerID, driverID)
+	return err
+}
+
+func nullableLoc(loc sql.NullInt64) *int {
+	if !loc.Valid {
+		return nil
+	}
+	l := int(loc.Int64)
+	return &l
+}
+
+// Route database
+
+// GetPoolRoutes fetch the routes of the drivers carrying pooled riders, with the stops in visiting order.
+func (db *Database) GetPoolRoutes() ([]models.PoolRoute, error) {
+	query := `SELECT r.driver_id, d.loc, COALESCE(v.seats, $1), COALESCE(v.class, $2),
+		COALESCE(v.wheelchair_accessible, FALSE),
+		pref.home_loc, COALESCE(pref.max_pickup_distance, 0), COALESCE(pref.min_passenger_rating, 0),
+		r.trip_id, r.passenger_id, r.kind, r.loc, r.done
+		FROM route_stops r JOIN drivers d ON d.id=r.driver_id LEFT JOIN vehicles v ON v.driver_id=r.driver_id
+		LEFT JOIN driver_preferences pref ON pref.driver_id=r.driver_id
+		ORDER BY r.driver_id, r.seq`
+	rows, err := db.Conn.Query(query, models.DefaultVehicle.Seats, models.DefaultVehicle.Class)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var routes []models.PoolRoute
+	for rows.Next() {
+		var driverID, driverLoc int
+		var vehicle models.Vehicle
+		var pref models.DriverPreferences
+		var homeLoc sql.NullInt64
+		var stop models.Stop
+		if err := rows.Scan(&driverID, &driverLoc, &vehicle.Seats, &vehicle.Class, &vehicle.WheelchairAccessible,
+			&homeLoc, &pref.MaxPickupDistance, &pref.MinPassengerRating,
+			&stop.TripID, &stop.PassengerID, &stop.Kind, &stop.Loc, &stop.Done); err != nil {
+			return nil, err
+		}
+		if len(routes) == 0 || routes[len(routes)-1].DriverID != driverID {
+			vehicle.DriverID = driverID
+			pref.DriverID = driverID
+			pref.HomeLoc = nullableLoc(homeLoc)
+			routes = append(routes, models.PoolRoute{DriverID: driverID, DriverLoc: driverLoc, Vehicle: vehicle,
+				Preferences: pref})
+		}
+		last := &routes[len(routes)-1]
+		last.Stops = append(last.Stops, stop)
+	}
+	return routes, rows.Err()
+}
+
+// GetRoute fetch the stops of the driver's pooled route in visiting order.
+func (db *Database) GetRoute(driverID int) ([]models.Stop, error) {
+	query := `SELECT trip_id, passenger_id, kind, loc, done FROM route_stops WHERE driver_id=$1 ORDER BY seq`
+	rows, err := db.Conn.Query(query, driverID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stops []models.Stop
+	for rows.Next() {
+		var stop models.Stop
+		if err := rows.Scan(&stop.TripID, &stop.PassengerID, &stop.Kind, &stop.Loc, &stop.Done); err != nil {
+			return nil, err
+		}
+		stops = append(stops, stop)
+	}
+	return stops, rows.Err()
+}
+
+// GetNextStop fetch the first stop of the driver's pooled route not done yet.
+// It returns ErrNoMatch when the driver has no pooled route.
+func (db *Database) GetNextStop(driverID int) (models.Stop, error) {
+	var stop models.Stop
+	query := `SELECT trip_id, passenger_id, kind, loc, done FROM route_stops WHERE driver_id=$1 AND done=FALSE
+		ORDER BY seq LIMIT 1`
+	err := db.Conn.QueryRow(query, driverID).Scan(&stop.TripID, &stop.PassengerID, &stop.Kind, &stop.Loc, &stop.Done)
+	if err == sql.ErrNoRows {
+		return stop, ErrNoMatch
+	}
+	return stop, err
+}
+
+// SetRoute replaces the pooled route of the driver.
+func (db *Database) SetRoute(driverID int, stops []models.Stop) error {
+	tx, err := db.Conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := setRoute(tx, driverID, stops); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func setRoute(conn execer, driverID int, stops []models.Stop) error {
+	if _, err := conn.Exec(`DELETE FROM route_stops WHERE driver_id=$1`, driverID); err != nil {
+		return err
+	}
+	query := `INSERT INTO route_stops (driver_id, trip_id, passenger_id, kind, loc, seq, done)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	for seq, s := range stops {
+		if _, err := conn.Exec(query, driverID, s.TripID, s.PassengerID, s.Kind, s.Loc, seq, s.Done); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func setTripFares(conn execer, fares map[string]float64) error {
+	for tripID, fare := range fares {
+		if _, err := conn.Exec(`UPDATE trips SET fare=$1 WHERE id=$2;`, fare, tripID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// JoinPoolRoute matches the waiting passenger with the driver of a pooled route, records the trip, and replaces the
+// route and the fares of its riders, all of it or nothing. It reports false when the request was withdrawn in the
+// meantime.
+func (db *Database) JoinPoolRoute(tripID string, passenger *models.Passenger, driver *models.Driver,
+	pickupETA time.Time, stops []models.Stop, fares map[string]float64) (bool, error) {
+	tx, err := db.Conn.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	query := `UPDATE passengers SET in_ride=TRUE, with_driver=$2 WHERE id=$1 AND workflow_id=$3 AND in_ride=FALSE
+		AND drop_loc>=0;`
+	if ok, err := updated(tx.Exec(query, passenger.ID, driver.ID, tripID)); err != nil || !ok {
+		return false, err
+	}
+	if err := addTrip(tx, tripID, passenger, driver, pickupETA); err != nil {
+		return false, err
+	}
+	if err := setRoute(tx, driver.ID, stops); err != nil {
+		return false, err
+	}
+	if err := setTripFares(tx, fares); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// LeavePoolRoute undoes the join of a passenger whose trip could not be told: the passenger waits for the next
+// round, and the route and the fares of its riders are the ones before the join.
+func (db *Database) LeavePoolRoute(tripID string, passengerID int, driverID int, stops []models.Stop,
+	fares map[string]float64) error {
+	tx, err := db.Conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	query := `UPDATE passengers SET in_ride=FALSE, with_driver=0 WHERE id=$1 AND with_driver=$2;`
+	if _, err := tx.Exec(query, passengerID, driverID); err != nil {
+		return err
+	}
+	query = `DELETE FROM trips WHERE id=$1 AND driver_id=$2 AND picked_up_at IS NULL;`
+	if _, err := tx.Exec(query, tripID, driverID); err != nil {
+		return err
+	}
+	if err := setRoute(tx, driverID, stops); err != nil {
+		return err
+	}
+	if err := setTripFares(tx, fares); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CompleteStop marks a stop of a pooled trip done and returns how many stops the driver has left.
+// The route is cleared once all its stops are done.
+func (db *Database) CompleteStop(tripID string, kind models.StopKind) (remaining int, e error) {
+	var driverID int
+	query := `UPDATE route_stops SET done=TRUE WHERE trip_id=$1 AND kind=$2 RETURNING driver_id`
+	err := db.Conn.QueryRow(query, tripID, kind).Scan(&driverID)
+	if err == sql.ErrNoRows {
+		return 0, ErrNoMatch
+	}
+	if err != nil {
+		return 0, err
+	}
+	query = `SELECT count(*) FROM route_stops WHERE driver_id=$1 AND done=FALSE`
+	if err := db.Conn.QueryRow(query, driverID).Scan(&remaining); err != nil {
+		return 0, err
+	}
+	if remaining == 0 {
+		_, err = db.Conn.Exec(`DELETE FROM route_stops WHERE driver_id=$1`, driverID)
+	}
+	return remaining, err
+}
+
+// Notification database
+
+// AddNotification leaves a message to the passenger.
+func (db *Database) AddNotification(passengerID int, message string) error {
+	query := `INSERT INTO notifications (passenger_id, message) VALUES ($1, $2)`
+	_, err := db.Conn.Exec(query, passengerID, message)
+	return err
+}
+
+// GetNotifications fetch the messages not yet delivered to the passenger, oldest first, and marks them delivered.
+func (db *Database) GetNotifications(passengerID int) ([]models.Notification, error) {
+	query := `UPDATE notifications SET delivered=TRUE WHERE passenger_id=$1 AND delivered=FALSE
+		RETURNING id, passenger_id, message, created_at`
+	rows, err := db.Conn.Query(query, passengerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := []models.Notification{}
+	for rows.Next() {
+		var n models.Notification
+		if err := rows.Scan(&n.ID, &n.PassengerID, &n.Message, &n.CreatedAt); err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, n)
+	}
+	sort.Slice(notifications, func(i, j int) bool { return notifications[i].ID < notifications[j].ID })
+	return notifications, rows.Err()
+}
+
+// Match round database
+
+// matchLockKey is the advisory lock held while a matching round updates passengers and drivers.
+const matchLockKey = 7433
+
+// LockMatching takes the matching lock without waiting, so that concurrent rounds never match the same users.
+// The lock is held until release is called.
+func (db *Database) LockMatching(ctx context.Context) (release func(), locked bool, e error) {
+	conn, err := db.Conn.Conn(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, matchLockKey).Scan(&locked); err != nil {
+		conn.Close()
+		return nil, false, err
+	}
+	if !locked {
+		conn.Close()
+		return nil, false, nil
+	}
+	release = func() {
+		if _, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, matchLockKey); err != nil {
+			log.Println("Cannot release the matching lock. ", err)
+		}
+		conn.Close()
+	}
+	return release, true, nil
+}
+
+// AddMatchRound records a successful matching round.
+func (db *Database) AddMatchRound(roundID string, startedAt time.Time, matched int) error {
+	query := `INSERT INTO match_rounds (id, started_at, finished_at, matched) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (id) DO UPDATE SET finished_at=$3, matched=$4`
+	_, err := db.Conn.Exec(query, roundID, startedAt, time.Now(), matched)
+	return err
+}
+
+// GetLastMatchRound fetch when the last successful matching round finished and how many passengers it matched.
+func (db *Database) GetLastMatchRound() (finishedAt time.Time, matched int, e error) {
+	query := `SELECT finished_at, matched FROM match_rounds ORDER BY finished_at DESC LIMIT 1`
+	err := db.Conn.QueryRow(query).Scan(&finishedAt, &matched)
+	if err == sql.ErrNoRows {
+		return finishedAt, 0, ErrNoMatch
+	}
+	return finishedAt, matched, err
+}
+
+// Match round audit database
+
+// AddRoundAudit stores the snapshot of a match round.
+func (db *Database) AddRoundAudit(audit models.RoundAudit) error {
+	passengers, err := json.Marshal(audit.Passengers)
+	if err != nil {
+		return err
+	}
+	drivers, err := json.Marshal(audit.Drivers)
+	if err != nil {
+		return err
+	}
+	costs, err := json.Marshal(audit.Costs)
+	if err != nil {
+		return err
+	}
+	assignments, err := json.Marshal(audit.Assignments)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO match_round_audits (round_id, solver, passengers, drivers, costs, assignments)
+		VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (round_id) DO UPDATE
+		SET solver=$2, passengers=$3, drivers=$4, costs=$5, assignments=$6, created_at=CURRENT_TIMESTAMP`
+	_, err = db.Conn.Exec(query, audit.RoundID, audit.Solver, passengers, drivers, costs, assignments)
+	return err
+}
+
+// GetRoundAudit fetch the snapshot of a match round.
+func (db *Database) GetRoundAudit(roundID string) (models.RoundAudit, error) {
+	audit := models.RoundAudit{RoundID: roundID}
+	var passengers, drivers, costs, assignments []byte
+	query := `SELECT solver, passengers, drivers, costs, assignments, created_at FROM match_round_audits
+		WHERE round_id=$1`
+	err := db.Conn.QueryRow(query, roundID).Scan(&audit.Solver, &passengers, &drivers, &costs, &assignments,
+		&audit.CreatedAt)
+	if err == sql.ErrNoRows {
+		return audit, ErrNoMatch
+	}
+	if err != nil {
+		return audit, err
+	}
+	for _, field := range []struct {
+		raw []byte
+		v   interface{}
+	}{{passengers, &audit.Passengers}, {drivers, &audit.Drivers}, {costs, &audit.Costs}, {assignments, &audit.Assignments}} {
+		if err := json.Unmarshal(field.raw, field.v); err != nil {
+			return audit, err
+		}
+	}
+	return audit, nil
+}
+
+// GetRoundAuditIDs fetch the IDs of the latest audited match rounds, the latest first.
+func (db *Database) GetRoundAuditIDs(limit int) ([]string, error) {
+	query := `SELECT round_id FROM match_round_audits ORDER BY created_at DESC LIMIT $1`
+	rows, err := db.Conn.Query(query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return ids, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
 func (db *Database) Mytest() (bool, error) {
 	query := `SELECT exists(SELECT 1 from drivers where id=$1);`
 	rows := db.Conn.QueryRow(query, 2)
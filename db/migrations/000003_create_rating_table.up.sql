@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS ratings(
+    id SERIAL PRIMARY KEY,
+    trip_id VARCHAR(100) NOT NULL,
+    rater VARCHAR(20) NOT NULL,
+    passenger_id integer NOT NULL,
+    driver_id integer NOT NULL,
+    rating real NOT NULL CHECK (rating >= 1 AND rating <= 5),
+    feedback TEXT DEFAULT '',
+    tags TEXT[] DEFAULT '{}',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (trip_id, rater)
+);
+CREATE INDEX IF NOT EXISTS ratings_driver_idx ON ratings (driver_id, created_at);
+CREATE INDEX IF NOT EXISTS ratings_passenger_idx ON ratings (passenger_id, created_at);
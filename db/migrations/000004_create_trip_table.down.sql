@@ -0,0 +1 @@
+DROP TABLE IF EXISTS trips;
\ No newline at end of file
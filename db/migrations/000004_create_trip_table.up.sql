@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS trips(
+    id VARCHAR(100) PRIMARY KEY,
+    passenger_id integer NOT NULL,
+    driver_id integer NOT NULL,
+    pick_up_loc integer,
+    drop_loc integer,
+    passenger_missed_rating BOOLEAN NOT NULL DEFAULT FALSE,
+    driver_missed_rating BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
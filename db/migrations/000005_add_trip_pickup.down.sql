@@ -0,0 +1,5 @@
+ALTER TABLE trips
+    DROP COLUMN IF EXISTS pickup_eta,
+    DROP COLUMN IF EXISTS driver_arrived_at,
+    DROP COLUMN IF EXISTS picked_up_at,
+    DROP COLUMN IF EXISTS no_show_fee;
\ No newline at end of file
@@ -0,0 +1,5 @@
+ALTER TABLE trips
+    ADD COLUMN IF NOT EXISTS pickup_eta TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS driver_arrived_at TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS picked_up_at TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS no_show_fee real NOT NULL DEFAULT 0;
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS match_rounds;
\ No newline at end of file
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS match_rounds(
+    id VARCHAR(100) PRIMARY KEY,
+    started_at TIMESTAMP NOT NULL,
+    finished_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    matched integer NOT NULL DEFAULT 0
+);
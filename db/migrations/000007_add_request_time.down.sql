@@ -0,0 +1,2 @@
+ALTER TABLE passengers DROP COLUMN IF EXISTS requested_at;
+ALTER TABLE trips DROP COLUMN IF EXISTS requested_at;
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE passengers ADD COLUMN IF NOT EXISTS requested_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP;
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS requested_at TIMESTAMP;
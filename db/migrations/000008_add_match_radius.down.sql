@@ -0,0 +1,2 @@
+ALTER TABLE passengers DROP COLUMN IF EXISTS match_radius;
+DROP TABLE IF EXISTS notifications;
\ No newline at end of file
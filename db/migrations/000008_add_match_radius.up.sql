@@ -0,0 +1,9 @@
+ALTER TABLE passengers ADD COLUMN IF NOT EXISTS match_radius integer NOT NULL DEFAULT 5;
+CREATE TABLE IF NOT EXISTS notifications(
+    id SERIAL PRIMARY KEY,
+    passenger_id integer NOT NULL,
+    message TEXT NOT NULL,
+    delivered BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS notifications_passenger_idx ON notifications (passenger_id, delivered);
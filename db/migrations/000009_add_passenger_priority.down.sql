@@ -0,0 +1 @@
+ALTER TABLE passengers DROP COLUMN IF EXISTS priority;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE passengers ADD COLUMN IF NOT EXISTS priority BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS route_stops;
+ALTER TABLE trips DROP COLUMN IF EXISTS fare;
+ALTER TABLE trips DROP COLUMN IF EXISTS pooled;
+ALTER TABLE passengers DROP COLUMN IF EXISTS pooled;
\ No newline at end of file
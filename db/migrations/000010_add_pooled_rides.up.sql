@@ -0,0 +1,15 @@
+ALTER TABLE passengers ADD COLUMN IF NOT EXISTS pooled BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS pooled BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS fare real;
+CREATE TABLE IF NOT EXISTS route_stops(
+    id SERIAL PRIMARY KEY,
+    driver_id integer NOT NULL,
+    trip_id VARCHAR(100) NOT NULL,
+    passenger_id integer NOT NULL,
+    kind VARCHAR(10) NOT NULL CHECK (kind IN ('pickup', 'drop')),
+    loc integer NOT NULL,
+    seq integer NOT NULL,
+    done BOOLEAN NOT NULL DEFAULT FALSE,
+    UNIQUE (trip_id, kind)
+);
+CREATE INDEX IF NOT EXISTS route_stops_driver_idx ON route_stops (driver_id, seq);
@@ -0,0 +1,4 @@
+ALTER TABLE trips DROP COLUMN IF EXISTS ride_class;
+ALTER TABLE passengers DROP COLUMN IF EXISTS needs_accessible;
+ALTER TABLE passengers DROP COLUMN IF EXISTS ride_class;
+DROP TABLE IF EXISTS vehicles;
\ No newline at end of file
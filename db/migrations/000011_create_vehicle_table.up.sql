@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS vehicles(
+    id SERIAL PRIMARY KEY,
+    driver_id integer NOT NULL UNIQUE,
+    plate VARCHAR(20) NOT NULL UNIQUE,
+    seats integer NOT NULL CHECK (seats > 0),
+    class VARCHAR(20) NOT NULL CHECK (class IN ('economy', 'xl', 'premium')),
+    wheelchair_accessible BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+ALTER TABLE passengers ADD COLUMN IF NOT EXISTS ride_class VARCHAR(20) NOT NULL DEFAULT 'economy';
+ALTER TABLE passengers ADD COLUMN IF NOT EXISTS needs_accessible BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS ride_class VARCHAR(20) NOT NULL DEFAULT 'economy';
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS passenger_blocks;
+DROP TABLE IF EXISTS driver_preferences;
\ No newline at end of file
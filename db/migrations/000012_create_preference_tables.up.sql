@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS driver_preferences(
+    driver_id integer PRIMARY KEY,
+    home_loc integer,
+    max_pickup_distance integer NOT NULL DEFAULT 0 CHECK (max_pickup_distance >= 0),
+    min_passenger_rating real NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE IF NOT EXISTS passenger_blocks(
+    passenger_id integer NOT NULL,
+    driver_id integer NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (passenger_id, driver_id)
+);
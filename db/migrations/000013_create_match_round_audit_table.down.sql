@@ -0,0 +1 @@
+DROP TABLE IF EXISTS match_round_audits;
\ No newline at end of file
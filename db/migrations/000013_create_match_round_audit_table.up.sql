@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS match_round_audits(
+    round_id VARCHAR(100) PRIMARY KEY,
+    solver VARCHAR(50) NOT NULL,
+    passengers JSONB NOT NULL,
+    drivers JSONB NOT NULL,
+    costs JSONB NOT NULL,
+    assignments JSONB NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,4 @@
+ALTER TABLE trips DROP COLUMN IF EXISTS aborted_at;
+ALTER TABLE trips DROP COLUMN IF EXISTS payment_voided_at;
+ALTER TABLE trips DROP COLUMN IF EXISTS paid_at;
+ALTER TABLE trips DROP COLUMN IF EXISTS paid;
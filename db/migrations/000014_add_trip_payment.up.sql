@@ -0,0 +1,4 @@
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS paid real;
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS paid_at TIMESTAMP;
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS payment_voided_at TIMESTAMP;
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS aborted_at TIMESTAMP;
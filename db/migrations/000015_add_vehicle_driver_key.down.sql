@@ -0,0 +1 @@
+ALTER TABLE vehicles DROP CONSTRAINT IF EXISTS vehicles_driver_id_fkey;
@@ -0,0 +1,2 @@
+DELETE FROM vehicles WHERE driver_id NOT IN (SELECT id FROM drivers);
+ALTER TABLE vehicles ADD CONSTRAINT vehicles_driver_id_fkey FOREIGN KEY (driver_id) REFERENCES drivers(id) ON DELETE CASCADE;
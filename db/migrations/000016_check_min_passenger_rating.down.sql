@@ -0,0 +1 @@
+ALTER TABLE driver_preferences DROP CONSTRAINT IF EXISTS driver_preferences_min_passenger_rating_check;
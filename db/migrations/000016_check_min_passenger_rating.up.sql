@@ -0,0 +1,2 @@
+UPDATE driver_preferences SET min_passenger_rating=0 WHERE min_passenger_rating < 0;
+ALTER TABLE driver_preferences ADD CONSTRAINT driver_preferences_min_passenger_rating_check CHECK (min_passenger_rating >= 0);
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"easyRide/config"
+	"easyRide/temporalclient"
+	"flag"
+	"github.com/gogo/protobuf/jsonpb"
+	enumspb "go.temporal.io/api/enums/v1"
+	historypb "go.temporal.io/api/history/v1"
+	"log"
+	"os"
+)
+
+// history exports the history of a workflow for the replay tests, which run every history of
+// workflows/testdata/histories against the current code. Export a history for each path a running version of a
+// workflow can take before changing its commands.
+//
+//	go run ./history -workflow <workflow ID> -out workflows/testdata/histories/main_workflow_no_show.json
+func main() {
+	workflowID := flag.String("workflow", "", "ID of the workflow")
+	runID := flag.String("run", "", "run of the workflow, the latest when empty")
+	out := flag.String("out", "", "file the history is written to, the standard output when empty")
+	cfg, err := config.Load(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		log.Fatalln("Invalid configuration", err)
+	}
+	if *workflowID == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	c, err := temporalclient.Dial(cfg.Temporal.Options())
+	if err != nil {
+		log.Fatalln("Unable to create client", err)
+	}
+	defer c.Close()
+
+	var history historypb.History
+	iter := c.GetWorkflowHistory(context.Background(), *workflowID, *runID, false,
+		enumspb.HISTORY_EVENT_FILTER_TYPE_ALL_EVENT)
+	for iter.HasNext() {
+		event, err := iter.Next()
+		if err != nil {
+			log.Fatalln("Cannot fetch the history", err)
+		}
+		history.Events = append(history.Events, event)
+	}
+	if n := len(history.Events); n == 0 || !closed(history.Events[n-1].GetEventType()) {
+		// the replay of a running workflow checks nothing past its last workflow task
+		log.Println("The workflow is still running, the history is partial")
+	}
+
+	var buf bytes.Buffer
+	if err := (&jsonpb.Marshaler{Indent: "  "}).Marshal(&buf, &history); err != nil {
+		log.Fatalln(err)
+	}
+	buf.WriteByte('\n')
+	if *out == "" {
+		os.Stdout.Write(buf.Bytes())
+		return
+	}
+	if err := os.WriteFile(*out, buf.Bytes(), 0644); err != nil {
+		log.Fatalln(err)
+	}
+	log.Println("Exported", len(history.Events), "events to", *out)
+}
+
+// closed tells whether the event ends the workflow run.
+func closed(eventType enumspb.EventType) bool {
+	switch eventType {
+	case enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_COMPLETED,
+		enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_FAILED,
+		enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_TIMED_OUT,
+		enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_CANCELED,
+		enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_TERMINATED,
+		enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_CONTINUED_AS_NEW:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"bytes"
+	"easyRide/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Config of a load test.
+type Config struct {
+	// URL of the client API
+	URL        string
+	Passengers int
+	Drivers    int
+	// Rate is the number of trips started per second, Duration how long trips are started for
+	Rate     float64
+	Duration time.Duration
+	// IDBase is the first ID of the users signed up, each run against the same database needs its own
+	IDBase   int
+	CitySize int
+	// StepDelay stands for the driving between two steps of a trip
+	StepDelay time.Duration
+	// Poll is the interval of the trip status queries, TripTimeout the longest a trip is followed
+	Poll        time.Duration
+	TripTimeout time.Duration
+	Seed        int64
+}
+
+// DefaultConfig runs against the client and the workers on their local default ports.
+var DefaultConfig = Config{
+	URL:         "http://localhost:3310",
+	Passengers:  20,
+	Drivers:     20,
+	Rate:        1,
+	Duration:    time.Minute,
+	IDBase:      100000,
+	CitySize:    200,
+	StepDelay:   time.Second,
+	Poll:        500 * time.Millisecond,
+	TripTimeout: 5 * time.Minute,
+	Seed:        1,
+}
+
+// loadPassword is the password of every user signed up by the load test.
+const loadPassword = "load-test"
+
+var (
+	errMatchTimeout = errors.New("no driver found")
+	errTripTimeout  = errors.New("trip not completed in time")
+)
+
+// Report sums up a load test.
+type Report struct {
+	Endpoints []EndpointStats `json:"endpoints"`
+	// TimeToMatch is from the trip request to the driver showing in the trip status, TripTime to the trip completed
+	TimeToMatch Latency `json:"time_to_match"`
+	TripTime    Latency `json:"trip_time"`
+	Trips       int     `json:"trips"`
+	Completed   int     `json:"completed"`
+	Unmatched   int     `json:"unmatched"`
+	// Failed trips by the error that stopped them
+	Failed map[string]int `json:"failed"`
+	// Skipped trips found no idle passenger at their start time
+	Skipped int `json:"skipped"`
+	// Rate is the rate of the trips actually started, per second
+	Rate float64 `json:"rate"`
+}
+
+// EndpointStats are the calls to an endpoint.
+type EndpointStats struct {
+	Endpoint string `json:"endpoint"`
+	Latency
+	// Errors counts the calls that failed or did not answer 2xx
+	Errors int `json:"errors"`
+}
+
+// Latency sums up durations.
+type Latency struct {
+	Count int           `json:"count"`
+	P50   time.Duration `json:"p50"`
+	P90   time.Duration `json:"p90"`
+	P99   time.Duration `json:"p99"`
+	Max   time.Duration `json:"max"`
+}
+
+func summarize(samples []time.Duration) Latency {
+	if len(samples) == 0 {
+		return Latency{}
+	}
+	sorted := append([]time.Duration(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	at := func(p float64) time.Duration {
+		rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+		if rank < 0 {
+			rank = 0
+		}
+		return sorted[rank]
+	}
+	return Latency{Count: len(sorted), P50: at(0.5), P90: at(0.9), P99: at(0.99), Max: sorted[len(sorted)-1]}
+}
+
+// recorder collects the measures of the concurrent users.
+type recorder struct {
+	mu          sync.Mutex
+	calls       map[string][]time.Duration
+	errors      map[string]int
+	timeToMatch []time.Duration
+	tripTime    []time.Duration
+	trips       int
+	completed   int
+	unmatched   int
+	failed      map[string]int
+	skipped     int
+}
+
+func newRecorder() *recorder {
+	return &recorder{calls: make(map[string][]time.Duration), errors: make(map[string]int), failed: make(map[string]int)}
+}
+
+func (r *recorder) call(endpoint string, latency time.Duration, ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls[endpoint] = append(r.calls[endpoint], latency)
+	if !ok {
+		r.errors[endpoint]++
+	}
+}
+
+func (r *recorder) matched(timeToMatch time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.timeToMatch = append(r.timeToMatch, timeToMatch)
+}
+
+// trip records how a trip ended, err is nil for a completed trip.
+func (r *recorder) trip(err error, tripTime time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch {
+	case err == nil:
+		r.completed++
+		r.tripTime = append(r.tripTime, tripTime)
+	case errors.Is(err, errMatchTimeout):
+		r.unmatched++
+	default:
+		r.failed[err.Error()]++
+	}
+}
+
+func (r *recorder) report(elapsed time.Duration) Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rep := Report{
+		TimeToMatch: summarize(r.timeToMatch),
+		TripTime:    summarize(r.tripTime),
+		Trips:       r.trips,
+		Completed:   r.completed,
+		Unmatched:   r.unmatched,
+		Failed:      r.failed,
+		Skipped:     r.skipped,
+	}
+	if elapsed > 0 {
+		rep.Rate = float64(r.trips) / elapsed.Seconds()
+	}
+	for endpoint, latencies := range r.calls {
+		rep.Endpoints = append(rep.Endpoints, EndpointStats{Endpoint: endpoint, Latency: summarize(latencies),
+			Errors: r.errors[endpoint]})
+	}
+	sort.Slice(rep.Endpoints, func(i, j int) bool { return rep.Endpoints[i].Endpoint < rep.Endpoints[j].Endpoint })
+	return rep
+}
+
+// api calls the client API and times the calls.
+type api struct {
+	url  string
+	http *http.Client
+	rec  *recorder
+}
+
+// call posts the body to the path and decodes the answer into out when given. The latency is recorded under the
+// endpoint, the route of the path.
+func (a *api) call(endpoint, path string, body interface{}, out interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	resp, err := a.http.Post(a.url+path, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		a.rec.call(endpoint, time.Since(start), false)
+		return fmt.Errorf("%s: %w", endpoint, err)
+	}
+	defer resp.Body.Close()
+	msg, err := io.ReadAll(resp.Body)
+	latency := time.Since(start)
+	ok := err == nil && resp.StatusCode/100 == 2
+	a.rec.call(endpoint, latency, ok)
+	if err != nil {
+		return fmt.Errorf("%s: %w", endpoint, err)
+	}
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s: status %d", endpoint, resp.StatusCode)
+	}
+	if out != nil {
+		return json.Unmarshal(msg, out)
+	}
+	return nil
+}
+
+func credentials(role string, id int) models.Credentials {
+	return models.Credentials{ID: id, Username: fmt.Sprintf("load-%s-%d", role, id), Password: loadPassword}
+}
+
+// signUp registers the user, a user left by a previous run with the same IDs is logged in as it is.
+func (a *api) signUp(role string, id int) error {
+	creds := credentials(role, id)
+	signUpErr := a.call("/"+role+"/signup", "/"+role+"/signup", creds, nil)
+	if err := a.call("/"+role+"/login", "/"+role+"/login", creds, nil); err != nil {
+		if signUpErr != nil {
+			return signUpErr
+		}
+		return err
+	}
+	return nil
+}
+
+// startDriver signs the driver up, starts the shift and makes the driver available.
+func (a *api) startDriver(id, loc int) error {
+	if err := a.signUp("driver", id); err != nil {
+		return err
+	}
+	return a.call("/driver/start-work", "/driver/start-work", models.DriverRequestBody{ID: id, Loc: loc}, nil)
+}
+
+// status polls the trip status until done accepts it.
+func (a *api) status(id int, poll time.Duration, deadline time.Time,
+	done func(models.TripStatus) bool) (models.TripStatus, error) {
+	for {
+		var status models.TripStatus
+		err := a.call("/passenger/status", "/passenger/status", models.PassengerRequestBody{ID: id}, &status)
+		if err == nil && done(status) {
+			return status, nil
+		}
+		if time.Now().After(deadline) {
+			return status, errTripTimeout
+		}
+		time.Sleep(poll)
+	}
+}
+
+// trip runs a trip of the passenger from the request to the rating, the matched driver playing along.
+func (a *api) trip(cfg Config, id int, pickup, drop int) error {
+	start := time.Now()
+	deadline := start.Add(cfg.TripTimeout)
+	// the login starts the session the trip runs in, or attaches to it
+	if err := a.call("/passenger/login", "/passenger/login", credentials("passenger", id), nil); err != nil {
+		return err
+	}
+	request := models.PassengerRequestBody{ID: id, PickupLoc: pickup, DropLoc: drop}
+	requested := time.Now()
+	if err := a.call("/passenger/start-trip", "/passenger/start-trip", request, nil); err != nil {
+		return err
+	}
+	status, err := a.status(id, cfg.Poll, deadline, func(s models.TripStatus) bool {
+		return s.DriverID > 0 || s.Stage == models.StageMatchTimeout
+	})
+	if err != nil {
+		return err
+	}
+	if status.DriverID == 0 {
+		return errMatchTimeout
+	}
+	a.rec.matched(time.Since(requested))
+
+	driver := models.DriverRequestBody{ID: status.DriverID}
+	steps := []struct {
+		path  string
+		delay time.Duration
+	}{
+		{"/driver/confirm-trip", 0},
+		{"/driver/arrived-pickup", cfg.StepDelay},
+		{"/driver/start-trip", 0},
+		{"/driver/arrived", cfg.StepDelay},
+	}
+	for _, step := range steps {
+		time.Sleep(step.delay)
+		if err := a.call(step.path, step.path, driver, nil); err != nil {
+			return err
+		}
+	}
+	rating := models.RatingRequestBody{ID: status.DriverID}
+	if err := a.call("/driver/rating/{rating}", "/driver/rating/5", rating, nil); err != nil {
+		return err
+	}
+	// pay enough for any ride class
+	pay := models.Fare(models.ClassPremium, math.Abs(float64(drop-pickup))) + 1
+	if err := a.call("/passenger/payment/{pay}", fmt.Sprintf("/passenger/payment/%.2f", pay), request, nil); err != nil {
+		return err
+	}
+	if err := a.call("/passenger/rating/{rating}", "/passenger/rating/5", models.RatingRequestBody{ID: id}, nil); err != nil {
+		return err
+	}
+	if _, err := a.status(id, cfg.Poll, deadline, func(s models.TripStatus) bool {
+		return s.Stage == models.StageCompleted
+	}); err != nil {
+		return err
+	}
+	return a.call("/passenger/end-trip", "/passenger/end-trip", request, nil)
+}
+
+// Run signs up the drivers and the passengers, then starts trips at the configured rate with the idle passengers,
+// and waits for the trips started to end.
+func Run(cfg Config) (Report, error) {
+	rec := newRecorder()
+	a := &api{url: cfg.URL, http: &http.Client{Timeout: 30 * time.Second}, rec: rec}
+	rnd := rand.New(rand.NewSource(cfg.Seed))
+
+	var wg sync.WaitGroup
+	setupErrs := make(chan error, cfg.Drivers+cfg.Passengers)
+	for i := 0; i < cfg.Drivers; i++ {
+		id, loc := cfg.IDBase+i, rnd.Intn(cfg.CitySize)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := a.startDriver(id, loc); err != nil {
+				setupErrs <- err
+			}
+		}()
+	}
+	idle := make(chan int, cfg.Passengers)
+	for i := 0; i < cfg.Passengers; i++ {
+		id := cfg.IDBase + i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := a.call("/passenger/signup", "/passenger/signup", credentials("passenger", id), nil); err != nil {
+				// a passenger left by a previous run logs in with each trip as well
+				setupErrs <- err
+			}
+			idle <- id
+		}()
+	}
+	wg.Wait()
+	close(setupErrs)
+	if users := cfg.Drivers + cfg.Passengers; users > 0 && len(setupErrs) == users {
+		return rec.report(0), fmt.Errorf("every user failed to sign up: %w", <-setupErrs)
+	}
+
+	start := time.Now()
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / cfg.Rate))
+	defer ticker.Stop()
+	for time.Since(start) < cfg.Duration {
+		<-ticker.C
+		select {
+		case id := <-idle:
+			pickup := rnd.Intn(cfg.CitySize)
+			drop := rnd.Intn(cfg.CitySize)
+			rec.mu.Lock()
+			rec.trips++
+			rec.mu.Unlock()
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				tripStart := time.Now()
+				err := a.trip(cfg, id, pickup, drop)
+				rec.trip(err, time.Since(tripStart))
+				idle <- id
+			}()
+		default:
+			rec.mu.Lock()
+			rec.skipped++
+			rec.mu.Unlock()
+		}
+	}
+	elapsed := time.Since(start)
+	wg.Wait()
+
+	// the shifts would otherwise run until their end
+	for i := 0; i < cfg.Drivers; i++ {
+		a.call("/driver/end-work", "/driver/end-work", models.DriverRequestBody{ID: cfg.IDBase + i}, nil)
+	}
+	return rec.report(elapsed), nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"easyRide/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSummarize(t *testing.T) {
+	assert.Equal(t, Latency{}, summarize(nil))
+
+	var samples []time.Duration
+	for i := 100; i >= 1; i-- {
+		samples = append(samples, time.Duration(i)*time.Millisecond)
+	}
+	l := summarize(samples)
+	assert.Equal(t, 100, l.Count)
+	assert.Equal(t, 50*time.Millisecond, l.P50)
+	assert.Equal(t, 90*time.Millisecond, l.P90)
+	assert.Equal(t, 99*time.Millisecond, l.P99)
+	assert.Equal(t, 100*time.Millisecond, l.Max)
+	assert.Equal(t, 100*time.Millisecond, samples[0], "the samples are not sorted in place")
+}
+
+func TestRecorderReport(t *testing.T) {
+	rec := newRecorder()
+	rec.call("/b", time.Millisecond, true)
+	rec.call("/a", 2*time.Millisecond, false)
+	rec.call("/a", 4*time.Millisecond, true)
+	rec.trips = 4
+	rec.trip(nil, time.Second)
+	rec.trip(errMatchTimeout, time.Second)
+	rec.trip(errTripTimeout, time.Second)
+	rec.trip(errTripTimeout, time.Second)
+
+	rep := rec.report(2 * time.Second)
+	assert.Equal(t, 2.0, rep.Rate)
+	assert.Equal(t, 1, rep.Completed)
+	assert.Equal(t, 1, rep.Unmatched)
+	assert.Equal(t, map[string]int{errTripTimeout.Error(): 2}, rep.Failed)
+	assert.Equal(t, 1, rep.TripTime.Count)
+	if assert.Len(t, rep.Endpoints, 2) {
+		assert.Equal(t, "/a", rep.Endpoints[0].Endpoint)
+		assert.Equal(t, 2, rep.Endpoints[0].Count)
+		assert.Equal(t, 1, rep.Endpoints[0].Errors)
+		assert.Equal(t, 4*time.Millisecond, rep.Endpoints[0].Max)
+	}
+}
+
+// fakeClient answers like the client API, matching each trip with the driver of the passenger's ID plus 1000 and
+// completing it once the passenger paid.
+type fakeClient struct {
+	mu    sync.Mutex
+	paid  map[int]bool
+	calls map[string]int
+}
+
+func (f *fakeClient) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	path := r.URL.Path
+	if strings.HasPrefix(path, "/passenger/payment/") {
+		var body models.PassengerRequestBody
+		json.NewDecoder(r.Body).Decode(&body)
+		f.paid[body.ID] = true
+		path = "/passenger/payment/{pay}"
+	}
+	f.calls[path]++
+	if path == "/passenger/status" {
+		var body models.PassengerRequestBody
+		json.NewDecoder(r.Body).Decode(&body)
+		status := models.TripStatus{Stage: models.StagePickup, DriverID: body.ID + 1000}
+		if f.paid[body.ID] {
+			status.Stage = models.StageCompleted
+		}
+		json.NewEncoder(w).Encode(status)
+	}
+}
+
+func TestRun(t *testing.T) {
+	fake := &fakeClient{paid: make(map[int]bool), calls: make(map[string]int)}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	cfg := DefaultConfig
+	cfg.URL = server.URL
+	cfg.Passengers, cfg.Drivers = 2, 2
+	cfg.Rate = 50
+	cfg.Duration = 100 * time.Millisecond
+	cfg.StepDelay, cfg.Poll = 0, time.Millisecond
+	cfg.TripTimeout = 10 * time.Second
+
+	rep, err := Run(cfg)
+	assert.NoError(t, err)
+	assert.Positive(t, rep.Trips)
+	assert.Equal(t, rep.Trips, rep.Completed)
+	assert.Empty(t, rep.Failed)
+	assert.Equal(t, rep.Trips, rep.TimeToMatch.Count)
+	for _, e := range rep.Endpoints {
+		assert.Zero(t, e.Errors, e.Endpoint)
+	}
+	assert.Equal(t, 2, fake.calls["/driver/start-work"])
+	assert.Equal(t, 2, fake.calls["/driver/end-work"])
+	assert.Equal(t, rep.Trips, fake.calls["/passenger/payment/{pay}"])
+	assert.Equal(t, rep.Trips, fake.calls["/passenger/end-trip"])
+}
+
+func TestRunUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	cfg := DefaultConfig
+	cfg.URL = server.URL
+	cfg.Passengers, cfg.Drivers = 1, 1
+
+	_, err := Run(cfg)
+	assert.Error(t, err)
+}
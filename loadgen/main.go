@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// loadgen drives passengers and drivers through the client API and prints the latencies it measured. The client and
+// the workers must be running.
+//
+//	go run ./loadgen -passengers 50 -drivers 50 -rate 2 -duration 5m
+func main() {
+	cfg := DefaultConfig
+	flag.StringVar(&cfg.URL, "url", cfg.URL, "URL of the client API")
+	flag.IntVar(&cfg.Passengers, "passengers", cfg.Passengers, "number of passengers signed up")
+	flag.IntVar(&cfg.Drivers, "drivers", cfg.Drivers, "number of drivers signed up")
+	flag.Float64Var(&cfg.Rate, "rate", cfg.Rate, "trips started per second")
+	flag.DurationVar(&cfg.Duration, "duration", cfg.Duration, "how long trips are started for")
+	flag.IntVar(&cfg.IDBase, "id-base", cfg.IDBase, "first ID of the users signed up")
+	flag.IntVar(&cfg.CitySize, "city", cfg.CitySize, "number of locations of the city")
+	flag.DurationVar(&cfg.StepDelay, "step-delay", cfg.StepDelay, "time the driver takes between two steps of a trip")
+	flag.DurationVar(&cfg.Poll, "poll", cfg.Poll, "interval of the trip status queries")
+	flag.DurationVar(&cfg.TripTimeout, "trip-timeout", cfg.TripTimeout, "longest a trip is followed")
+	flag.Int64Var(&cfg.Seed, "seed", cfg.Seed, "seed of the random locations")
+	asJSON := flag.Bool("json", false, "print the report as JSON")
+	flag.Parse()
+
+	if cfg.Rate <= 0 || cfg.CitySize <= 0 || cfg.Poll <= 0 || cfg.Passengers < 0 || cfg.Drivers < 0 {
+		log.Fatalln("The rate, the city and the poll interval must be positive, the passengers and drivers not negative")
+	}
+
+	rep, err := Run(cfg)
+	if err != nil {
+		log.Fatalln("Load test failed", err)
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(rep); err != nil {
+			log.Fatalln(err)
+		}
+		return
+	}
+	fmt.Printf("trips %d (%.2f/s), completed %d, unmatched %d, skipped %d\n",
+		rep.Trips, rep.Rate, rep.Completed, rep.Unmatched, rep.Skipped)
+	for reason, count := range rep.Failed {
+		fmt.Printf("  failed %d: %s\n", count, reason)
+	}
+	fmt.Printf("%-28s %7s %6s %9s %9s %9s %9s\n", "endpoint", "calls", "errors", "p50", "p90", "p99", "max")
+	for _, e := range rep.Endpoints {
+		fmt.Printf("%-28s %7d %6d %9s %9s %9s %9s\n", e.Endpoint, e.Count, e.Errors,
+			ms(e.P50), ms(e.P90), ms(e.P99), ms(e.Max))
+	}
+	printLatency("time to match", rep.TimeToMatch)
+	printLatency("trip time", rep.TripTime)
+}
+
+func printLatency(name string, l Latency) {
+	fmt.Printf("%-28s %7d %6s %9s %9s %9s %9s\n", name, l.Count, "", ms(l.P50), ms(l.P90), ms(l.P99), ms(l.Max))
+}
+
+// ms rounds a latency for the report
+func ms(d time.Duration) string {
+	return d.Round(time.Millisecond).String()
+}
@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// RoundAudit is what a match round saw and decided, kept to explain and replay the round.
+type RoundAudit struct {
+	RoundID string `json:"round_id"`
+	Solver  string `json:"solver"`
+	// Passengers and Drivers are the rows and the columns of the cost matrix, their passwords cleared
+	Passengers []Passenger `json:"passengers"`
+	Drivers    []Driver    `json:"drivers"`
+	Costs      [][]float64 `json:"costs"`
+	// Assignments is the column of the driver assigned to each passenger, -1 when unassigned
+	Assignments []int     `json:"assignments"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// NewRoundAudit snapshots a round, without the passwords of its passengers and drivers.
+func NewRoundAudit(roundID, solver string, passengers []Passenger, drivers []Driver, costs [][]float64,
+	assignments []int) RoundAudit {
+	audit := RoundAudit{
+		RoundID:     roundID,
+		Solver:      solver,
+		Passengers:  make([]Passenger, len(passengers)),
+		Drivers:     make([]Driver, len(drivers)),
+		Costs:       costs,
+		Assignments: assignments,
+	}
+	for i, p := range passengers {
+		p.Password = ""
+		audit.Passengers[i] = p
+	}
+	for j, d := range drivers {
+		d.Password = ""
+		audit.Drivers[j] = d
+	}
+	return audit
+}
+
+// DriverOf returns the ID of the driver assigned to the passenger at row i, 0 when unassigned.
+func (a *RoundAudit) DriverOf(i int) int {
+	if i >= len(a.Assignments) || a.Assignments[i] < 0 || a.Assignments[i] >= len(a.Drivers) {
+		return 0
+	}
+	return a.Drivers[a.Assignments[i]].ID
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestNewRoundAudit(t *testing.T) {
+	passengers := []Passenger{{ID: 1, Password: "secret"}, {ID: 2, Password: "secret"}}
+	drivers := []Driver{{ID: 11, Password: "secret"}}
+	audit := NewRoundAudit("round-1", "hungarian", passengers, drivers, [][]float64{{0.5}, {0.1}}, []int{-1, 0})
+
+	assert.Empty(t, audit.Passengers[0].Password)
+	assert.Empty(t, audit.Drivers[0].Password)
+	// the round's own lists are left as they are
+	assert.Equal(t, "secret", passengers[0].Password)
+	assert.Equal(t, 0, audit.DriverOf(0))
+	assert.Equal(t, 11, audit.DriverOf(1))
+	assert.Equal(t, 0, audit.DriverOf(2))
+}
@@ -13,6 +13,17 @@ type Passenger struct {
 	InRide     bool    `json:"in_ride"`
 	WithDriver int     `json:"with_driver"`
 	CreatedAt  string  `json:"created_at"`
+	// RequestedAt is when the passenger requested the current trip
+	RequestedAt string `json:"requested_at"`
+	// MatchRadius is the farthest a driver can be from the pickup location, 0 means no limit
+	MatchRadius int `json:"match_radius"`
+	// Pooled is set when the passenger accepts to share the ride with other riders
+	Pooled bool `json:"pooled"`
+	// RideClass is the class of ride asked for, NeedsAccessible asks for a wheelchair accessible vehicle
+	RideClass       RideClass `json:"ride_class"`
+	NeedsAccessible bool      `json:"needs_accessible"`
+	// BlockedDrivers are never matched with the passenger
+	BlockedDrivers []int64 `json:"blocked_drivers"`
 }
 
 type PassengerList struct {
@@ -39,6 +50,9 @@ type Driver struct {
 	Rating        float64 `json:"rating"`
 	WithPassenger int     `json:"with_passenger"`
 	LastTripEndAt string  `json:"last_trip_end_at"`
+	Vehicle       Vehicle `json:"vehicle"`
+	// Preferences are the driver's constraints on the trips offered
+	Preferences DriverPreferences `json:"preferences"`
 }
 
 type DriverList struct {
@@ -50,6 +64,7 @@ func (d *Driver) Init(name string, loc int, rating float64, lastTripEndAt string
 	d.Loc = loc
 	d.Rating = rating
 	d.LastTripEndAt = lastTripEndAt
+	d.Vehicle = DefaultVehicle
 }
 
 type Credentials struct {
@@ -63,6 +78,10 @@ type PassengerRequestBody struct {
 	ID        int    `json:"id"`
 	PickupLoc int    `json:"pick_up_loc"`
 	DropLoc   int    `json:"drop_loc"`
+	Pooled    bool   `json:"pooled"`
+	// RideClass defaults to economy
+	RideClass       RideClass `json:"ride_class"`
+	NeedsAccessible bool      `json:"needs_accessible"`
 }
 
 type DriverRequestBody struct {
@@ -70,3 +89,31 @@ type DriverRequestBody struct {
 	ID   int    `json:"id"`
 	Loc  int    `json:"loc"`
 }
+
+// Driver shift states
+
+type DriverState string
+
+const (
+	DriverOffline   DriverState = "offline"
+	DriverAvailable DriverState = "available"
+	DriverOffered   DriverState = "offered"
+	DriverEnRoute   DriverState = "en_route_to_pickup"
+	DriverOnTrip    DriverState = "on_trip"
+	DriverOnBreak   DriverState = "on_break"
+)
+
+// DriverStateChange asks the driver's shift workflow to move to a new state.
+type DriverStateChange struct {
+	State       DriverState `json:"state"`
+	Loc         int         `json:"loc"`
+	PassengerID int         `json:"passenger_id"`
+}
+
+// MatchEngineStatus reports the matching cron to the admins.
+type MatchEngineStatus struct {
+	Running     bool   `json:"running"`
+	Interval    string `json:"interval"`
+	LastRoundAt string `json:"last_round_at"`
+	LastMatched int    `json:"last_matched"`
+}
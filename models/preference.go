@@ -0,0 +1,60 @@
+package models
+
+import "math"
+
+// Matching preference data model
+
+// DriverPreferences are the hard constraints a driver puts on the trips offered. Zero values set no constraint.
+type DriverPreferences struct {
+	DriverID int `json:"driver_id"`
+	// HomeLoc, when set, only lets through the trips dropping the passenger closer to it than the driver is
+	HomeLoc *int `json:"home_loc,omitempty"`
+	// MaxPickupDistance is the farthest the driver drives to a pickup
+	MaxPickupDistance int `json:"max_pickup_distance"`
+	// MinPassengerRating is the lowest passenger rating accepted
+	MinPassengerRating float64 `json:"min_passenger_rating"`
+}
+
+// Valid tells whether the preferences can be met: no negative distance or rating, and no rating above MaxRating.
+func (pref *DriverPreferences) Valid() bool {
+	return pref.MaxPickupDistance >= 0 && pref.MinPassengerRating >= 0 && pref.MinPassengerRating <= MaxRating
+}
+
+// Allows tells whether the driver at driverLoc accepts to take the passenger.
+func (pref *DriverPreferences) Allows(p *Passenger, driverLoc int) bool {
+	if pref.MaxPickupDistance > 0 && math.Abs(float64(p.PickupLoc-driverLoc)) > float64(pref.MaxPickupDistance) {
+		return false
+	}
+	if p.Rating < pref.MinPassengerRating {
+		return false
+	}
+	if pref.HomeLoc != nil {
+		home := *pref.HomeLoc
+		if math.Abs(float64(p.DropLoc-home)) >= math.Abs(float64(driverLoc-home)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Blocks tells whether the passenger blocked the driver.
+func (p *Passenger) Blocks(driverID int) bool {
+	for _, id := range p.BlockedDrivers {
+		if int(id) == driverID {
+			return true
+		}
+	}
+	return false
+}
+
+type DriverPreferencesRequestBody struct {
+	ID                 int     `json:"id"`
+	HomeLoc            *int    `json:"home_loc,omitempty"`
+	MaxPickupDistance  int     `json:"max_pickup_distance"`
+	MinPassengerRating float64 `json:"min_passenger_rating"`
+}
+
+type BlockRequestBody struct {
+	ID       int `json:"id"`
+	DriverID int `json:"driver_id"`
+}
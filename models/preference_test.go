@@ -0,0 +1,38 @@
+package models
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDriverPreferencesAllows(t *testing.T) {
+	p := &Passenger{PickupLoc: 10, DropLoc: 30, Rating: 4.5}
+	none := DriverPreferences{}
+	assert.True(t, none.Allows(p, 0))
+
+	near := DriverPreferences{MaxPickupDistance: 5}
+	assert.True(t, near.Allows(p, 6))
+	assert.False(t, near.Allows(p, 4))
+
+	picky := DriverPreferences{MinPassengerRating: 4.8}
+	assert.False(t, picky.Allows(p, 10))
+
+	home := 40
+	homeBound := DriverPreferences{HomeLoc: &home}
+	assert.True(t, homeBound.Allows(p, 10))
+	assert.False(t, homeBound.Allows(p, 35))
+}
+
+func TestDriverPreferencesValid(t *testing.T) {
+	assert.True(t, (&DriverPreferences{}).Valid())
+	assert.True(t, (&DriverPreferences{MaxPickupDistance: 5, MinPassengerRating: MaxRating}).Valid())
+	assert.False(t, (&DriverPreferences{MaxPickupDistance: -1}).Valid())
+	assert.False(t, (&DriverPreferences{MinPassengerRating: -0.5}).Valid())
+	assert.False(t, (&DriverPreferences{MinPassengerRating: MaxRating + 1}).Valid())
+}
+
+func TestPassengerBlocks(t *testing.T) {
+	p := &Passenger{BlockedDrivers: []int64{3, 7}}
+	assert.True(t, p.Blocks(7))
+	assert.False(t, p.Blocks(4))
+}
@@ -0,0 +1,82 @@
+package models
+
+// Rating data model
+
+const (
+	MinRating = 1.0
+	MaxRating = 5.0
+	// DefaultRating is the rating of a new user, it is also the prior of the rating average.
+	DefaultRating = 5.0
+	// RatingWindow is the number of most recent trips counted in a user's rating.
+	RatingWindow = 50
+	// RatingPriorWeight is the number of virtual trips rated DefaultRating mixed into the average,
+	// so that a single bad trip cannot tank a new user.
+	RatingPriorWeight = 5
+)
+
+// Who gave the rating: a passenger rates the driver, a driver rates the passenger.
+const (
+	RaterPassenger = "passenger"
+	RaterDriver    = "driver"
+)
+
+// RatingState is where the rating window of a rater stands, a trip reports it for each rater asked to rate.
+type RatingState string
+
+const (
+	RatingOpen   RatingState = "open"
+	RatingRated  RatingState = "rated"
+	RatingMissed RatingState = "missed"
+)
+
+// RatingReply is how the trip took a rating signal, the client that sent the rating queries it by its request ID.
+type RatingReply string
+
+const (
+	// RatingPending is the reply to a rating the trip has not taken yet
+	RatingPending   RatingReply = ""
+	RatingAccepted  RatingReply = "accepted"
+	RatingInvalid   RatingReply = "invalid"
+	RatingDuplicate RatingReply = "duplicate"
+	// RatingEarly is a rating sent before the rater was asked to rate, RatingLate one sent after the window closed
+	RatingEarly RatingReply = "early"
+	RatingLate  RatingReply = "late"
+)
+
+type Rating struct {
+	ID          int      `json:"id"`
+	TripID      string   `json:"trip_id"`
+	Rater       string   `json:"rater"`
+	PassengerID int      `json:"passenger_id"`
+	DriverID    int      `json:"driver_id"`
+	Score       float64  `json:"rating"`
+	Feedback    string   `json:"feedback"`
+	Tags        []string `json:"tags"`
+	CreatedAt   string   `json:"created_at"`
+	// RequestID tells apart the rating signals of a trip, the reply to the signal is queried by it
+	RequestID string `json:"request_id,omitempty"`
+}
+
+type RatingRequestBody struct {
+	ID       int      `json:"id"`
+	Feedback string   `json:"feedback"`
+	Tags     []string `json:"tags"`
+}
+
+// ValidRating reports whether the score is within MinRating and MaxRating.
+func ValidRating(score float64) bool {
+	return score >= MinRating && score <= MaxRating
+}
+
+// AverageRating computes the Bayesian average of the most recent scores, the first
+// RatingWindow scores are used and RatingPriorWeight virtual trips at DefaultRating are added.
+func AverageRating(scores []float64) float64 {
+	if len(scores) > RatingWindow {
+		scores = scores[:RatingWindow]
+	}
+	sum := DefaultRating * RatingPriorWeight
+	for _, s := range scores {
+		sum += s
+	}
+	return sum / float64(RatingPriorWeight+len(scores))
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestAverageRating(t *testing.T) {
+	// a new user keeps the default rating
+	assert.Equal(t, DefaultRating, AverageRating(nil))
+
+	// one bad trip does not tank a new user
+	assert.InDelta(t, 26.0/6.0, AverageRating([]float64{1}), 1e-9)
+
+	// only the most recent RatingWindow trips are counted
+	scores := make([]float64, RatingWindow+10)
+	for i := range scores {
+		scores[i] = 4
+		if i >= RatingWindow {
+			scores[i] = 1
+		}
+	}
+	expected := (DefaultRating*RatingPriorWeight + 4*RatingWindow) / float64(RatingPriorWeight+RatingWindow)
+	assert.InDelta(t, expected, AverageRating(scores), 1e-9)
+}
+
+func TestValidRating(t *testing.T) {
+	assert.True(t, ValidRating(1))
+	assert.True(t, ValidRating(5))
+	assert.False(t, ValidRating(0))
+	assert.False(t, ValidRating(5.5))
+}
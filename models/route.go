@@ -0,0 +1,31 @@
+package models
+
+// Pooled ride data model
+
+// StopKind tells whether the driver picks a rider up or drops them off at a stop.
+type StopKind string
+
+const (
+	StopPickup StopKind = "pickup"
+	StopDrop   StopKind = "drop"
+)
+
+// Stop is a stop on the route of a driver carrying pooled riders.
+type Stop struct {
+	TripID      string   `json:"trip_id"`
+	PassengerID int      `json:"passenger_id"`
+	Kind        StopKind `json:"kind"`
+	Loc         int      `json:"loc"`
+	Done        bool     `json:"done"`
+}
+
+// PoolRoute is the route of a driver carrying pooled riders. The stops are in visiting order,
+// the ones already done come first.
+type PoolRoute struct {
+	DriverID  int     `json:"driver_id"`
+	DriverLoc int     `json:"driver_loc"`
+	Vehicle   Vehicle `json:"vehicle"`
+	// Preferences of the driver apply to the riders joining the route
+	Preferences DriverPreferences `json:"preferences"`
+	Stops       []Stop            `json:"stops"`
+}
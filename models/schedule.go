@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// Scheduled trip data model
+
+// ScheduleStatus is where a trip booked ahead stands.
+type ScheduleStatus string
+
+const (
+	ScheduleBooked     ScheduleStatus = "booked"
+	ScheduleDispatched ScheduleStatus = "dispatched"
+	ScheduleCancelled  ScheduleStatus = "cancelled"
+)
+
+// ScheduledTrip is a trip booked for a later pickup time.
+type ScheduledTrip struct {
+	PassengerID int            `json:"passenger_id"`
+	PickupLoc   int            `json:"pick_up_loc"`
+	DropLoc     int            `json:"drop_loc"`
+	PickupAt    time.Time      `json:"pickup_at"`
+	Status      ScheduleStatus `json:"status"`
+	// RideClass defaults to economy
+	RideClass       RideClass `json:"ride_class"`
+	NeedsAccessible bool      `json:"needs_accessible"`
+}
+
+type ScheduleRequestBody struct {
+	ID         int       `json:"id"`
+	ScheduleID string    `json:"schedule_id"`
+	PickupLoc  int       `json:"pick_up_loc"`
+	DropLoc    int       `json:"drop_loc"`
+	PickupAt   time.Time `json:"pickup_at"`
+	// RideClass defaults to economy
+	RideClass       RideClass `json:"ride_class"`
+	NeedsAccessible bool      `json:"needs_accessible"`
+}
@@ -0,0 +1,115 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Trip status data model
+
+// TripStage is where the passenger's trip stands.
+type TripStage string
+
+const (
+	StageMatching     TripStage = "matching"
+	StagePickup       TripStage = "pickup"
+	StageInTrip       TripStage = "in_trip"
+	StagePayment      TripStage = "payment"
+	StageRating       TripStage = "rating"
+	StageCompleted    TripStage = "completed"
+	StageNoShow       TripStage = "no_show"
+	StageDriverLate   TripStage = "driver_late"
+	StageMatchTimeout TripStage = "match_timeout"
+)
+
+// Match radius, in location units: the farthest a driver can be from the pickup location.
+// A passenger starts with InitialMatchRadius, the radius grows by MatchRadiusStep for each
+// MatchRadiusInterval the passenger has waited, up to MaxMatchRadius.
+const (
+	InitialMatchRadius = 5
+	MatchRadiusStep    = 5
+	MaxMatchRadius     = 50
+
+	MatchRadiusInterval = time.Minute
+)
+
+// MatchRadiusAfter is the match radius of a passenger who has waited that long for a driver, however often the
+// rounds run.
+func MatchRadiusAfter(waited time.Duration) int {
+	radius := InitialMatchRadius + MatchRadiusStep*int(waited/MatchRadiusInterval)
+	if radius > MaxMatchRadius {
+		return MaxMatchRadius
+	}
+	return radius
+}
+
+// TripStatus is reported to the passenger while the trip runs.
+type TripStatus struct {
+	Stage       TripStage `json:"stage"`
+	MatchRounds int       `json:"match_rounds"`
+	MatchRadius int       `json:"match_radius"`
+	DriverID    int       `json:"driver_id,omitempty"`
+	PickupETA   time.Time `json:"pickup_eta,omitempty"`
+	// Route lists the stops left on a pooled ride
+	Route []Stop `json:"route,omitempty"`
+	// Ratings holds the rating window of each rater asked to rate so far
+	Ratings map[string]RatingState `json:"ratings,omitempty"`
+}
+
+// SessionStatus is reported by the session workflow of a passenger.
+type SessionStatus struct {
+	PassengerID int `json:"passenger_id"`
+	// TripID is the workflow ID of the running trip, empty between trips
+	TripID string `json:"trip_id,omitempty"`
+	// Trips counts the trips of the session
+	Trips int `json:"trips"`
+}
+
+// MatchResult is sent to the passenger's trip after each match round the passenger took part in.
+type MatchResult struct {
+	Matched   bool      `json:"matched"`
+	DriverID  int       `json:"driver_id"`
+	DriverLoc int       `json:"driver_loc"`
+	PickupETA time.Time `json:"pickup_eta"`
+	// Cost is the cost of the pair in the round's cost graph
+	Cost    float64 `json:"cost"`
+	RoundID string  `json:"round_id"`
+	// Pooled is set on a shared ride, JoinedRoute when the rider was added to the route of a busy driver
+	Pooled      bool `json:"pooled"`
+	JoinedRoute bool `json:"joined_route"`
+}
+
+// UnmarshalJSON also reads the bare matched flag sent on the match signal before the result was typed.
+func (m *MatchResult) UnmarshalJSON(data []byte) error {
+	type result MatchResult
+	if err := json.Unmarshal(data, &m.Matched); err == nil {
+		*m = MatchResult{Matched: m.Matched}
+		return nil
+	}
+	return json.Unmarshal(data, (*result)(m))
+}
+
+// PaymentResult is sent to the passenger's trip on each payment attempt.
+type PaymentResult struct {
+	Paid     bool    `json:"paid"`
+	Amount   float64 `json:"amount"`
+	Expected float64 `json:"expected"`
+}
+
+// UnmarshalJSON also reads the bare paid flag sent on the payment signal before the result was typed.
+func (p *PaymentResult) UnmarshalJSON(data []byte) error {
+	type result PaymentResult
+	if err := json.Unmarshal(data, &p.Paid); err == nil {
+		*p = PaymentResult{Paid: p.Paid}
+		return nil
+	}
+	return json.Unmarshal(data, (*result)(p))
+}
+
+// Notification is a message left to the passenger.
+type Notification struct {
+	ID          int    `json:"id"`
+	PassengerID int    `json:"passenger_id"`
+	Message     string `json:"message"`
+	CreatedAt   string `json:"created_at"`
+}
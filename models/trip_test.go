@@ -0,0 +1,32 @@
+package models
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestMatchRadiusAfter(t *testing.T) {
+	assert.Equal(t, InitialMatchRadius, MatchRadiusAfter(0))
+	assert.Equal(t, InitialMatchRadius, MatchRadiusAfter(MatchRadiusInterval-time.Second))
+	assert.Equal(t, InitialMatchRadius+2*MatchRadiusStep, MatchRadiusAfter(2*MatchRadiusInterval))
+	assert.Equal(t, MaxMatchRadius, MatchRadiusAfter(time.Hour))
+}
+
+func TestMatchResultReadsMatchedFlag(t *testing.T) {
+	var m MatchResult
+	assert.NoError(t, json.Unmarshal([]byte(`true`), &m))
+	assert.Equal(t, MatchResult{Matched: true}, m)
+	assert.NoError(t, json.Unmarshal([]byte(`{"matched":true,"driver_id":2}`), &m))
+	assert.Equal(t, MatchResult{Matched: true, DriverID: 2}, m)
+	assert.Error(t, json.Unmarshal([]byte(`"yes"`), &m))
+}
+
+func TestPaymentResultReadsPaidFlag(t *testing.T) {
+	var p PaymentResult
+	assert.NoError(t, json.Unmarshal([]byte(`false`), &p))
+	assert.Equal(t, PaymentResult{}, p)
+	assert.NoError(t, json.Unmarshal([]byte(`{"paid":true,"amount":12.5}`), &p))
+	assert.Equal(t, PaymentResult{Paid: true, Amount: 12.5}, p)
+}
@@ -0,0 +1,65 @@
+package models
+
+import "math"
+
+// Vehicle data model
+
+// RideClass is the class of ride a passenger asks for and a vehicle offers.
+type RideClass string
+
+const (
+	ClassEconomy RideClass = "economy"
+	ClassXL      RideClass = "xl"
+	ClassPremium RideClass = "premium"
+)
+
+// fareRates is the fare per location unit of each ride class.
+var fareRates = map[RideClass]float64{
+	ClassEconomy: 1.0,
+	ClassXL:      1.5,
+	ClassPremium: 2.0,
+}
+
+// ValidRideClass tells whether the class is one of the ride classes offered.
+func ValidRideClass(class RideClass) bool {
+	_, ok := fareRates[class]
+	return ok
+}
+
+// Fare is the price of a ride over the distance in the class.
+func Fare(class RideClass, distance float64) float64 {
+	rate, ok := fareRates[class]
+	if !ok {
+		rate = fareRates[ClassEconomy]
+	}
+	return math.Round(rate*distance*100) / 100
+}
+
+// DefaultVehicle stands for the car of a driver who has not registered one.
+var DefaultVehicle = Vehicle{Seats: 4, Class: ClassEconomy}
+
+type Vehicle struct {
+	ID                   int       `json:"id"`
+	DriverID             int       `json:"driver_id"`
+	Plate                string    `json:"plate"`
+	Seats                int       `json:"seats"`
+	Class                RideClass `json:"class"`
+	WheelchairAccessible bool      `json:"wheelchair_accessible"`
+}
+
+// Serves tells whether the vehicle can take a passenger asking for the class, and for wheelchair access if needed.
+// Only the class asked for is offered, a premium car does not take economy rides.
+func (v *Vehicle) Serves(class RideClass, needsAccessible bool) bool {
+	if class == "" {
+		class = ClassEconomy
+	}
+	return v.Class == class && (v.WheelchairAccessible || !needsAccessible)
+}
+
+type VehicleRequestBody struct {
+	ID                   int       `json:"id"`
+	Plate                string    `json:"plate"`
+	Seats                int       `json:"seats"`
+	Class                RideClass `json:"class"`
+	WheelchairAccessible bool      `json:"wheelchair_accessible"`
+}
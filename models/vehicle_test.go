@@ -0,0 +1,28 @@
+package models
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestVehicleServes(t *testing.T) {
+	economy := Vehicle{Seats: 4, Class: ClassEconomy}
+	xl := Vehicle{Seats: 6, Class: ClassXL, WheelchairAccessible: true}
+
+	assert.True(t, economy.Serves("", false))
+	assert.True(t, economy.Serves(ClassEconomy, false))
+	assert.False(t, economy.Serves(ClassEconomy, true))
+	assert.False(t, economy.Serves(ClassXL, false))
+	assert.True(t, xl.Serves(ClassXL, true))
+	assert.False(t, xl.Serves(ClassEconomy, false))
+}
+
+func TestFare(t *testing.T) {
+	assert.Equal(t, 10.0, Fare(ClassEconomy, 10))
+	assert.Equal(t, 15.0, Fare(ClassXL, 10))
+	assert.Equal(t, 20.0, Fare(ClassPremium, 10))
+	// unknown classes are priced as economy
+	assert.Equal(t, 3.33, Fare("limo", 3.333))
+	assert.True(t, ValidRideClass(ClassXL))
+	assert.False(t, ValidRideClass("limo"))
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"easyRide/activities"
+	"easyRide/activities/hungarian"
+	"easyRide/config"
+	data "easyRide/db"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+)
+
+// replay solves a recorded match round again and prints how the assignments differ.
+//
+//	go run ./replay -list 20
+//	go run ./replay -round <round ID> -solver auction -recompute
+func main() {
+	roundID := flag.String("round", "", "ID of the match round to replay")
+	solver := flag.String("solver", "", "solver of the replay, the round's own solver when empty")
+	recompute := flag.Bool("recompute", false, "rebuild the costs from the snapshot with the current cost model")
+	list := flag.Int("list", 0, "list the IDs of the latest rounds recorded instead")
+	asJSON := flag.Bool("json", false, "print the replay as JSON")
+	cfg, err := config.Load(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		log.Fatalln("Invalid configuration", err)
+	}
+	data.Configure(cfg.Database)
+
+	db, err := data.Initialize()
+	if err != nil {
+		log.Fatalln("Database connection failed", err)
+	}
+	defer db.Conn.Close()
+
+	if *list > 0 {
+		ids, err := db.GetRoundAuditIDs(*list)
+		if err != nil {
+			log.Fatalln("Cannot list the match rounds", err)
+		}
+		for _, id := range ids {
+			fmt.Println(id)
+		}
+		return
+	}
+	if *roundID == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	audit, err := db.GetRoundAudit(*roundID)
+	if err != nil {
+		log.Fatalln("Cannot fetch the match round", err)
+	}
+	if *solver == "" {
+		*solver = audit.Solver
+	}
+	replay, err := activities.ReplayRound(audit, *solver, *recompute)
+	if err != nil {
+		log.Fatalln("Cannot replay the match round", err)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(replay); err != nil {
+			log.Fatalln(err)
+		}
+		return
+	}
+	fmt.Printf("round %s recorded %s with %s, replayed with %s\n", replay.RoundID,
+		audit.CreatedAt.Format("2006-01-02 15:04:05"), replay.StoredSolver, replay.Solver)
+	if *recompute {
+		fmt.Printf("costs rebuilt from the snapshot, changed: %v\n", replay.CostsChanged)
+	}
+	fmt.Printf("stored:   %d matched, cost %.3f\n", replay.StoredMatched, replay.StoredCost)
+	fmt.Printf("replayed: %d matched, cost %.3f\n", replay.ReplayedMatched, replay.ReplayedCost)
+	if len(replay.Diffs) == 0 {
+		fmt.Println("same assignments")
+		return
+	}
+	fmt.Printf("%-10s %-14s %-14s\n", "passenger", "stored", "replayed")
+	for _, d := range replay.Diffs {
+		fmt.Printf("%-10d %-14s %-14s\n", d.PassengerID, pair(d.StoredDriverID, d.StoredCost),
+			pair(d.ReplayedDriverID, d.ReplayedCost))
+	}
+}
+
+// pair prints a driver and the cost of the pair
+func pair(driverID int, cost float64) string {
+	switch {
+	case driverID == 0:
+		return "-"
+	case cost == hungarian.Infeasible:
+		return fmt.Sprintf("%d (infeasible)", driverID)
+	default:
+		return fmt.Sprintf("%d (%.3f)", driverID, cost)
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"easyRide/config"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+)
+
+// showconfig prints the settings the client API and the workers run with, given the same config file, environment
+// and flags, along with where each setting was set. It fails when a setting is out of range.
+//
+//	go run ./showconfig -env-file .env -match-interval 45s
+func main() {
+	cfg, err := config.Load(flag.CommandLine, os.Args[1:])
+	if err != nil && !errors.Is(err, config.ErrInvalid) {
+		log.Fatalln(err)
+	}
+	if err := cfg.Print(os.Stdout); err != nil {
+		log.Fatalln(err)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,51 @@
+package signals
+
+import (
+	"context"
+	"easyRide/models"
+	"easyRide/temporalclient"
+)
+
+// query definitions
+
+// QUERY_TRIP_STATUS reports the models.TripStatus of a trip workflow
+const QUERY_TRIP_STATUS = "trip_status"
+
+// QUERY_SCHEDULED_TRIP reports the models.ScheduledTrip of a scheduled trip workflow
+const QUERY_SCHEDULED_TRIP = "scheduled_trip"
+
+// QUERY_RATING_REPLY reports the models.RatingReply of a trip workflow to the rating of a rater sent with a request ID
+const QUERY_RATING_REPLY = "rating_reply"
+
+// QUERY_SESSION reports the models.SessionStatus of a passenger session workflow
+const QUERY_SESSION = "session"
+
+// QueryTripStatus asks the trip workflow of a passenger where the trip stands.
+func QueryTripStatus(workflowID string) (models.TripStatus, error) {
+	var status models.TripStatus
+	temporalClient, err := temporalclient.Shared()
+	if err != nil {
+		return status, err
+	}
+	res, err := temporalClient.QueryWorkflow(context.Background(), workflowID, "", QUERY_TRIP_STATUS)
+	if err != nil {
+		return status, err
+	}
+	err = res.Get(&status)
+	return status, err
+}
+
+// QueryRatingReply asks the trip workflow how it took the rating of the rater sent with the request ID.
+func QueryRatingReply(workflowID string, rater string, requestID string) (models.RatingReply, error) {
+	var reply models.RatingReply
+	temporalClient, err := temporalclient.Shared()
+	if err != nil {
+		return reply, err
+	}
+	res, err := temporalClient.QueryWorkflow(context.Background(), workflowID, "", QUERY_RATING_REPLY, rater, requestID)
+	if err != nil {
+		return reply, err
+	}
+	err = res.Get(&reply)
+	return reply, err
+}
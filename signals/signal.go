@@ -2,7 +2,9 @@ package signals
 
 import (
 	"context"
-	"go.temporal.io/sdk/client"
+	"easyRide/models"
+	"easyRide/temporalclient"
+	"fmt"
 	"go.temporal.io/sdk/workflow"
 	"log"
 )
@@ -12,15 +14,58 @@ import (
 const (
 	MATCH_SIGNAL   = "signal_match"
 	SIGNAL_PAYMENT = "signal_payment"
+	// SIGNAL_RATE_DRIVER carries the passenger's rating of the driver
+	SIGNAL_RATE_DRIVER = "signal_rate_driver"
+	// SIGNAL_RATE_PASSENGER carries the driver's rating of the passenger
+	SIGNAL_RATE_PASSENGER = "signal_rate_passenger"
+	// pickup signals sent by the driver
+	SIGNAL_DRIVER_ARRIVED_PICKUP = "signal_driver_arrived_pickup"
+	SIGNAL_PASSENGER_PICKED_UP   = "signal_passenger_picked_up"
+	// SIGNAL_DRIVER_ARRIVED is sent by the driver on reaching the destination
+	SIGNAL_DRIVER_ARRIVED = "signal_driver_arrived"
+	// SIGNAL_ROUTE_CHANGED carries the stops left on a pooled ride after another rider joined it
+	SIGNAL_ROUTE_CHANGED = "signal_route_changed"
+
+	// matching dispatcher signals, carrying the passenger or driver ID
+	SIGNAL_PASSENGER_REQUESTED = "signal_passenger_requested"
+	SIGNAL_DRIVER_AVAILABLE    = "signal_driver_available"
+
+	// driver shift signals
+	SIGNAL_DRIVER_STATE      = "signal_driver_state"
+	SIGNAL_DRIVER_LOCATION   = "signal_driver_location"
+	SIGNAL_DRIVER_GO_OFFLINE = "signal_driver_go_offline"
+
+	// scheduled trip signals, a reschedule carries the new pickup time
+	SIGNAL_CANCEL_SCHEDULED_TRIP = "signal_cancel_scheduled_trip"
+	SIGNAL_RESCHEDULE_TRIP       = "signal_reschedule_trip"
+
+	// passenger session signals, a login starts the session or attaches to it, a trip request carries the
+	// models.PassengerRequestBody
+	SIGNAL_SESSION_LOGIN = "signal_session_login"
+	SIGNAL_REQUEST_TRIP  = "signal_request_trip"
 )
 
-func SendMatchSignal(workflowID string, matchStatus bool) error {
-	temporalClient, err := client.Dial(client.Options{})
+// MatchDispatcherWorkflowID is the fixed ID of the event-driven matcher.
+const MatchDispatcherWorkflowID = "match-dispatcher"
+
+// DriverShiftWorkflowID is the workflow ID of a driver's shift, there is at most one shift per driver.
+func DriverShiftWorkflowID(driverID int) string {
+	return fmt.Sprintf("driver-shift-%d", driverID)
+}
+
+// PassengerSessionWorkflowID is the workflow ID of a passenger's session, there is at most one session per passenger.
+func PassengerSessionWorkflowID(passengerID int) string {
+	return fmt.Sprintf("passenger-session-%d", passengerID)
+}
+
+// send signals a running workflow through the shared client.
+func send(workflowID string, signalName string, arg interface{}) error {
+	temporalClient, err := temporalclient.Shared()
 	if err != nil {
 		log.Println("Unable to create Temporal client", err)
 		return err
 	}
-	err = temporalClient.SignalWorkflow(context.Background(), workflowID, "", MATCH_SIGNAL, matchStatus)
+	err = temporalClient.SignalWorkflow(context.Background(), workflowID, "", signalName, arg)
 	if err != nil {
 		log.Println("Error signaling workflow in execution ", err)
 		return err
@@ -28,21 +73,42 @@ func SendMatchSignal(workflowID string, matchStatus bool) error {
 	return nil
 }
 
-func ReceiveSignal(ctx workflow.Context, signalName string) (status bool) {
-	res := workflow.GetSignalChannel(ctx, signalName).Receive(ctx, &status)
-	if !res {
-		log.Fatalf("%s channel is closed. Cannot receive status. ", signalName)
-	}
-	return
+func SendMatchSignal(workflowID string, result models.MatchResult) error {
+	return send(workflowID, MATCH_SIGNAL, result)
 }
 
-func SendPaymentSignal(workflowID string, paymentStatus bool) {
-	temporalClient, err := client.Dial(client.Options{})
-	if err != nil {
-		log.Fatalln("Unable to create Temporal client ", err)
-	}
-	err = temporalClient.SignalWorkflow(context.Background(), workflowID, "", SIGNAL_PAYMENT, paymentStatus)
-	if err != nil {
-		log.Fatalln("Error signaling workflow in execution ", err)
+// ErrSignalChannelClosed is returned when a signal channel is closed before a signal is received.
+var ErrSignalChannelClosed = fmt.Errorf("signal channel is closed")
+
+// ReceiveSignal waits for a status signal. It runs in workflow code, so a closed channel is returned as an error
+// for the workflow to fail on, rather than exiting the worker.
+func ReceiveSignal(ctx workflow.Context, signalName string) (bool, error) {
+	var status bool
+	if more := workflow.GetSignalChannel(ctx, signalName).Receive(ctx, &status); !more {
+		return false, fmt.Errorf("%s: %w", signalName, ErrSignalChannelClosed)
 	}
+	return status, nil
+}
+
+func SendPaymentSignal(workflowID string, result models.PaymentResult) error {
+	return send(workflowID, SIGNAL_PAYMENT, result)
+}
+
+func SendRatingSignal(workflowID string, signalName string, rating models.Rating) error {
+	return send(workflowID, signalName, rating)
+}
+
+// SendDriverSignal signals the shift workflow of the driver.
+func SendDriverSignal(driverID int, signalName string, arg interface{}) error {
+	return send(DriverShiftWorkflowID(driverID), signalName, arg)
+}
+
+// SendTripSignal signals the trip workflow of a passenger.
+func SendTripSignal(workflowID string, signalName string, arg interface{}) error {
+	return send(workflowID, signalName, arg)
+}
+
+// SendDispatchSignal tells the event-driven matcher that a passenger or a driver is waiting.
+func SendDispatchSignal(signalName string, id int) error {
+	return send(MatchDispatcherWorkflowID, signalName, id)
 }
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// simulator runs the matching offline over synthetic demand and prints the metrics.
+//
+//	go run ./simulator -seed 7 -drivers 40 -rate 8 -solver auction
+func main() {
+	cfg := DefaultConfig
+	hotspots := joinInts(cfg.Hotspots)
+	flag.Int64Var(&cfg.Seed, "seed", cfg.Seed, "seed of the random demand and supply")
+	flag.IntVar(&cfg.CitySize, "city", cfg.CitySize, "number of locations of the city")
+	flag.DurationVar(&cfg.Duration, "duration", cfg.Duration, "simulated time")
+	flag.Float64Var(&cfg.RequestRate, "rate", cfg.RequestRate, "trip requests per minute")
+	flag.IntVar(&cfg.Drivers, "drivers", cfg.Drivers, "number of drivers")
+	flag.StringVar(&hotspots, "hotspots", hotspots, "comma separated locations of the busy areas")
+	flag.Float64Var(&cfg.HotspotShare, "hotspot-share", cfg.HotspotShare, "share of the requests and drivers around the busy areas")
+	flag.Float64Var(&cfg.HotspotSpread, "hotspot-spread", cfg.HotspotSpread, "spread of the busy areas")
+	flag.Float64Var(&cfg.MeanTripLength, "trip-length", cfg.MeanTripLength, "mean distance of a trip")
+	flag.DurationVar(&cfg.RoundInterval, "round-interval", cfg.RoundInterval, "time between two match rounds")
+	flag.DurationVar(&cfg.Patience, "patience", cfg.Patience, "how long a passenger waits for a match")
+	flag.StringVar(&cfg.Solver, "solver", cfg.Solver, "assignment solver of the rounds")
+	asJSON := flag.Bool("json", false, "print the metrics as JSON")
+	flag.Parse()
+
+	var err error
+	if cfg.Hotspots, err = parseInts(hotspots); err != nil {
+		log.Fatalln("Invalid hotspots", err)
+	}
+	if cfg.CitySize <= 0 || cfg.RoundInterval <= 0 || cfg.Duration <= 0 || cfg.RequestRate < 0 || cfg.Drivers < 0 {
+		log.Fatalln("The city, the round interval and the duration must be positive, the rate and drivers not negative")
+	}
+
+	m, err := Run(cfg)
+	if err != nil {
+		log.Fatalln("Simulation failed", err)
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(m); err != nil {
+			log.Fatalln(err)
+		}
+		return
+	}
+	fmt.Printf("requests %d, matched %d, completed %d, abandoned %d, pending %d\n",
+		m.Requested, m.Matched, m.Completed, m.Abandoned, m.Pending)
+	fmt.Printf("unmatched rate     %.1f%%\n", 100*m.UnmatchedRate)
+	fmt.Printf("driver utilization %.1f%%\n", 100*m.DriverUtilization)
+	fmt.Printf("rounds %d, warm started %d\n", m.Rounds, m.WarmRounds)
+	printDistribution("wait (s)", m.Wait)
+	printDistribution("time to match (s)", m.TimeToMatch)
+	printDistribution("pickup distance", m.PickupDistance)
+	fmt.Println("wait by minute:")
+	for minute, count := range m.WaitHistogram {
+		fmt.Printf("  %3d-%-3d %5d\n", minute, minute+1, count)
+	}
+}
+
+func printDistribution(name string, d Distribution) {
+	fmt.Printf("%-18s mean %.1f  p50 %.1f  p90 %.1f  p99 %.1f  max %.1f\n", name, d.Mean, d.P50, d.P90, d.P99, d.Max)
+}
+
+func joinInts(values []int) string {
+	s := make([]string, len(values))
+	for i, v := range values {
+		s[i] = strconv.Itoa(v)
+	}
+	return strings.Join(s, ",")
+}
+
+func parseInts(s string) ([]int, error) {
+	var values []int
+	for _, field := range strings.Split(s, ",") {
+		if field = strings.TrimSpace(field); field == "" {
+			continue
+		}
+		v, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"container/heap"
+	"easyRide/activities"
+	"easyRide/models"
+	"easyRide/workflows"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// Config describes a simulated city. Locations are the points of the line the models use, 0 to CitySize-1.
+type Config struct {
+	Seed     int64
+	CitySize int
+	Duration time.Duration
+	// RequestRate is the mean number of trip requests per minute, they arrive as a Poisson process
+	RequestRate float64
+	Drivers     int
+	// HotspotShare of the requests and of the drivers' start locations fall around the Hotspots, normally spread by
+	// HotspotSpread, the others are uniform over the city
+	Hotspots      []int
+	HotspotShare  float64
+	HotspotSpread float64
+	// MeanTripLength is the mean distance from pickup to drop, exponentially distributed
+	MeanTripLength float64
+	// RoundInterval is the time between two match rounds
+	RoundInterval time.Duration
+	// Patience is how long a passenger waits for a match before giving up
+	Patience time.Duration
+	Solver   string
+}
+
+// DefaultConfig is a city of 200 locations with two busy areas.
+var DefaultConfig = Config{
+	Seed:           1,
+	CitySize:       200,
+	Duration:       2 * time.Hour,
+	RequestRate:    6,
+	Drivers:        50,
+	Hotspots:       []int{50, 150},
+	HotspotShare:   0.6,
+	HotspotSpread:  10,
+	MeanTripLength: 30,
+	RoundInterval:  10 * time.Second,
+	Patience:       workflows.MatchTimeout,
+	Solver:         activities.MatchSolver,
+}
+
+// Metrics sum up a simulation.
+type Metrics struct {
+	Requested int `json:"requested"`
+	Matched   int `json:"matched"`
+	Completed int `json:"completed"`
+	// Abandoned passengers gave up before a match, Pending ones were still waiting at the end
+	Abandoned int `json:"abandoned"`
+	Pending   int `json:"pending"`
+	// UnmatchedRate is the share of the requests resolved that were abandoned
+	UnmatchedRate float64 `json:"unmatched_rate"`
+	// Wait is from the request to the pickup, TimeToMatch from the request to the match
+	Wait        Distribution `json:"wait_seconds"`
+	TimeToMatch Distribution `json:"time_to_match_seconds"`
+	// WaitHistogram counts the pickups by minute of wait
+	WaitHistogram []int `json:"wait_histogram"`
+	// PickupDistance is how far the drivers were from the passengers they were matched with
+	PickupDistance Distribution `json:"pickup_distance"`
+	// DriverUtilization is the share of the driver time spent driving to a pickup or on a trip
+	DriverUtilization float64 `json:"driver_utilization"`
+	Rounds            int     `json:"rounds"`
+	WarmRounds        int     `json:"warm_rounds"`
+}
+
+// Distribution sums up samples.
+type Distribution struct {
+	Count int     `json:"count"`
+	Mean  float64 `json:"mean"`
+	P50   float64 `json:"p50"`
+	P90   float64 `json:"p90"`
+	P99   float64 `json:"p99"`
+	Max   float64 `json:"max"`
+}
+
+func summarize(samples []float64) Distribution {
+	if len(samples) == 0 {
+		return Distribution{}
+	}
+	sorted := append([]float64(nil), samples...)
+	sort.Float64s(sorted)
+	sum := 0.0
+	for _, s := range sorted {
+		sum += s
+	}
+	return Distribution{
+		Count: len(sorted),
+		Mean:  sum / float64(len(sorted)),
+		P50:   percentile(sorted, 0.5),
+		P90:   percentile(sorted, 0.9),
+		P99:   percentile(sorted, 0.99),
+		Max:   sorted[len(sorted)-1],
+	}
+}
+
+// percentile of sorted samples, by nearest rank
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+type eventKind int
+
+const (
+	eventRequest eventKind = iota
+	eventRound
+	eventPickup
+	eventDrop
+)
+
+type event struct {
+	at   time.Duration
+	seq  int // keeps the events at the same time in the order they were scheduled
+	kind eventKind
+	id   int
+}
+
+type eventQueue []event
+
+func (q eventQueue) Len() int { return len(q) }
+func (q eventQueue) Less(i, j int) bool {
+	if q[i].at != q[j].at {
+		return q[i].at < q[j].at
+	}
+	return q[i].seq < q[j].seq
+}
+func (q eventQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *eventQueue) Push(x interface{}) { *q = append(*q, x.(event)) }
+func (q *eventQueue) Pop() interface{} {
+	old := *q
+	e := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return e
+}
+
+type rider struct {
+	models.Passenger
+	requestedAt time.Duration
+	driver      *car
+}
+
+type car struct {
+	models.Driver
+	busySince time.Duration
+	busy      time.Duration
+	idleSince time.Duration
+}
+
+type simulation struct {
+	cfg     Config
+	rand    *rand.Rand
+	now     time.Duration
+	seq     int
+	events  eventQueue
+	riders  map[int]*rider
+	waiting []*rider
+	cars    []*car
+	round   activities.RoundState
+	metrics Metrics
+	waits   []float64
+	matches []float64
+	pickups []float64
+}
+
+// Run simulates the city for the configured duration, matching with the same round planning as the match activity.
+// The same configuration always gives the same metrics.
+func Run(cfg Config) (Metrics, error) {
+	s := &simulation{cfg: cfg, rand: rand.New(rand.NewSource(cfg.Seed)), riders: make(map[int]*rider)}
+	for i := 0; i < cfg.Drivers; i++ {
+		c := &car{}
+		c.Init("", s.location(), models.DefaultRating, "")
+		c.ID = i + 1
+		c.Available = true
+		s.cars = append(s.cars, c)
+	}
+	if cfg.RequestRate > 0 {
+		s.schedule(s.nextArrival(), eventRequest, 0)
+	}
+	s.schedule(cfg.RoundInterval, eventRound, 0)
+
+	for s.events.Len() > 0 {
+		e := heap.Pop(&s.events).(event)
+		if e.at > cfg.Duration {
+			break
+		}
+		s.now = e.at
+		var err error
+		switch e.kind {
+		case eventRequest:
+			s.request()
+		case eventRound:
+			err = s.matchRound()
+		case eventPickup:
+			s.pickup(s.riders[e.id])
+		case eventDrop:
+			s.drop(s.riders[e.id])
+		}
+		if err != nil {
+			return s.metrics, err
+		}
+	}
+	s.now = cfg.Duration
+	return s.finish(), nil
+}
+
+func (s *simulation) schedule(at time.Duration, kind eventKind, id int) {
+	s.seq++
+	heap.Push(&s.events, event{at: at, seq: s.seq, kind: kind, id: id})
+}
+
+func (s *simulation) nextArrival() time.Duration {
+	minutes := s.rand.ExpFloat64() / s.cfg.RequestRate
+	return s.now + time.Duration(minutes*float64(time.Minute))
+}
+
+// location draws a location around a hotspot, or anywhere in the city.
+func (s *simulation) location() int {
+	if len(s.cfg.Hotspots) > 0 && s.rand.Float64() < s.cfg.HotspotShare {
+		hotspot := s.cfg.Hotspots[s.rand.Intn(len(s.cfg.Hotspots))]
+		return s.clamp(int(math.Round(float64(hotspot) + s.rand.NormFloat64()*s.cfg.HotspotSpread)))
+	}
+	return s.rand.Intn(s.cfg.CitySize)
+}
+
+func (s *simulation) clamp(loc int) int {
+	if loc < 0 {
+		return 0
+	}
+	if loc >= s.cfg.CitySize {
+		return s.cfg.CitySize - 1
+	}
+	return loc
+}
+
+func (s *simulation) request() {
+	pickup := s.location()
+	length := int(math.Max(1, math.Round(s.rand.ExpFloat64()*s.cfg.MeanTripLength)))
+	drop := pickup + length
+	if s.rand.Intn(2) == 0 {
+		drop = pickup - length
+	}
+	r := &rider{requestedAt: s.now}
+	r.Init("", pickup, s.clamp(drop), models.DefaultRating, "")
+	r.ID = len(s.riders) + 1
+	r.MatchRadius = models.InitialMatchRadius
+	s.riders[r.ID] = r
+	s.waiting = append(s.waiting, r)
+	s.metrics.Requested++
+	s.schedule(s.nextArrival(), eventRequest, 0)
+}
+
+// matchRound plans a round over the waiting passengers, in request order, and the free drivers, the longest idle
+// first, as the database lists them to the match activity.
+func (s *simulation) matchRound() error {
+	s.schedule(s.now+s.cfg.RoundInterval, eventRound, 0)
+
+	// the passengers out of patience give up
+	waiting := s.waiting[:0]
+	for _, r := range s.waiting {
+		if s.now-r.requestedAt >= s.cfg.Patience {
+			s.metrics.Abandoned++
+			continue
+		}
+		waiting = append(waiting, r)
+	}
+	s.waiting = waiting
+
+	var free []*car
+	for _, c := range s.cars {
+		if c.Available {
+			free = append(free, c)
+		}
+	}
+	sort.SliceStable(free, func(i, j int) bool { return free[i].idleSince < free[j].idleSince })
+	if len(s.waiting) == 0 || len(free) == 0 {
+		s.widen(nil)
+		return nil
+	}
+
+	p := models.PassengerList{}
+	for _, r := range s.waiting {
+		p.Passengers = append(p.Passengers, r.Passenger)
+	}
+	d := models.DriverList{}
+	for _, c := range free {
+		d.Drivers = append(d.Drivers, c.Driver)
+	}
+	plan, err := activities.PlanRound(s.cfg.Solver, p, d, s.round)
+	if err != nil {
+		return err
+	}
+	s.round = plan.State
+	s.metrics.Rounds++
+	if plan.State.WarmStarted {
+		s.metrics.WarmRounds++
+	}
+
+	matched := make(map[int]bool)
+	for _, pair := range plan.Pairs {
+		r := s.riders[pair.Passenger.ID]
+		c := s.cars[pair.Driver.ID-1]
+		distance := math.Abs(float64(r.PickupLoc - c.Loc))
+		r.driver = c
+		r.InRide = true
+		c.Available = false
+		c.busySince = s.now
+		s.metrics.Matched++
+		s.matches = append(s.matches, (s.now - r.requestedAt).Seconds())
+		s.pickups = append(s.pickups, distance)
+		s.schedule(s.now+travel(distance), eventPickup, r.ID)
+		matched[r.ID] = true
+	}
+	s.widen(matched)
+	return nil
+}
+
+// widen takes the matched passengers off the waiting list and widens the search of the others to the time they have
+// waited, as their trip workflows do after an unmatched round.
+func (s *simulation) widen(matched map[int]bool) {
+	waiting := s.waiting[:0]
+	for _, r := range s.waiting {
+		if matched[r.ID] {
+			continue
+		}
+		r.MatchRadius = models.MatchRadiusAfter(s.now - r.requestedAt)
+		waiting = append(waiting, r)
+	}
+	s.waiting = waiting
+}
+
+func (s *simulation) pickup(r *rider) {
+	r.driver.Loc = r.PickupLoc
+	s.waits = append(s.waits, (s.now - r.requestedAt).Seconds())
+	distance := math.Abs(float64(r.DropLoc - r.PickupLoc))
+	s.schedule(s.now+travel(distance), eventDrop, r.ID)
+}
+
+func (s *simulation) drop(r *rider) {
+	c := r.driver
+	c.Loc = r.DropLoc
+	c.Available = true
+	c.busy += s.now - c.busySince
+	c.idleSince = s.now
+	s.metrics.Completed++
+}
+
+// travel is the time to drive the distance at the drivers' speed.
+func travel(distance float64) time.Duration {
+	return time.Duration(distance / activities.DriverSpeed * float64(time.Second))
+}
+
+func (s *simulation) finish() Metrics {
+	m := s.metrics
+	m.Pending = len(s.waiting)
+	if resolved := m.Matched + m.Abandoned; resolved > 0 {
+		m.UnmatchedRate = float64(m.Abandoned) / float64(resolved)
+	}
+	m.Wait = summarize(s.waits)
+	m.TimeToMatch = summarize(s.matches)
+	m.PickupDistance = summarize(s.pickups)
+	for _, w := range s.waits {
+		minute := int(w / 60)
+		for len(m.WaitHistogram) <= minute {
+			m.WaitHistogram = append(m.WaitHistogram, 0)
+		}
+		m.WaitHistogram[minute]++
+	}
+
+	var busy time.Duration
+	for _, c := range s.cars {
+		busy += c.busy
+		if !c.Available {
+			// the trip running at the end counts until the end
+			busy += s.now - c.busySince
+		}
+	}
+	if total := time.Duration(len(s.cars)) * s.cfg.Duration; total > 0 {
+		m.DriverUtilization = float64(busy) / float64(total)
+	}
+	return m
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func testConfig() Config {
+	cfg := DefaultConfig
+	cfg.Duration = 30 * time.Minute
+	return cfg
+}
+
+func TestRunIsReproducible(t *testing.T) {
+	cfg := testConfig()
+	first, err := Run(cfg)
+	assert.NoError(t, err)
+	second, err := Run(cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, first, second)
+
+	cfg.Seed++
+	other, err := Run(cfg)
+	assert.NoError(t, err)
+	assert.NotEqual(t, first, other)
+}
+
+func TestRunMetrics(t *testing.T) {
+	m, err := Run(testConfig())
+	assert.NoError(t, err)
+	assert.NotZero(t, m.Requested)
+	assert.Equal(t, m.Requested, m.Matched+m.Abandoned+m.Pending)
+	assert.LessOrEqual(t, m.Completed, m.Matched)
+	assert.Equal(t, m.Matched, m.TimeToMatch.Count)
+	assert.Equal(t, m.Matched, m.PickupDistance.Count)
+	histogram := 0
+	for _, count := range m.WaitHistogram {
+		histogram += count
+	}
+	assert.Equal(t, m.Wait.Count, histogram)
+	assert.Greater(t, m.DriverUtilization, 0.0)
+	assert.LessOrEqual(t, m.DriverUtilization, 1.0)
+	assert.LessOrEqual(t, m.PickupDistance.Max, float64(DefaultConfig.CitySize))
+}
+
+func TestRunWithoutDrivers(t *testing.T) {
+	cfg := testConfig()
+	cfg.Drivers = 0
+	cfg.Patience = 5 * time.Minute
+	m, err := Run(cfg)
+	assert.NoError(t, err)
+	assert.Zero(t, m.Matched)
+	assert.Zero(t, m.Rounds)
+	assert.Equal(t, 1.0, m.UnmatchedRate)
+	assert.Zero(t, m.DriverUtilization)
+}
+
+func TestRunUnknownSolver(t *testing.T) {
+	cfg := testConfig()
+	cfg.Solver = "greedy"
+	_, err := Run(cfg)
+	assert.Error(t, err)
+}
+
+func TestSummarize(t *testing.T) {
+	d := summarize([]float64{5, 1, 4, 2, 3, 6, 7, 8, 9, 10})
+	assert.Equal(t, Distribution{Count: 10, Mean: 5.5, P50: 5, P90: 9, P99: 10, Max: 10}, d)
+	assert.Equal(t, Distribution{}, summarize(nil))
+}
@@ -0,0 +1,187 @@
+package starter
+
+import (
+	"easyRide/models"
+	"easyRide/signals"
+	"easyRide/temporalclient"
+	"easyRide/workflows"
+	"errors"
+	"fmt"
+	"go.temporal.io/api/enums/v1"
+	"go.temporal.io/api/serviceerror"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/converter"
+	"go.temporal.io/sdk/temporal"
+	"golang.org/x/net/context"
+	"log"
+	"time"
+)
+
+const (
+	// MatchWorkflowID is the fixed ID of the matching cron, so that at most one runs at a time.
+	MatchWorkflowID = "match-engine"
+	// MatchNowWorkflowID is the fixed ID of a single matching round triggered on demand.
+	MatchNowWorkflowID = "match-engine-now"
+	// memo key holding the interval of the matching cron
+	matchIntervalMemo = "interval"
+)
+
+// ErrMatchRoundRunning is returned when a round is triggered while the previous one is still running.
+var ErrMatchRoundRunning = errors.New("a matching round is already running")
+
+// StartMatchWorkflow starts the matching cron every interval, a running cron is kept as it is.
+func StartMatchWorkflow(interval time.Duration) error {
+	c, err := temporalclient.Shared()
+	if err != nil {
+		log.Println("Unable to create client", err)
+		return err
+	}
+	if interval <= 0 {
+		return fmt.Errorf("invalid matching interval %v", interval)
+	}
+
+	// the ID is fixed, starting again while the cron is running returns the running one
+	workflowOptions := client.StartWorkflowOptions{
+		ID:                    MatchWorkflowID,
+		TaskQueue:             taskQueues.Matching,
+		CronSchedule:          "@every " + interval.String(),
+		WorkflowIDReusePolicy: enums.WORKFLOW_ID_REUSE_POLICY_ALLOW_DUPLICATE,
+		Memo:                  map[string]interface{}{matchIntervalMemo: interval.String()},
+	}
+
+	w, err := c.ExecuteWorkflow(context.Background(), workflowOptions, workflows.MatchWorkFlow)
+	if err != nil {
+		log.Println("Unable to execute workflow", err)
+		return err
+	}
+	log.Println("Started matching workflow", "WorkflowID", w.GetID(), "RunID", w.GetRunID())
+	return nil
+}
+
+// PauseMatchWorkflow stops the matching cron, a round in progress still completes.
+func PauseMatchWorkflow() error {
+	c, err := temporalclient.Shared()
+	if err != nil {
+		return err
+	}
+	err = c.CancelWorkflow(context.Background(), MatchWorkflowID, "")
+	if _, ok := err.(*serviceerror.NotFound); ok {
+		// not running
+		return nil
+	}
+	return err
+}
+
+// awaitMatchWorkflowStopped waits for the round of the paused matching cron to complete.
+func awaitMatchWorkflowStopped() error {
+	c, err := temporalclient.Shared()
+	if err != nil {
+		return err
+	}
+	err = c.GetWorkflow(context.Background(), MatchWorkflowID, "").Get(context.Background(), nil)
+	var canceled *temporal.CanceledError
+	if _, ok := err.(*serviceerror.NotFound); ok || errors.As(err, &canceled) {
+		return nil
+	}
+	return err
+}
+
+// ResumeMatchWorkflow starts the matching cron again with the interval it last ran with.
+func ResumeMatchWorkflow(defaultInterval time.Duration) error {
+	status, err := GetMatchStatus()
+	if err != nil {
+		return err
+	}
+	interval := defaultInterval
+	if status.Interval != "" {
+		if interval, err = time.ParseDuration(status.Interval); err != nil {
+			return err
+		}
+	}
+	return StartMatchWorkflow(interval)
+}
+
+// RescheduleMatchWorkflow restarts the matching cron with a new interval.
+func RescheduleMatchWorkflow(interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("invalid matching interval %v", interval)
+	}
+	if err := PauseMatchWorkflow(); err != nil {
+		return err
+	}
+	// starting while the paused cron runs its last round would return the paused cron
+	if err := awaitMatchWorkflowStopped(); err != nil {
+		return err
+	}
+	return StartMatchWorkflow(interval)
+}
+
+// TriggerMatchRound runs a single matching round now, alongside the cron.
+func TriggerMatchRound() error {
+	c, err := temporalclient.Shared()
+	if err != nil {
+		return err
+	}
+	workflowOptions := client.StartWorkflowOptions{
+		ID:                                       MatchNowWorkflowID,
+		TaskQueue:                                taskQueues.Matching,
+		WorkflowIDReusePolicy:                    enums.WORKFLOW_ID_REUSE_POLICY_ALLOW_DUPLICATE,
+		WorkflowExecutionErrorWhenAlreadyStarted: true,
+	}
+	w, err := c.ExecuteWorkflow(context.Background(), workflowOptions, workflows.MatchWorkFlow)
+	if _, ok := err.(*serviceerror.WorkflowExecutionAlreadyStarted); ok {
+		return ErrMatchRoundRunning
+	}
+	if err != nil {
+		return err
+	}
+	log.Println("Triggered matching round", "WorkflowID", w.GetID(), "RunID", w.GetRunID())
+	return nil
+}
+
+// GetMatchStatus describes the latest run of the matching cron.
+func GetMatchStatus() (models.MatchEngineStatus, error) {
+	status := models.MatchEngineStatus{}
+	c, err := temporalclient.Shared()
+	if err != nil {
+		return status, err
+	}
+	resp, err := c.DescribeWorkflowExecution(context.Background(), MatchWorkflowID, "")
+	if _, ok := err.(*serviceerror.NotFound); ok {
+		// never started
+		return status, nil
+	}
+	if err != nil {
+		return status, err
+	}
+	info := resp.GetWorkflowExecutionInfo()
+	status.Running = info.GetStatus() == enums.WORKFLOW_EXECUTION_STATUS_RUNNING
+	if payload, ok := info.GetMemo().GetFields()[matchIntervalMemo]; ok {
+		if err := converter.GetDefaultDataConverter().FromPayload(payload, &status.Interval); err != nil {
+			return status, err
+		}
+	}
+	return status, nil
+}
+
+// StartMatchDispatcher starts the event-driven matcher, a running one is kept as it is.
+func StartMatchDispatcher(opts workflows.DispatchOptions) error {
+	c, err := temporalclient.Shared()
+	if err != nil {
+		log.Println("Unable to create client", err)
+		return err
+	}
+	workflowOptions := client.StartWorkflowOptions{
+		ID:                    signals.MatchDispatcherWorkflowID,
+		TaskQueue:             taskQueues.Matching,
+		WorkflowIDReusePolicy: enums.WORKFLOW_ID_REUSE_POLICY_ALLOW_DUPLICATE,
+	}
+	w, err := c.ExecuteWorkflow(context.Background(), workflowOptions, workflows.MatchDispatcherWorkflow, opts,
+		workflows.DispatchState{})
+	if err != nil {
+		log.Println("Unable to execute workflow", err)
+		return err
+	}
+	log.Println("Started matching dispatcher", "WorkflowID", w.GetID(), "RunID", w.GetRunID())
+	return nil
+}
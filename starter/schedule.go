@@ -0,0 +1,91 @@
+package starter
+
+import (
+	"easyRide/models"
+	"easyRide/signals"
+	"easyRide/temporalclient"
+	"easyRide/workflows"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"go.temporal.io/sdk/client"
+	"golang.org/x/net/context"
+	"log"
+	"time"
+)
+
+var (
+	// ErrScheduleTooSoon is returned for a pickup time within the lead time of the scheduled trips.
+	ErrScheduleTooSoon = fmt.Errorf("the pickup time must be at least %v ahead", workflows.ScheduleLeadTime)
+	// ErrScheduleClosed is returned when a scheduled trip is changed after it was dispatched or cancelled.
+	ErrScheduleClosed = errors.New("the scheduled trip can no longer be changed")
+)
+
+// ScheduleTrip books a trip for a later pickup time and returns the ID of the schedule.
+func ScheduleTrip(trip models.ScheduledTrip) (string, error) {
+	c, err := temporalclient.Shared()
+	if err != nil {
+		log.Println("Unable to create client", err)
+		return "", err
+	}
+	if time.Until(trip.PickupAt) < workflows.ScheduleLeadTime {
+		return "", ErrScheduleTooSoon
+	}
+
+	workflowOptions := client.StartWorkflowOptions{
+		TaskQueue: taskQueues.Main,
+		ID:        fmt.Sprintf("scheduled-trip-%d-%s", trip.PassengerID, uuid.NewString()),
+	}
+	w, err := c.ExecuteWorkflow(context.Background(), workflowOptions, workflows.ScheduledTripWorkflow, trip)
+	if err != nil {
+		log.Println("Unable to execute workflow", err)
+		return "", err
+	}
+	log.Println("Started scheduled trip workflow", "WorkflowID", w.GetID(), "RunID", w.GetRunID())
+	return w.GetID(), nil
+}
+
+// GetScheduledTrip reports a trip booked ahead.
+func GetScheduledTrip(scheduleID string) (models.ScheduledTrip, error) {
+	var trip models.ScheduledTrip
+	c, err := temporalclient.Shared()
+	if err != nil {
+		return trip, err
+	}
+	res, err := c.QueryWorkflow(context.Background(), scheduleID, "", signals.QUERY_SCHEDULED_TRIP)
+	if err != nil {
+		return trip, err
+	}
+	err = res.Get(&trip)
+	return trip, err
+}
+
+// CancelScheduledTrip cancels a trip booked ahead, as long as it was not dispatched.
+func CancelScheduledTrip(scheduleID string) error {
+	if err := checkScheduleOpen(scheduleID); err != nil {
+		return err
+	}
+	return signals.SendTripSignal(scheduleID, signals.SIGNAL_CANCEL_SCHEDULED_TRIP, nil)
+}
+
+// RescheduleTrip moves the pickup time of a trip booked ahead, as long as it was not dispatched.
+func RescheduleTrip(scheduleID string, pickupAt time.Time) error {
+	if time.Until(pickupAt) < workflows.ScheduleLeadTime {
+		return ErrScheduleTooSoon
+	}
+	if err := checkScheduleOpen(scheduleID); err != nil {
+		return err
+	}
+	return signals.SendTripSignal(scheduleID, signals.SIGNAL_RESCHEDULE_TRIP, pickupAt)
+}
+
+func checkScheduleOpen(scheduleID string) error {
+	trip, err := GetScheduledTrip(scheduleID)
+	if err != nil {
+		return err
+	}
+	if trip.Status != models.ScheduleBooked {
+		return ErrScheduleClosed
+	}
+	return nil
+}
@@ -1,52 +1,76 @@
 package starter
 
 import (
+	"easyRide/config"
+	"easyRide/models"
+	"easyRide/signals"
+	"easyRide/temporalclient"
 	"easyRide/workflows"
 	"go.temporal.io/sdk/client"
 	"golang.org/x/net/context"
 	"log"
 )
 
-func StartMatchWorkflow() {
-	c, err := client.Dial(client.Options{
-		HostPort: client.DefaultHostPort,
-	})
+// taskQueues the workflows are started on, the defaults until Configure is called
+var taskQueues = config.Default().TaskQueues
+
+// Configure sets the task queues the workflows are started on, the ones the workers poll.
+func Configure(queues config.TaskQueues) {
+	taskQueues = queues
+}
+
+// StartPassengerSession starts the session of the passenger on login, or attaches to the session already running.
+func StartPassengerSession(passengerID int) error {
+	return signalSession(passengerID, signals.SIGNAL_SESSION_LOGIN, nil)
+}
+
+// RequestTrip hands the trip request to the passenger's session, which starts the trip.
+func RequestTrip(request models.PassengerRequestBody) error {
+	return signalSession(request.ID, signals.SIGNAL_REQUEST_TRIP, request)
+}
+
+// signalSession signals the session of the passenger, the session is started first when none is running.
+func signalSession(passengerID int, signalName string, arg interface{}) error {
+	c, err := temporalclient.Shared()
 	if err != nil {
-		log.Fatalln("Unable to create client", err)
+		log.Println("Unable to create client", err)
+		return err
 	}
-	defer c.Close()
 
-	// add workflow options
 	workflowOptions := client.StartWorkflowOptions{
-		TaskQueue:    "matching",
-		CronSchedule: "@every 30s",
+		TaskQueue: taskQueues.Main,
+		ID:        signals.PassengerSessionWorkflowID(passengerID),
 	}
-
-	w, err := c.ExecuteWorkflow(context.Background(), workflowOptions, workflows.MatchWorkFlow)
+	w, err := c.SignalWithStartWorkflow(context.Background(), workflowOptions.ID, signalName, arg, workflowOptions,
+		workflows.PassengerSessionWorkflow, workflows.SessionState{PassengerID: passengerID})
 	if err != nil {
-		log.Fatalln("Unable to execute workflow", err)
+		log.Println("Unable to signal the passenger session", err)
+		return err
 	}
-	log.Println("Started matching workflow", "WorkflowID", w.GetID(), "RunID", w.GetRunID())
+	log.Println("Signaled passenger session", "WorkflowID", w.GetID(), "RunID", w.GetRunID(), "Signal", signalName)
+	return nil
 }
 
-func StartMainWorkflow(workflowID string, passengerID int) {
-	c, err := client.Dial(client.Options{
-		HostPort: client.DefaultHostPort,
-	})
+// StartDriverShiftWorkflow starts the shift of the driver, or attaches to the shift already running.
+func StartDriverShiftWorkflow(driverID int) error {
+	c, err := temporalclient.Shared()
 	if err != nil {
-		log.Fatalln("Unable to create client", err)
+		log.Println("Unable to create client", err)
+		return err
 	}
-	defer c.Close()
 
-	// add workflow options
+	// a running shift with the same ID is returned instead of starting a second one
 	workflowOptions := client.StartWorkflowOptions{
-		TaskQueue: "worker-group-1",
-		ID:        workflowID,
+		TaskQueue: taskQueues.Main,
+		ID:        signals.DriverShiftWorkflowID(driverID),
 	}
 
-	w, err := c.ExecuteWorkflow(context.Background(), workflowOptions, workflows.MainWorkFlow, passengerID)
+	w, err := c.ExecuteWorkflow(context.Background(), workflowOptions, workflows.DriverShiftWorkflow, driverID,
+		workflows.ShiftState{})
 	if err != nil {
-		log.Fatalln("Unable to execute workflow", err)
+		log.Println("Unable to execute workflow", err)
+		return err
 	}
-	log.Println("Started main workflow", "WorkflowID", w.GetID(), "RunID", w.GetRunID())
+	log.Println("Started driver shift workflow", "WorkflowID", w.GetID(), "RunID", w.GetRunID())
+	return nil
 }
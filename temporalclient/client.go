@@ -0,0 +1,114 @@
+package temporalclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"go.temporal.io/sdk/client"
+	"os"
+	"sync"
+)
+
+// Options configures the connection to the Temporal server.
+type Options struct {
+	HostPort  string
+	Namespace string
+	// TLS is enabled when a client certificate or a CA certificate is given
+	TLSCertPath   string
+	TLSKeyPath    string
+	TLSCAPath     string
+	TLSServerName string
+}
+
+var (
+	mu      sync.Mutex
+	shared  client.Client
+	options Options
+)
+
+// Configure sets the options the shared client is dialed with, the SDK defaults are used until then.
+func Configure(opts Options) {
+	mu.Lock()
+	defer mu.Unlock()
+	options = opts
+}
+
+// Dial creates a new client, the caller owns it and has to close it.
+func Dial(opts Options) (client.Client, error) {
+	clientOptions := client.Options{
+		HostPort:  opts.HostPort,
+		Namespace: opts.Namespace,
+	}
+	if clientOptions.HostPort == "" {
+		clientOptions.HostPort = client.DefaultHostPort
+	}
+	tlsConfig, err := opts.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	clientOptions.ConnectionOptions.TLS = tlsConfig
+	return client.Dial(clientOptions)
+}
+
+func (opts Options) tlsConfig() (*tls.Config, error) {
+	if opts.TLSCertPath == "" && opts.TLSKeyPath == "" && opts.TLSCAPath == "" {
+		return nil, nil
+	}
+	config := &tls.Config{ServerName: opts.TLSServerName}
+	if opts.TLSCertPath != "" || opts.TLSKeyPath != "" {
+		if opts.TLSCertPath == "" || opts.TLSKeyPath == "" {
+			return nil, errors.New("both the TLS certificate and key are required")
+		}
+		cert, err := tls.LoadX509KeyPair(opts.TLSCertPath, opts.TLSKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load the TLS key pair: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if opts.TLSCAPath != "" {
+		ca, err := os.ReadFile(opts.TLSCAPath)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read the TLS CA certificate: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, errors.New("invalid TLS CA certificate")
+		}
+		config.RootCAs = pool
+	}
+	return config, nil
+}
+
+// Shared returns the long-lived client of the process, dialing it with the configured options on first use.
+// Transient failures are returned, the next call dials again.
+func Shared() (client.Client, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if shared != nil {
+		return shared, nil
+	}
+	c, err := Dial(options)
+	if err != nil {
+		return nil, err
+	}
+	shared = c
+	return shared, nil
+}
+
+// SetShared makes an existing client the shared one, e.g. the client a worker runs on.
+func SetShared(c client.Client) {
+	mu.Lock()
+	defer mu.Unlock()
+	shared = c
+}
+
+// Close closes the shared client.
+func Close() {
+	mu.Lock()
+	defer mu.Unlock()
+	if shared != nil {
+		shared.Close()
+		shared = nil
+	}
+}
@@ -2,29 +2,71 @@ package main
 
 import (
 	"easyRide/activities"
+	"easyRide/config"
+	data "easyRide/db"
+	"easyRide/temporalclient"
 	"easyRide/workflows"
-	"go.temporal.io/sdk/client"
+	"flag"
 	"go.temporal.io/sdk/worker"
 	"log"
+	"os"
 )
 
 func main() {
+	cfg, err := config.Load(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		log.Fatalln("Invalid configuration", err)
+	}
+	data.Configure(cfg.Database)
+	setTimeouts(cfg.Timeouts)
+
 	log.Println("Main worker Starting...")
-	c, err := client.Dial(client.Options{
-		HostPort: client.DefaultHostPort,
-	})
+	c, err := temporalclient.Dial(cfg.Temporal.Options())
 	if err != nil {
 		log.Fatalln("Unable to create client", err)
 	}
 	defer c.Close()
+	// activities signal workflows through the worker's client
+	temporalclient.SetShared(c)
 
-	w := worker.New(c, "worker-group-1", worker.Options{})
+	w := worker.New(c, cfg.TaskQueues.Main, worker.Options{})
 	w.RegisterWorkflow(workflows.MainWorkFlow)
+	w.RegisterWorkflow(workflows.PassengerSessionWorkflow)
+	w.RegisterWorkflow(workflows.DriverShiftWorkflow)
+	w.RegisterWorkflow(workflows.ScheduledTripWorkflow)
+	w.RegisterActivity(activities.RequestTrip)
+	w.RegisterActivity(activities.WidenMatchRadius)
+	w.RegisterActivity(activities.NotifyPassenger)
+	w.RegisterActivity(activities.DispatchScheduledTrip)
+	w.RegisterActivity(activities.CancelTripRequest)
+	w.RegisterActivity(activities.DriverArrivedAtPickup)
+	w.RegisterActivity(activities.PickUp)
+	w.RegisterActivity(activities.NoShow)
+	w.RegisterActivity(activities.DriverLate)
 	w.RegisterActivity(activities.InTrip)
 	w.RegisterActivity(activities.Arrive)
 	w.RegisterActivity(activities.PassengerEndTrip)
+	w.RegisterActivity(activities.RecordPayment)
+	w.RegisterActivity(activities.VoidPayment)
+	w.RegisterActivity(activities.ReleaseDriver)
+	w.RegisterActivity(activities.RestorePassenger)
+	w.RegisterActivity(activities.SubmitRating)
+	w.RegisterActivity(activities.MissRating)
 	w.RegisterActivity(activities.Rate)
+	w.RegisterActivity(activities.SyncDriverState)
+	w.RegisterActivity(activities.UpdateDriverLocation)
 	if err := w.Run(worker.InterruptCh()); err != nil {
 		log.Fatalln(err)
 	}
 }
+
+// setTimeouts runs the workflows with the configured timeouts. The timers already running keep their duration.
+func setTimeouts(t config.Timeouts) {
+	workflows.MatchTimeout = t.Match
+	workflows.EnRouteTimeout = t.EnRoute
+	workflows.NoShowTimeout = t.NoShow
+	workflows.RatingWindow = t.Rating
+	workflows.SessionIdleTimeout = t.SessionIdle
+	workflows.MaxTripDuration = t.MaxTrip
+	workflows.TripHeartbeatTimeout = t.TripHeartbeat
+}
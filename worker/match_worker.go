@@ -2,26 +2,37 @@ package main
 
 import (
 	"easyRide/activities"
+	"easyRide/config"
+	data "easyRide/db"
+	"easyRide/temporalclient"
 	"easyRide/workflows"
-	"go.temporal.io/sdk/client"
+	"flag"
 	"go.temporal.io/sdk/worker"
 	"log"
+	"os"
 )
 
 // register workflows and activities to the worker
 func main() {
+	cfg, err := config.Load(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		log.Fatalln("Invalid configuration", err)
+	}
+	data.Configure(cfg.Database)
+
 	log.Println("Match worker Starting...")
-	c, err := client.Dial(client.Options{
-		HostPort: client.DefaultHostPort,
-	})
+	c, err := temporalclient.Dial(cfg.Temporal.Options())
 	if err != nil {
 		log.Fatalln("Unable to create client", err)
 	}
 	defer c.Close()
+	// activities signal workflows through the worker's client
+	temporalclient.SetShared(c)
 
-	cronWorker := worker.New(c, "matching", worker.Options{})
+	cronWorker := worker.New(c, cfg.TaskQueues.Matching, worker.Options{})
 
 	cronWorker.RegisterWorkflow(workflows.MatchWorkFlow)
+	cronWorker.RegisterWorkflow(workflows.MatchDispatcherWorkflow)
 	cronWorker.RegisterActivity(activities.Match)
 
 	if err := cronWorker.Run(worker.InterruptCh()); err != nil {
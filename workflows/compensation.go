@@ -0,0 +1,71 @@
+package workflows
+
+import (
+	"fmt"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/workflow"
+	"time"
+)
+
+// CompensationAttempts bounds the attempts of each undo step, a step still failing after them is left to fix by
+// hand and fails the workflow.
+var CompensationAttempts int32 = 5
+
+// compensation undoes a forward step of the trip with an activity.
+type compensation struct {
+	activity  interface{}
+	args      []interface{}
+	forgotten bool
+}
+
+// compensations are the undo steps of the forward steps the trip has done so far. A nil compensations undoes
+// nothing, the trips started before the compensations keep going without them.
+type compensations struct {
+	steps []*compensation
+}
+
+// add registers the undo of a forward step before the step runs, the undo must leave alone a step that never ran.
+// The returned func forgets the undo once the trip itself has completed what the step started.
+func (c *compensations) add(activity interface{}, args ...interface{}) (forget func()) {
+	if c == nil {
+		return func() {}
+	}
+	step := &compensation{activity: activity, args: args}
+	c.steps = append(c.steps, step)
+	return func() { step.forgotten = true }
+}
+
+// compensate runs the undo steps in the reverse order of their forward steps once the trip failed with cause, also
+// when the trip was cancelled. Each undo step runs as an activity, so the workflow history shows what was undone.
+// It returns cause, or an error of type CompensationFailed when an undo step kept failing.
+func (c *compensations) compensate(ctx workflow.Context, cause error) error {
+	if c == nil || len(c.steps) == 0 {
+		return cause
+	}
+	logger := workflow.GetLogger(ctx)
+	logger.Warn("Trip failed, undoing its steps.", "Error", cause)
+	ctx, _ = workflow.NewDisconnectedContext(ctx)
+	ao := workflow.ActivityOptions{
+		StartToCloseTimeout: 10 * time.Second,
+		RetryPolicy:         &temporal.RetryPolicy{MaximumAttempts: CompensationAttempts},
+	}
+	ctx = workflow.WithActivityOptions(ctx, ao)
+
+	var failed error
+	for i := len(c.steps) - 1; i >= 0; i-- {
+		step := c.steps[i]
+		if step.forgotten {
+			continue
+		}
+		// an undo step failing does not keep the others from running
+		if err := workflow.ExecuteActivity(ctx, step.activity, step.args...).Get(ctx, nil); err != nil {
+			logger.Error("Undo step failed.", "Error", err)
+			failed = err
+		}
+	}
+	if failed != nil {
+		return temporal.NewNonRetryableApplicationError(fmt.Sprintf("trip failed and was not undone: %v", cause),
+			"CompensationFailed", failed)
+	}
+	return cause
+}
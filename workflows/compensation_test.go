@@ -0,0 +1,111 @@
+package workflows
+
+import (
+	"easyRide/activities"
+	"easyRide/models"
+	"errors"
+	"github.com/stretchr/testify/mock"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/workflow"
+	"time"
+)
+
+// rideToPayment rides the passenger to the destination, the passenger pays and both parties rate the trip.
+func (s *UnitTestSuite) rideToPayment() {
+	s.env.OnActivity(activities.DriverArrivedAtPickup, mock.Anything, mock.Anything, 1, testMatch).Return(nil)
+	s.env.OnActivity(activities.PickUp, mock.Anything, mock.Anything, 1, testMatch).Return(nil)
+	s.env.OnActivity(activities.InTrip, mock.Anything, 1, testMatch).Return(nil)
+	s.env.OnActivity(activities.SubmitRating, mock.Anything, mock.Anything).Return(nil)
+	s.env.OnActivity(activities.Arrive, mock.Anything, 1, testMatch).Return(nil).Once()
+	s.signalRide()
+	s.env.RegisterDelayedCallback(func() {
+		s.env.SignalWorkflow("signal_rate_passenger", models.Rating{Score: 4})
+		s.env.SignalWorkflow("signal_payment", models.PaymentResult{Paid: true, Amount: 12, Expected: 12})
+	}, time.Millisecond*2)
+	s.env.RegisterDelayedCallback(func() {
+		// the passenger is asked to rate once paid
+		s.env.SignalWorkflow("signal_rate_driver", models.Rating{Score: 5})
+	}, time.Millisecond*3)
+}
+
+func (s *UnitTestSuite) Test_MainWorkflow_EndTripFailsCompensated() {
+	s.rideToPayment()
+	s.env.OnActivity(activities.RecordPayment, mock.Anything, "default-test-workflow-id",
+		models.PaymentResult{Paid: true, Amount: 12, Expected: 12}).Return(nil).Once()
+	s.env.OnActivity(activities.PassengerEndTrip, mock.Anything, 1).
+		Return(temporal.NewNonRetryableApplicationError("passenger not found", "NotFound", nil)).Once()
+	// the driver is on the next trip already and the ride is paid for, only the passenger is undone
+	var undone []string
+	s.env.OnActivity(activities.RestorePassenger, mock.Anything, "default-test-workflow-id", 1).Return(nil).Once().
+		Run(func(mock.Arguments) { undone = append(undone, "RestorePassenger") })
+
+	s.env.ExecuteWorkflow(MainWorkFlow, 1)
+
+	s.True(s.env.IsWorkflowCompleted())
+	var appErr *temporal.ApplicationError
+	s.True(errors.As(s.env.GetWorkflowError(), &appErr))
+	s.Equal("NotFound", appErr.Type())
+	s.Equal([]string{"RestorePassenger"}, undone)
+}
+
+func (s *UnitTestSuite) Test_MainWorkflow_CompensationFails() {
+	s.env.OnActivity(activities.DriverArrivedAtPickup, mock.Anything, mock.Anything, 1, testMatch).Return(nil)
+	s.env.OnActivity(activities.PickUp, mock.Anything, mock.Anything, 1, testMatch).Return(nil)
+	s.env.OnActivity(activities.InTrip, mock.Anything, 1, testMatch).
+		Return(temporal.NewNonRetryableApplicationError("driver not found", "NotFound", nil)).Once()
+	// the passenger is still restored once the driver cannot be released
+	s.env.OnActivity(activities.ReleaseDriver, mock.Anything, mock.Anything, 1, testMatch).
+		Return(errors.New("connection refused")).Times(int(CompensationAttempts))
+	s.env.OnActivity(activities.RestorePassenger, mock.Anything, mock.Anything, 1).Return(nil).Once()
+
+	s.signalRide()
+
+	s.env.ExecuteWorkflow(MainWorkFlow, 1)
+
+	s.True(s.env.IsWorkflowCompleted())
+	var appErr *temporal.ApplicationError
+	s.True(errors.As(s.env.GetWorkflowError(), &appErr))
+	s.Equal("CompensationFailed", appErr.Type())
+	s.Contains(appErr.Error(), "driver not found")
+}
+
+func (s *UnitTestSuite) Test_MainWorkflow_CancelledCompensated() {
+	s.env.OnActivity(activities.DriverArrivedAtPickup, mock.Anything, mock.Anything, 1, testMatch).Return(nil)
+	s.env.OnActivity(activities.PickUp, mock.Anything, mock.Anything, 1, testMatch).Return(nil)
+	s.env.OnActivity(activities.InTrip, mock.Anything, 1, testMatch).After(time.Hour).Return(nil)
+	s.env.OnActivity(activities.ReleaseDriver, mock.Anything, mock.Anything, 1, testMatch).Return(nil).Once()
+	s.env.OnActivity(activities.RestorePassenger, mock.Anything, mock.Anything, 1).Return(nil).Once()
+
+	s.signalRide()
+	s.env.RegisterDelayedCallback(func() {
+		s.Equal(models.StageInTrip, s.queryStatus().Stage)
+		s.env.CancelWorkflow()
+	}, 10*time.Minute)
+
+	s.env.ExecuteWorkflow(MainWorkFlow, 1)
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.True(temporal.IsCanceledError(s.env.GetWorkflowError()))
+}
+
+// Test_MainWorkflow_BeforeCompensation runs a trip started before the compensations, which undoes nothing.
+func (s *UnitTestSuite) Test_MainWorkflow_BeforeCompensation() {
+	supported := supportedVersions[ChangeTripCompensation]
+	supportedVersions[ChangeTripCompensation] = struct{ min, latest workflow.Version }{
+		workflow.DefaultVersion, workflow.DefaultVersion}
+	defer func() { supportedVersions[ChangeTripCompensation] = supported }()
+
+	s.env.OnActivity(activities.DriverArrivedAtPickup, mock.Anything, mock.Anything, 1, testMatch).Return(nil)
+	s.env.OnActivity(activities.PickUp, mock.Anything, mock.Anything, 1, testMatch).Return(nil)
+	s.env.OnActivity(activities.InTrip, mock.Anything, 1, testMatch).
+		Return(temporal.NewNonRetryableApplicationError("driver not found", "NotFound", nil)).Once()
+
+	s.signalRide()
+
+	s.env.ExecuteWorkflow(MainWorkFlow, 1)
+
+	s.True(s.env.IsWorkflowCompleted())
+	var appErr *temporal.ApplicationError
+	s.True(errors.As(s.env.GetWorkflowError(), &appErr))
+	s.Equal("NotFound", appErr.Type())
+}
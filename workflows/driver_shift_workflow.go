@@ -0,0 +1,348 @@
+package workflows
+
+import (
+	"easyRide/activities"
+	"easyRide/models"
+	"easyRide/signals"
+	"fmt"
+	"go.temporal.io/sdk/workflow"
+	"time"
+)
+
+// Shift rules of the drivers.
+var (
+	// MaxShiftLength is the longest a shift can last, the driver is taken offline once it is over.
+	MaxShiftLength = 12 * time.Hour
+	// BreakAfter is the longest a driver can stay online without a break.
+	BreakAfter = 4 * time.Hour
+	// BreakLength is the length of a mandatory break, being offline that long also counts as a break.
+	BreakLength = 30 * time.Minute
+	// ShiftSignalsPerRun is the number of signals a shift handles before the history is trimmed with a
+	// continue-as-new, each location update adds an activity to the history.
+	ShiftSignalsPerRun = 500
+)
+
+// ShiftState is carried over the runs of a driver shift, the zero value starts a new shift.
+type ShiftState struct {
+	Started        bool
+	State          models.DriverState
+	Loc            int
+	ShiftOver      bool
+	BreakPending   bool
+	OfflinePending bool
+	// ShiftEnd is when the maximum shift length is reached
+	ShiftEnd     time.Time
+	OnlineFor    time.Duration
+	OnlineSince  time.Time
+	OfflineSince time.Time
+	// BreakEnd is when the break in progress is over
+	BreakEnd time.Time
+}
+
+// driverTransitions lists the legal moves of the driver state machine.
+var driverTransitions = map[models.DriverState][]models.DriverState{
+	models.DriverOffline:   {models.DriverAvailable},
+	models.DriverAvailable: {models.DriverOffered, models.DriverOnBreak, models.DriverOffline},
+	models.DriverOffered:   {models.DriverEnRoute, models.DriverAvailable},
+	models.DriverEnRoute:   {models.DriverOnTrip, models.DriverAvailable},
+	models.DriverOnTrip:    {models.DriverAvailable},
+	models.DriverOnBreak:   {models.DriverAvailable, models.DriverOffline},
+}
+
+func legalTransition(from, to models.DriverState) bool {
+	for _, s := range driverTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// driverShift is the state of a running shift.
+type driverShift struct {
+	ctx      workflow.Context
+	driverID int
+	state    models.DriverState
+	loc      int
+
+	shiftOver      bool
+	breakPending   bool
+	offlinePending bool
+
+	// online time since the last break
+	onlineFor    time.Duration
+	onlineSince  time.Time
+	offlineSince time.Time
+
+	shiftEnd       time.Time
+	breakEnd       time.Time
+	breakDue       workflow.Future
+	cancelBreakDue workflow.CancelFunc
+	breakOver      workflow.Future
+}
+
+// DriverShiftWorkflow starts after the driver logging in and tracks the driver through the shift:
+// offline -> available -> offered -> en route to pickup -> on trip -> available.
+// It ends once the maximum shift length is reached and the driver is offline, and continues as new every
+// ShiftSignalsPerRun signals with the state of the shift carried over.
+func DriverShiftWorkflow(ctx workflow.Context, driverID int, carried ShiftState) error {
+	ao := workflow.ActivityOptions{
+		StartToCloseTimeout: 10 * time.Second,
+	}
+	ctx = workflow.WithActivityOptions(ctx, ao)
+	logger := workflow.GetLogger(ctx)
+	logger.Info("Driver shift started.", "DriverID", driverID)
+
+	now := workflow.Now(ctx)
+	s := &driverShift{
+		ctx:          ctx,
+		driverID:     driverID,
+		state:        models.DriverOffline,
+		loc:          -1,
+		offlineSince: now,
+		shiftEnd:     now.Add(MaxShiftLength),
+	}
+	if carried.Started {
+		s.resume(carried)
+	}
+	stateChannel := workflow.GetSignalChannel(ctx, signals.SIGNAL_DRIVER_STATE)
+	locChannel := workflow.GetSignalChannel(ctx, signals.SIGNAL_DRIVER_LOCATION)
+	offlineChannel := workflow.GetSignalChannel(ctx, signals.SIGNAL_DRIVER_GO_OFFLINE)
+	var shiftTimer workflow.Future
+	if !s.shiftOver {
+		shiftTimer = workflow.NewTimer(ctx, untilDeadline(s.shiftEnd, now))
+	}
+
+	var err error
+	signalCount := 0
+	receiveState := func(c workflow.ReceiveChannel, more bool) {
+		var change models.DriverStateChange
+		c.Receive(ctx, &change)
+		signalCount++
+		err = s.requestState(change)
+	}
+	receiveLoc := func(c workflow.ReceiveChannel, more bool) {
+		var loc int
+		c.Receive(ctx, &loc)
+		signalCount++
+		err = s.updateLoc(loc)
+	}
+	receiveOffline := func(c workflow.ReceiveChannel, more bool) {
+		c.Receive(ctx, nil)
+		signalCount++
+		err = s.goOffline()
+	}
+	for err == nil && !(s.shiftOver && s.state == models.DriverOffline) {
+		if signalCount >= ShiftSignalsPerRun {
+			// the signals received since the last one handled would be lost with the history, handle them first
+			selector := workflow.NewSelector(ctx)
+			selector.AddReceive(stateChannel, receiveState)
+			selector.AddReceive(locChannel, receiveLoc)
+			selector.AddReceive(offlineChannel, receiveOffline)
+			if selector.HasPending() {
+				selector.Select(ctx)
+				continue
+			}
+			logger.Info("Driver shift continues as new.", "DriverID", driverID, "Signals", signalCount)
+			return workflow.NewContinueAsNewError(ctx, DriverShiftWorkflow, driverID, s.carry())
+		}
+		selector := workflow.NewSelector(ctx)
+		selector.AddReceive(stateChannel, receiveState)
+		selector.AddReceive(locChannel, receiveLoc)
+		selector.AddReceive(offlineChannel, receiveOffline)
+		if shiftTimer != nil {
+			selector.AddFuture(shiftTimer, func(f workflow.Future) {
+				shiftTimer = nil
+				logger.Info("Maximum shift length reached.", "DriverID", driverID)
+				s.shiftOver = true
+				err = s.goOffline()
+			})
+		}
+		if s.breakDue != nil {
+			selector.AddFuture(s.breakDue, func(f workflow.Future) {
+				s.breakDue = nil
+				if f.Get(ctx, nil) != nil {
+					// cancelled when the driver went offline
+					return
+				}
+				if s.state != models.DriverAvailable {
+					// take the break as soon as the current trip is over
+					s.breakPending = true
+					return
+				}
+				err = s.moveTo(models.DriverOnBreak)
+			})
+		}
+		if s.breakOver != nil {
+			selector.AddFuture(s.breakOver, func(f workflow.Future) {
+				s.breakOver = nil
+				if s.state == models.DriverOnBreak {
+					err = s.moveTo(models.DriverAvailable)
+				}
+			})
+		}
+		selector.Select(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	logger.Info("Driver shift ended.", "DriverID", driverID)
+	return nil
+}
+
+// requestState applies a state change asked by the driver, the matching or the trip.
+// Illegal changes are rejected without failing the shift.
+func (s *driverShift) requestState(change models.DriverStateChange) error {
+	logger := workflow.GetLogger(s.ctx)
+	switch {
+	case change.State == models.DriverAvailable && s.state == models.DriverOnBreak:
+		logger.Warn("Rejected state change, the break is not over.", "DriverID", s.driverID)
+		return nil
+	case change.State == models.DriverAvailable && s.state == models.DriverOffline && s.shiftOver:
+		logger.Warn("Rejected state change, the shift is over.", "DriverID", s.driverID)
+		return nil
+	case !legalTransition(s.state, change.State):
+		logger.Warn("Rejected illegal state change.", "DriverID", s.driverID, "From", s.state, "To", change.State)
+		return nil
+	}
+	if change.State == models.DriverAvailable {
+		s.loc = change.Loc
+	}
+	return s.moveTo(change.State)
+}
+
+// moveTo makes a legal transition and applies the rules held back while the driver was busy.
+func (s *driverShift) moveTo(to models.DriverState) error {
+	if !legalTransition(s.state, to) {
+		return fmt.Errorf("illegal driver state change from %s to %s", s.state, to)
+	}
+	err := workflow.ExecuteActivity(s.ctx, activities.SyncDriverState, s.driverID, to, s.loc).Get(s.ctx, nil)
+	if err != nil {
+		return err
+	}
+	from := s.state
+	s.state = to
+	now := workflow.Now(s.ctx)
+
+	switch to {
+	case models.DriverAvailable:
+		if from == models.DriverOffline || from == models.DriverOnBreak {
+			s.startBreakDue(now)
+		}
+		switch {
+		case s.shiftOver || s.offlinePending:
+			return s.moveTo(models.DriverOffline)
+		case s.breakPending:
+			return s.moveTo(models.DriverOnBreak)
+		}
+	case models.DriverOnBreak:
+		s.stopBreakDue(now)
+		s.breakPending = false
+		s.onlineFor = 0
+		s.breakEnd = now.Add(BreakLength)
+		s.breakOver = workflow.NewTimer(s.ctx, BreakLength)
+	case models.DriverOffline:
+		s.stopBreakDue(now)
+		s.offlinePending = false
+		s.offlineSince = now
+	}
+	return nil
+}
+
+// goOffline takes the driver offline now, or after the current trip.
+func (s *driverShift) goOffline() error {
+	switch s.state {
+	case models.DriverOffline:
+		return nil
+	case models.DriverAvailable, models.DriverOnBreak:
+		return s.moveTo(models.DriverOffline)
+	default:
+		s.offlinePending = true
+		return nil
+	}
+}
+
+// updateLoc records the driver's location, an offline driver is kept out of the map.
+func (s *driverShift) updateLoc(loc int) error {
+	s.loc = loc
+	if s.state == models.DriverOffline {
+		return nil
+	}
+	return workflow.ExecuteActivity(s.ctx, activities.UpdateDriverLocation, s.driverID, loc).Get(s.ctx, nil)
+}
+
+// carry is the state of the shift carried over to the next run.
+func (s *driverShift) carry() ShiftState {
+	return ShiftState{
+		Started:        true,
+		State:          s.state,
+		Loc:            s.loc,
+		ShiftOver:      s.shiftOver,
+		BreakPending:   s.breakPending,
+		OfflinePending: s.offlinePending,
+		ShiftEnd:       s.shiftEnd,
+		OnlineFor:      s.onlineFor,
+		OnlineSince:    s.onlineSince,
+		OfflineSince:   s.offlineSince,
+		BreakEnd:       s.breakEnd,
+	}
+}
+
+// resume picks up the shift carried over from the previous run, the timers of the previous run start over for
+// the time they had left.
+func (s *driverShift) resume(carried ShiftState) {
+	now := workflow.Now(s.ctx)
+	s.state = carried.State
+	s.loc = carried.Loc
+	s.shiftOver = carried.ShiftOver
+	s.breakPending = carried.BreakPending
+	s.offlinePending = carried.OfflinePending
+	s.shiftEnd = carried.ShiftEnd
+	s.onlineFor = carried.OnlineFor
+	s.onlineSince = carried.OnlineSince
+	s.offlineSince = carried.OfflineSince
+	s.breakEnd = carried.BreakEnd
+
+	switch s.state {
+	case models.DriverOffline:
+	case models.DriverOnBreak:
+		s.breakOver = workflow.NewTimer(s.ctx, untilDeadline(s.breakEnd, now))
+	default:
+		// the online time is still counting, a break already due waits for the current trip
+		var ctx workflow.Context
+		ctx, s.cancelBreakDue = workflow.WithCancel(s.ctx)
+		if !s.breakPending {
+			s.breakDue = workflow.NewTimer(ctx, untilDeadline(s.onlineSince.Add(BreakAfter-s.onlineFor), now))
+		}
+	}
+}
+
+// untilDeadline is the time left until the deadline, none once it has passed.
+func untilDeadline(deadline time.Time, now time.Time) time.Duration {
+	if left := deadline.Sub(now); left > 0 {
+		return left
+	}
+	return 0
+}
+
+// startBreakDue starts counting the online time towards the next mandatory break.
+func (s *driverShift) startBreakDue(now time.Time) {
+	if now.Sub(s.offlineSince) >= BreakLength {
+		s.onlineFor = 0
+	}
+	s.onlineSince = now
+	var ctx workflow.Context
+	ctx, s.cancelBreakDue = workflow.WithCancel(s.ctx)
+	s.breakDue = workflow.NewTimer(ctx, BreakAfter-s.onlineFor)
+}
+
+// stopBreakDue pauses the online time count.
+func (s *driverShift) stopBreakDue(now time.Time) {
+	if s.cancelBreakDue == nil {
+		return
+	}
+	s.onlineFor += now.Sub(s.onlineSince)
+	s.cancelBreakDue()
+	s.cancelBreakDue = nil
+	s.breakDue = nil
+}
@@ -0,0 +1,127 @@
+package workflows
+
+import (
+	"easyRide/activities"
+	"easyRide/models"
+	"errors"
+	"github.com/stretchr/testify/mock"
+	"go.temporal.io/sdk/converter"
+	"go.temporal.io/sdk/workflow"
+	"time"
+)
+
+func (s *UnitTestSuite) Test_DriverShiftWorkflow_Transitions() {
+	s.env.OnActivity(activities.SyncDriverState, mock.Anything, 7, models.DriverAvailable, 3).Return(nil).Once()
+	s.env.OnActivity(activities.SyncDriverState, mock.Anything, 7, models.DriverOffered, 3).Return(nil).Once()
+	s.env.OnActivity(activities.SyncDriverState, mock.Anything, 7, models.DriverEnRoute, 3).Return(nil).Once()
+	s.env.OnActivity(activities.SyncDriverState, mock.Anything, 7, models.DriverOnTrip, 3).Return(nil).Once()
+	s.env.OnActivity(activities.SyncDriverState, mock.Anything, 7, models.DriverAvailable, 9).Return(nil).Once()
+	s.env.OnActivity(activities.SyncDriverState, mock.Anything, 7, models.DriverOffline, 9).Return(nil).Once()
+
+	s.env.RegisterDelayedCallback(func() {
+		s.env.SignalWorkflow("signal_driver_state", models.DriverStateChange{State: models.DriverAvailable, Loc: 3})
+	}, time.Millisecond*1)
+	s.env.RegisterDelayedCallback(func() {
+		// illegal: the driver has not been offered a trip
+		s.env.SignalWorkflow("signal_driver_state", models.DriverStateChange{State: models.DriverOnTrip})
+		s.env.SignalWorkflow("signal_driver_state", models.DriverStateChange{State: models.DriverOffered, PassengerID: 1})
+		s.env.SignalWorkflow("signal_driver_state", models.DriverStateChange{State: models.DriverEnRoute})
+		s.env.SignalWorkflow("signal_driver_state", models.DriverStateChange{State: models.DriverOnTrip})
+	}, time.Millisecond*2)
+	s.env.RegisterDelayedCallback(func() {
+		// held back until the trip is over
+		s.env.SignalWorkflow("signal_driver_go_offline", nil)
+	}, time.Millisecond*3)
+	s.env.RegisterDelayedCallback(func() {
+		s.env.SignalWorkflow("signal_driver_state", models.DriverStateChange{State: models.DriverAvailable, Loc: 9})
+	}, time.Millisecond*4)
+
+	s.env.ExecuteWorkflow(DriverShiftWorkflow, 7, ShiftState{})
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.NoError(s.env.GetWorkflowError())
+}
+
+func (s *UnitTestSuite) Test_DriverShiftWorkflow_Breaks() {
+	// online at start, breaks at 4h and 8h30, shift over at 12h
+	s.env.OnActivity(activities.SyncDriverState, mock.Anything, 7, models.DriverAvailable, 3).Return(nil).Times(3)
+	s.env.OnActivity(activities.SyncDriverState, mock.Anything, 7, models.DriverOnBreak, 3).Return(nil).Times(2)
+	s.env.OnActivity(activities.SyncDriverState, mock.Anything, 7, models.DriverOffline, 3).Return(nil).Once()
+
+	s.env.RegisterDelayedCallback(func() {
+		s.env.SignalWorkflow("signal_driver_state", models.DriverStateChange{State: models.DriverAvailable, Loc: 3})
+	}, time.Millisecond*1)
+	s.env.RegisterDelayedCallback(func() {
+		// rejected: the break is not over
+		s.env.SignalWorkflow("signal_driver_state", models.DriverStateChange{State: models.DriverAvailable, Loc: 3})
+	}, BreakAfter+time.Minute)
+
+	s.env.ExecuteWorkflow(DriverShiftWorkflow, 7, ShiftState{})
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.NoError(s.env.GetWorkflowError())
+}
+
+func (s *UnitTestSuite) Test_DriverShiftWorkflow_ContinueAsNew() {
+	signalsPerRun := ShiftSignalsPerRun
+	ShiftSignalsPerRun = 3
+	defer func() { ShiftSignalsPerRun = signalsPerRun }()
+
+	// the carried times come back in UTC
+	start := s.env.Now().UTC()
+	s.env.OnActivity(activities.SyncDriverState, mock.Anything, 7, models.DriverAvailable, 3).Return(nil).Once()
+	s.env.OnActivity(activities.UpdateDriverLocation, mock.Anything, 7, 5).Return(nil).Once()
+	s.env.OnActivity(activities.SyncDriverState, mock.Anything, 7, models.DriverOffered, 5).Return(nil).Once()
+	// received with the last signal of the run, handled before the continue-as-new
+	s.env.OnActivity(activities.UpdateDriverLocation, mock.Anything, 7, 6).Return(nil).Once()
+
+	s.env.RegisterDelayedCallback(func() {
+		s.env.SignalWorkflow("signal_driver_state", models.DriverStateChange{State: models.DriverAvailable, Loc: 3})
+	}, time.Millisecond*1)
+	s.env.RegisterDelayedCallback(func() {
+		s.env.SignalWorkflow("signal_driver_location", 5)
+	}, time.Millisecond*2)
+	s.env.RegisterDelayedCallback(func() {
+		s.env.SignalWorkflow("signal_driver_state", models.DriverStateChange{State: models.DriverOffered, PassengerID: 1})
+		s.env.SignalWorkflow("signal_driver_location", 6)
+	}, time.Millisecond*3)
+
+	s.env.ExecuteWorkflow(DriverShiftWorkflow, 7, ShiftState{})
+
+	s.True(s.env.IsWorkflowCompleted())
+	var continued *workflow.ContinueAsNewError
+	s.True(errors.As(s.env.GetWorkflowError(), &continued))
+	var driverID int
+	var carried ShiftState
+	s.NoError(converter.GetDefaultDataConverter().FromPayloads(continued.Input, &driverID, &carried))
+	s.Equal(7, driverID)
+	s.Equal(ShiftState{
+		Started:      true,
+		State:        models.DriverOffered,
+		Loc:          6,
+		ShiftEnd:     start.Add(MaxShiftLength),
+		OnlineSince:  start.Add(time.Millisecond),
+		OfflineSince: start,
+	}, carried)
+}
+
+func (s *UnitTestSuite) Test_DriverShiftWorkflow_Resumed() {
+	// carried over on a break with an hour of shift left
+	start := s.env.Now()
+	s.env.OnActivity(activities.SyncDriverState, mock.Anything, 7, models.DriverAvailable, 3).Return(nil).Once()
+	s.env.OnActivity(activities.SyncDriverState, mock.Anything, 7, models.DriverOffline, 3).Return(nil).Once()
+
+	s.env.ExecuteWorkflow(DriverShiftWorkflow, 7, ShiftState{
+		Started:      true,
+		State:        models.DriverOnBreak,
+		Loc:          3,
+		ShiftEnd:     start.Add(time.Hour),
+		OnlineFor:    0,
+		OfflineSince: start.Add(-time.Hour),
+		BreakEnd:     start.Add(10 * time.Minute),
+	})
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.NoError(s.env.GetWorkflowError())
+	s.Equal(time.Hour, s.env.Now().Sub(start))
+}
@@ -2,67 +2,150 @@ package workflows
 
 import (
 	"easyRide/activities"
+	"easyRide/models"
 	"easyRide/signals"
 	"go.temporal.io/sdk/workflow"
-	"log"
 	"time"
 )
 
 // MainWorkFlow starts after the passenger logging in.
 func MainWorkFlow(ctx workflow.Context, passengerID int) error {
+	// the workflow logger leaves out the messages of a replay
+	logger := workflow.GetLogger(ctx)
+	// The trip itself can be long-time, it runs with its own heartbeat options
 	ao := workflow.ActivityOptions{
-		// The trip can be long-time, set heartbeat instead of time to close
-		HeartbeatTimeout:    1 * time.Minute,
 		StartToCloseTimeout: 60 * time.Second,
 	}
 	ctx = workflow.WithActivityOptions(ctx, ao)
 
-	for {
-		status := signals.ReceiveSignal(ctx, signals.MATCH_SIGNAL)
-		if status == true {
-			break
-		} else {
-			log.Printf("Cannot match passenger %d, trying again.", passengerID)
+	tripStatus := &models.TripStatus{Stage: models.StageMatching, MatchRadius: models.InitialMatchRadius}
+	err := workflow.SetQueryHandler(ctx, signals.QUERY_TRIP_STATUS, func() (models.TripStatus, error) {
+		return *tripStatus, nil
+	})
+	if err != nil {
+		return err
+	}
+	replies := ratingReplies{}
+	err = workflow.SetQueryHandler(ctx, signals.QUERY_RATING_REPLY,
+		func(rater string, requestID string) (models.RatingReply, error) {
+			return replies.reply(tripStatus, rater, requestID), nil
+		})
+	if err != nil {
+		return err
+	}
+
+	match, err := awaitMatch(ctx, passengerID, tripStatus)
+	if err != nil {
+		return err
+	}
+	if !match.Matched {
+		logger.Info("Cannot find driver, trip request cancelled.", "PassengerID", passengerID)
+		return nil
+	}
+
+	logger.Info("Found driver.", "PassengerID", passengerID, "DriverID", match.DriverID)
+	if changeVersion(ctx, ChangeTripCompensation) == workflow.DefaultVersion {
+		return trip(ctx, passengerID, match, tripStatus, replies, nil)
+	}
+	// a trip failing from now on is undone, the passenger and the driver are left free
+	undo := &compensations{}
+	if err := trip(ctx, passengerID, match, tripStatus, replies, undo); err != nil {
+		return undo.compensate(ctx, err)
+	}
+	return nil
+}
+
+// trip runs the trip of the matched passenger from the pickup to the end, registering the undo of its steps in undo.
+func trip(ctx workflow.Context, passengerID int, match models.MatchResult, tripStatus *models.TripStatus,
+	replies ratingReplies, undo *compensations) error {
+	logger := workflow.GetLogger(ctx)
+	tripID := workflow.GetInfo(ctx).WorkflowExecution.ID
+	// the matching took the passenger and the driver
+	undo.add(activities.RestorePassenger, tripID, passengerID)
+	forgetDriver := undo.add(activities.ReleaseDriver, tripID, passengerID, match)
+
+	if match.Pooled {
+		watchRoute(ctx, passengerID, tripStatus)
+	}
+	// the trips started before the pickup phase go on the ride once matched
+	outcome := outcomePickedUp
+	if changeVersion(ctx, ChangePickupPhase) != workflow.DefaultVersion {
+		tripStatus.Stage = models.StagePickup
+		var err error
+		if outcome, err = pickup(ctx, passengerID, match); err != nil {
+			return err
 		}
 	}
+	switch outcome {
+	case outcomeNoShow:
+		logger.Info("Passenger did not show up, trip ended.", "PassengerID", passengerID)
+		tripStatus.Stage = models.StageNoShow
+		return nil
+	case outcomeDriverLate:
+		logger.Info("Driver did not show up, passenger released.", "PassengerID", passengerID)
+		tripStatus.Stage = models.StageDriverLate
+		return nil
+	}
 
-	log.Printf("Succesfully found driver for passenger %d", passengerID)
-	err := workflow.ExecuteActivity(ctx, activities.InTrip, passengerID).Get(ctx, nil)
+	tripStatus.Stage = models.StageInTrip
+	err := inTrip(ctx, passengerID, match)
 	if err != nil {
 		return err
 	}
 
 	// driver rate passenger
-	log.Printf("Driver please rate passenger %d", passengerID)
-	err = workflow.ExecuteActivity(ctx, activities.Rate).Get(ctx, nil)
+	tripStatus.Stage = models.StageRating
+	logger.Info("Driver please rate passenger.", "PassengerID", passengerID)
+	err = awaitRating(ctx, tripStatus, replies, signals.SIGNAL_RATE_PASSENGER, models.RaterDriver, passengerID,
+		match.DriverID)
 	if err != nil {
 		return err
 	}
-	err = workflow.ExecuteActivity(ctx, activities.Arrive, passengerID).Get(ctx, nil)
+	err = workflow.ExecuteActivity(ctx, activities.Arrive, passengerID, match).Get(ctx, nil)
 	if err != nil {
 		return err
 	}
+	// the driver is free once arrived, and may be on the next trip already
+	forgetDriver()
 
-	log.Printf("Passenger %d please make payment...", passengerID)
+	tripStatus.Stage = models.StagePayment
+	logger.Info("Passenger please make payment.", "PassengerID", passengerID)
+	paymentChannel := workflow.GetSignalChannel(ctx, signals.SIGNAL_PAYMENT)
+	var payment models.PaymentResult
 	for {
-		status := signals.ReceiveSignal(ctx, signals.SIGNAL_PAYMENT)
-		if status == true {
+		paymentChannel.Receive(ctx, &payment)
+		if payment.Paid {
 			break
-		} else {
-			log.Println("Payment cannot be completed.")
 		}
+		logger.Warn("Payment cannot be completed.", "PassengerID", passengerID, "Paid", payment.Amount,
+			"Expected", payment.Expected)
+	}
+	// the trips started before the compensations do not record the payment
+	if undo != nil {
+		voidPayment := undo.add(activities.VoidPayment, tripID, passengerID)
+		err = workflow.ExecuteActivity(ctx, activities.RecordPayment, tripID, payment).Get(ctx, nil)
+		if err != nil {
+			return err
+		}
+		// the ride is paid for, nothing from now on refunds it
+		voidPayment()
 	}
 
 	// passenger rate driver
-	log.Printf("Passenger %d please rate driver", passengerID)
-	err = workflow.ExecuteActivity(ctx, activities.Rate).Get(ctx, nil)
+	tripStatus.Stage = models.StageRating
+	logger.Info("Passenger please rate driver.", "PassengerID", passengerID)
+	err = awaitRating(ctx, tripStatus, replies, signals.SIGNAL_RATE_DRIVER, models.RaterPassenger, passengerID,
+		match.DriverID)
 	if err != nil {
 		return err
 	}
 
-	err = workflow.ExecuteActivity(ctx, activities.PassengerEndTrip, passengerID).Get(ctx, nil)
+	// the ride is over, ending the trip is retried rather than undone, also once the trip is cancelled
+	endCtx, _ := workflow.NewDisconnectedContext(ctx)
+	err = workflow.ExecuteActivity(endCtx, activities.PassengerEndTrip, passengerID).Get(endCtx, nil)
 	if err != nil {
 		return err
 	}
+	tripStatus.Stage = models.StageCompleted
 	return nil
 }
@@ -0,0 +1,245 @@
+package workflows
+
+import (
+	"context"
+	"easyRide/activities"
+	"easyRide/models"
+	"errors"
+	"github.com/stretchr/testify/mock"
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/temporal"
+	"time"
+)
+
+// queryStatus returns the trip status of the workflow under test.
+func (s *UnitTestSuite) queryStatus() models.TripStatus {
+	var status models.TripStatus
+	res, err := s.env.QueryWorkflow("trip_status")
+	s.NoError(err)
+	s.NoError(res.Get(&status))
+	return status
+}
+
+// signalRide matches the passenger with the test driver and picks the passenger up.
+func (s *UnitTestSuite) signalRide() {
+	s.env.RegisterDelayedCallback(func() {
+		s.env.SignalWorkflow("signal_match", testMatch)
+		s.env.SignalWorkflow("signal_passenger_picked_up", nil)
+	}, time.Millisecond*1)
+}
+
+func (s *UnitTestSuite) Test_MainWorkflow_PaymentDeclined() {
+	s.env.OnActivity(activities.DriverArrivedAtPickup, mock.Anything, mock.Anything, 1, testMatch).Return(nil)
+	s.env.OnActivity(activities.PickUp, mock.Anything, mock.Anything, 1, testMatch).Return(nil)
+	s.env.OnActivity(activities.InTrip, mock.Anything, 1, testMatch).Return(nil)
+	s.env.OnActivity(activities.Arrive, mock.Anything, 1, testMatch).Return(nil).Once()
+	s.env.OnActivity(activities.MissRating, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	// the trip only ends once paid, with the accepted payment recorded
+	s.env.OnActivity(activities.RecordPayment, mock.Anything, mock.Anything,
+		models.PaymentResult{Paid: true, Amount: 12, Expected: 12}).Return(nil).Once()
+	s.env.OnActivity(activities.PassengerEndTrip, mock.Anything, 1).Return(nil).Once()
+
+	s.signalRide()
+	paid := RatingWindow + time.Minute
+	for i := 1; i <= 3; i++ {
+		s.env.RegisterDelayedCallback(func() {
+			s.env.SignalWorkflow("signal_payment", models.PaymentResult{Amount: 5, Expected: 12})
+		}, paid-time.Duration(i)*time.Second)
+	}
+	s.env.RegisterDelayedCallback(func() {
+		s.Equal(models.StagePayment, s.queryStatus().Stage)
+	}, paid-time.Millisecond)
+	s.env.RegisterDelayedCallback(func() {
+		s.env.SignalWorkflow("signal_payment", models.PaymentResult{Paid: true, Amount: 12, Expected: 12})
+	}, paid)
+
+	s.env.ExecuteWorkflow(MainWorkFlow, 1)
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.NoError(s.env.GetWorkflowError())
+	s.Equal(models.StageCompleted, s.queryStatus().Stage)
+}
+
+func (s *UnitTestSuite) Test_MainWorkflow_NotMatchedRounds() {
+	s.env.OnActivity(activities.WidenMatchRadius, mock.Anything, 1, 10).Return(nil).Once()
+	s.env.OnActivity(activities.WidenMatchRadius, mock.Anything, 1, 15).Return(nil).Once()
+	s.env.OnActivity(activities.WidenMatchRadius, mock.Anything, 1, 20).Return(nil).Once()
+	s.env.OnActivity(activities.DriverArrivedAtPickup, mock.Anything, mock.Anything, 1, testMatch).Return(nil).Once()
+	s.env.OnActivity(activities.NoShow, mock.Anything, mock.Anything, 1, testMatch, NoShowFee).Return(nil).Once()
+
+	for round := 1; round <= 3; round++ {
+		s.env.RegisterDelayedCallback(func() {
+			s.env.SignalWorkflow("signal_match", models.MatchResult{RoundID: "round-1"})
+		}, time.Duration(round)*time.Minute)
+	}
+	s.env.RegisterDelayedCallback(func() {
+		s.env.SignalWorkflow("signal_match", testMatch)
+		s.env.SignalWorkflow("signal_driver_arrived_pickup", nil)
+	}, 4*time.Minute)
+
+	s.env.ExecuteWorkflow(MainWorkFlow, 1)
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.NoError(s.env.GetWorkflowError())
+	s.Equal(models.TripStatus{Stage: models.StageNoShow, MatchRounds: 3, MatchRadius: 20, DriverID: 2},
+		s.queryStatus())
+}
+
+func (s *UnitTestSuite) Test_MainWorkflow_WidenRadiusFails() {
+	s.env.OnActivity(activities.WidenMatchRadius, mock.Anything, 1, 10).
+		Return(temporal.NewNonRetryableApplicationError("passenger not found", "NotFound", nil)).Once()
+
+	s.env.RegisterDelayedCallback(func() {
+		s.env.SignalWorkflow("signal_match", models.MatchResult{RoundID: "round-1"})
+	}, time.Minute)
+
+	s.env.ExecuteWorkflow(MainWorkFlow, 1)
+
+	s.True(s.env.IsWorkflowCompleted())
+	var appErr *temporal.ApplicationError
+	s.True(errors.As(s.env.GetWorkflowError(), &appErr))
+	s.Equal("NotFound", appErr.Type())
+}
+
+func (s *UnitTestSuite) Test_MainWorkflow_ArriveRetried() {
+	s.env.OnActivity(activities.DriverArrivedAtPickup, mock.Anything, mock.Anything, 1, testMatch).Return(nil)
+	s.env.OnActivity(activities.PickUp, mock.Anything, mock.Anything, 1, testMatch).Return(nil)
+	s.env.OnActivity(activities.InTrip, mock.Anything, 1, testMatch).Return(nil)
+	s.env.OnActivity(activities.MissRating, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	// the database is back on the third attempt
+	s.env.OnActivity(activities.Arrive, mock.Anything, 1, testMatch).Return(errors.New("connection refused")).Twice()
+	s.env.OnActivity(activities.Arrive, mock.Anything, 1, testMatch).Return(nil).Once()
+	s.env.OnActivity(activities.RecordPayment, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	s.env.OnActivity(activities.PassengerEndTrip, mock.Anything, 1).Return(nil).Once()
+
+	s.signalRide()
+	s.env.RegisterDelayedCallback(func() {
+		s.env.SignalWorkflow("signal_payment", models.PaymentResult{Paid: true})
+	}, time.Minute)
+
+	s.env.ExecuteWorkflow(MainWorkFlow, 1)
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.NoError(s.env.GetWorkflowError())
+}
+
+func (s *UnitTestSuite) Test_MainWorkflow_ArriveFails() {
+	s.env.OnActivity(activities.DriverArrivedAtPickup, mock.Anything, mock.Anything, 1, testMatch).Return(nil)
+	s.env.OnActivity(activities.PickUp, mock.Anything, mock.Anything, 1, testMatch).Return(nil)
+	s.env.OnActivity(activities.InTrip, mock.Anything, 1, testMatch).Return(nil)
+	s.env.OnActivity(activities.MissRating, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	s.env.OnActivity(activities.Arrive, mock.Anything, 1, testMatch).
+		Return(temporal.NewNonRetryableApplicationError("no destination", "NoDestination", nil)).Once()
+	// the driver is released before the passenger
+	var undone []string
+	s.env.OnActivity(activities.ReleaseDriver, mock.Anything, mock.Anything, 1, testMatch).Return(nil).Once().
+		Run(func(mock.Arguments) { undone = append(undone, "ReleaseDriver") })
+	s.env.OnActivity(activities.RestorePassenger, mock.Anything, mock.Anything, 1).Return(nil).Once().
+		Run(func(mock.Arguments) { undone = append(undone, "RestorePassenger") })
+
+	s.signalRide()
+
+	s.env.ExecuteWorkflow(MainWorkFlow, 1)
+
+	s.True(s.env.IsWorkflowCompleted())
+	var appErr *temporal.ApplicationError
+	s.True(errors.As(s.env.GetWorkflowError(), &appErr))
+	s.Equal("NoDestination", appErr.Type())
+	// the passenger was never asked to pay
+	s.Equal(models.StageRating, s.queryStatus().Stage)
+	s.Equal([]string{"ReleaseDriver", "RestorePassenger"}, undone)
+}
+
+func (s *UnitTestSuite) Test_MainWorkflow_EndTripRetried() {
+	s.rideToPayment()
+	s.env.OnActivity(activities.RecordPayment, mock.Anything, "default-test-workflow-id",
+		models.PaymentResult{Paid: true, Amount: 12, Expected: 12}).Return(nil).Once()
+	// the database is back on the third attempt, the paid ride is neither refunded nor undone
+	s.env.OnActivity(activities.PassengerEndTrip, mock.Anything, 1).Return(errors.New("connection refused")).Twice()
+	s.env.OnActivity(activities.PassengerEndTrip, mock.Anything, 1).Return(nil).Once()
+
+	s.env.ExecuteWorkflow(MainWorkFlow, 1)
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.NoError(s.env.GetWorkflowError())
+	s.Equal(models.StageCompleted, s.queryStatus().Stage)
+}
+
+func (s *UnitTestSuite) Test_MainWorkflow_InTripHeartbeatTimeout() {
+	s.env.OnActivity(activities.DriverArrivedAtPickup, mock.Anything, mock.Anything, 1, testMatch).Return(nil)
+	s.env.OnActivity(activities.PickUp, mock.Anything, mock.Anything, 1, testMatch).Return(nil)
+	s.env.OnActivity(activities.Arrive, mock.Anything, 1, testMatch).Return(nil)
+	s.env.OnActivity(activities.RecordPayment, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	s.env.OnActivity(activities.PassengerEndTrip, mock.Anything, 1).Return(nil)
+	s.env.OnActivity(activities.MissRating, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	// the worker running the trip goes silent halfway, the retry resumes from the last heartbeat
+	halfway := activities.TripProgress{DriverID: 2, Position: 7, Destination: 9, Elapsed: 60}
+	s.env.OnActivity(activities.InTrip, mock.Anything, 1, testMatch).
+		Return(func(ctx context.Context, passengerID int, match models.MatchResult) error {
+			activity.RecordHeartbeat(ctx, halfway)
+			return temporal.NewHeartbeatTimeoutError()
+		}).Once()
+	var resumed activities.TripProgress
+	s.env.OnActivity(activities.InTrip, mock.Anything, 1, testMatch).
+		Return(func(ctx context.Context, passengerID int, match models.MatchResult) error {
+			if !activity.HasHeartbeatDetails(ctx) {
+				return temporal.NewNonRetryableApplicationError("trip restarted", "Restarted", nil)
+			}
+			return activity.GetHeartbeatDetails(ctx, &resumed)
+		}).Once()
+
+	s.signalRide()
+	s.env.RegisterDelayedCallback(func() {
+		s.env.SignalWorkflow("signal_payment", models.PaymentResult{Paid: true})
+	}, time.Minute)
+
+	s.env.ExecuteWorkflow(MainWorkFlow, 1)
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.NoError(s.env.GetWorkflowError())
+	s.Equal(halfway, resumed)
+}
+
+// Test_MainWorkflow_Deterministic runs the same trip twice, the workflow must schedule the same activities at the
+// same times. Histories recorded by earlier versions are replayed in replay_test.go.
+func (s *UnitTestSuite) Test_MainWorkflow_Deterministic() {
+	run := func() []string {
+		env := s.NewTestWorkflowEnvironment()
+		start := env.Now()
+		var calls []string
+		record := func(name string) func(mock.Arguments) {
+			return func(mock.Arguments) {
+				calls = append(calls, name+"@"+env.Now().Sub(start).Round(time.Millisecond).String())
+			}
+		}
+		env.OnActivity(activities.DriverArrivedAtPickup, mock.Anything, mock.Anything, 1, testMatch).Return(nil).
+			Run(record("DriverArrivedAtPickup"))
+		env.OnActivity(activities.PickUp, mock.Anything, mock.Anything, 1, testMatch).Return(nil).Run(record("PickUp"))
+		env.OnActivity(activities.InTrip, mock.Anything, 1, testMatch).Return(nil).Run(record("InTrip"))
+		env.OnActivity(activities.Arrive, mock.Anything, 1, testMatch).Return(nil).Run(record("Arrive"))
+		env.OnActivity(activities.RecordPayment, mock.Anything, mock.Anything, mock.Anything).Return(nil).
+			Run(record("RecordPayment"))
+		env.OnActivity(activities.PassengerEndTrip, mock.Anything, 1).Return(nil).Run(record("PassengerEndTrip"))
+		env.OnActivity(activities.SubmitRating, mock.Anything, mock.Anything).Return(nil).Run(record("SubmitRating"))
+		env.OnActivity(activities.MissRating, mock.Anything, mock.Anything, mock.Anything).Return(nil).
+			Run(record("MissRating"))
+		env.RegisterDelayedCallback(func() {
+			env.SignalWorkflow("signal_match", testMatch)
+			env.SignalWorkflow("signal_driver_arrived_pickup", nil)
+			env.SignalWorkflow("signal_passenger_picked_up", nil)
+			env.SignalWorkflow("signal_rate_passenger", models.Rating{Score: 4})
+		}, time.Millisecond)
+		env.RegisterDelayedCallback(func() {
+			env.SignalWorkflow("signal_payment", models.PaymentResult{Paid: true})
+		}, time.Minute)
+		env.ExecuteWorkflow(MainWorkFlow, 1)
+		s.True(env.IsWorkflowCompleted())
+		s.NoError(env.GetWorkflowError())
+		return calls
+	}
+
+	first := run()
+	s.NotEmpty(first)
+	s.Equal(first, run())
+}
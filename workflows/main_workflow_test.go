@@ -2,6 +2,7 @@ package workflows
 
 import (
 	"easyRide/activities"
+	"easyRide/models"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/suite"
 	"go.temporal.io/sdk/testsuite"
@@ -16,6 +17,9 @@ type UnitTestSuite struct {
 	env *testsuite.TestWorkflowEnvironment
 }
 
+// testMatch is the driver found for the passenger in the tests.
+var testMatch = models.MatchResult{Matched: true, DriverID: 2, DriverLoc: 4, Cost: 0.1, RoundID: "round-1"}
+
 func (s *UnitTestSuite) SetupTest() {
 	s.env = s.NewTestWorkflowEnvironment()
 }
@@ -25,23 +29,226 @@ func (s *UnitTestSuite) AfterTest(suiteName, testName string) {
 }
 
 func (s *UnitTestSuite) Test_MainWorkflow_Success() {
-	s.env.OnActivity(activities.InTrip, mock.Anything, mock.Anything).Return(nil)
-	s.env.OnActivity(activities.Arrive, mock.Anything, mock.Anything).Return(nil)
+	s.env.OnActivity(activities.DriverArrivedAtPickup, mock.Anything, mock.Anything, 1, testMatch).Return(nil).Once()
+	s.env.OnActivity(activities.PickUp, mock.Anything, mock.Anything, 1, testMatch).Return(nil).Once()
+	s.env.OnActivity(activities.InTrip, mock.Anything, 1, testMatch).Return(nil)
+	s.env.OnActivity(activities.Arrive, mock.Anything, 1, testMatch).Return(nil)
+	s.env.OnActivity(activities.RecordPayment, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	s.env.OnActivity(activities.PassengerEndTrip, mock.Anything, mock.Anything).Return(nil)
+	s.env.OnActivity(activities.SubmitRating, mock.Anything, mock.MatchedBy(func(r models.Rating) bool {
+		return r.Rater == models.RaterDriver && r.Score == 4 && r.PassengerID == 1 && r.DriverID == 2
+	})).Return(nil).Once()
+	s.env.OnActivity(activities.SubmitRating, mock.Anything, mock.MatchedBy(func(r models.Rating) bool {
+		return r.Rater == models.RaterPassenger && r.Score == 5 && r.PassengerID == 1 && r.DriverID == 2
+	})).Return(nil).Once()
+
+	s.env.RegisterDelayedCallback(func() {
+		s.env.SignalWorkflow("signal_match", testMatch)
+	}, time.Millisecond*1)
+
+	s.env.RegisterDelayedCallback(func() {
+		s.env.SignalWorkflow("signal_driver_arrived_pickup", nil)
+	}, time.Millisecond*2)
+
+	s.env.RegisterDelayedCallback(func() {
+		s.env.SignalWorkflow("signal_passenger_picked_up", nil)
+	}, time.Millisecond*3)
+
+	s.env.RegisterDelayedCallback(func() {
+		s.env.SignalWorkflow("signal_rate_passenger", models.Rating{Score: 4})
+	}, time.Millisecond*4)
+
+	s.env.RegisterDelayedCallback(func() {
+		s.env.SignalWorkflow("signal_payment", models.PaymentResult{Paid: true})
+	}, time.Millisecond*5)
+
+	s.env.RegisterDelayedCallback(func() {
+		s.env.SignalWorkflow("signal_rate_driver", models.Rating{Score: 5})
+	}, time.Millisecond*6)
+
+	s.env.ExecuteWorkflow(MainWorkFlow, 1)
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.NoError(s.env.GetWorkflowError())
+}
+
+func (s *UnitTestSuite) Test_MainWorkflow_RatingWindow() {
+	s.env.OnActivity(activities.DriverArrivedAtPickup, mock.Anything, mock.Anything, 1, testMatch).Return(nil).Once()
+	s.env.OnActivity(activities.PickUp, mock.Anything, mock.Anything, 1, testMatch).Return(nil).Once()
+	s.env.OnActivity(activities.InTrip, mock.Anything, 1, testMatch).Return(nil)
+	s.env.OnActivity(activities.Arrive, mock.Anything, 1, testMatch).Return(nil)
+	s.env.OnActivity(activities.RecordPayment, mock.Anything, mock.Anything, mock.Anything).Return(nil)
 	s.env.OnActivity(activities.PassengerEndTrip, mock.Anything, mock.Anything).Return(nil)
-	s.env.OnActivity(activities.Rate, mock.Anything, mock.Anything).Return(nil)
+	// only the first valid rating of the driver is stored, the passenger misses the window
+	s.env.OnActivity(activities.SubmitRating, mock.Anything, mock.MatchedBy(func(r models.Rating) bool {
+		return r.Rater == models.RaterDriver && r.Score == 3
+	})).Return(nil).Once()
+	s.env.OnActivity(activities.MissRating, mock.Anything, mock.Anything, models.RaterPassenger).Return(nil).Once()
 
 	s.env.RegisterDelayedCallback(func() {
-		s.env.SignalWorkflow("signal_match", true)
+		s.env.SignalWorkflow("signal_match", testMatch)
 	}, time.Millisecond*1)
 
 	s.env.RegisterDelayedCallback(func() {
-		s.env.SignalWorkflow("signal_payment", true)
+		// the arrival at pickup is not reported
+		s.env.SignalWorkflow("signal_passenger_picked_up", nil)
+	}, time.Millisecond*2)
+
+	s.env.RegisterDelayedCallback(func() {
+		s.env.SignalWorkflow("signal_rate_passenger", models.Rating{Score: 9})
+		s.env.SignalWorkflow("signal_rate_passenger", models.Rating{Score: 3})
+		s.env.SignalWorkflow("signal_rate_passenger", models.Rating{Score: 1})
+	}, time.Millisecond*3)
+
+	s.env.RegisterDelayedCallback(func() {
+		// the client is told the driver rated already
+		s.Equal(map[string]models.RatingState{models.RaterDriver: models.RatingRated}, s.queryStatus().Ratings)
+		s.env.SignalWorkflow("signal_payment", models.PaymentResult{Paid: true})
+	}, RatingWindow+time.Second)
+
+	s.env.RegisterDelayedCallback(func() {
+		s.Equal(map[string]models.RatingState{
+			models.RaterDriver:    models.RatingRated,
+			models.RaterPassenger: models.RatingMissed,
+		}, s.queryStatus().Ratings)
+		s.env.SignalWorkflow("signal_rate_driver", models.Rating{Score: 5})
+	}, 3*RatingWindow)
+
+	s.env.ExecuteWorkflow(MainWorkFlow, 1)
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.NoError(s.env.GetWorkflowError())
+}
+
+func (s *UnitTestSuite) Test_MainWorkflow_RatingReplies() {
+	s.env.OnActivity(activities.DriverArrivedAtPickup, mock.Anything, mock.Anything, 1, testMatch).Return(nil).Once()
+	s.env.OnActivity(activities.PickUp, mock.Anything, mock.Anything, 1, testMatch).Return(nil).Once()
+	s.env.OnActivity(activities.InTrip, mock.Anything, 1, testMatch).Return(nil)
+	s.env.OnActivity(activities.Arrive, mock.Anything, 1, testMatch).Return(nil)
+	s.env.OnActivity(activities.RecordPayment, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	s.env.OnActivity(activities.PassengerEndTrip, mock.Anything, mock.Anything).Return(nil)
+	// the rating sent during the pickup is dropped rather than taken once the window opens
+	s.env.OnActivity(activities.SubmitRating, mock.Anything, mock.MatchedBy(func(r models.Rating) bool {
+		return r.Rater == models.RaterDriver && r.Score == 3
+	})).Return(nil).Once()
+	s.env.OnActivity(activities.MissRating, mock.Anything, mock.Anything, models.RaterPassenger).Return(nil).Once()
+
+	s.env.RegisterDelayedCallback(func() {
+		s.env.SignalWorkflow("signal_match", testMatch)
+		s.env.SignalWorkflow("signal_rate_passenger", models.Rating{Score: 4, RequestID: "early"})
+	}, time.Millisecond*1)
+	s.env.RegisterDelayedCallback(func() {
+		s.Equal(models.RatingPending, s.queryRatingReply(models.RaterDriver, "early"))
+		s.env.SignalWorkflow("signal_passenger_picked_up", nil)
+	}, time.Millisecond*2)
+	s.env.RegisterDelayedCallback(func() {
+		s.env.SignalWorkflow("signal_rate_passenger", models.Rating{Score: 9, RequestID: "invalid"})
+		s.env.SignalWorkflow("signal_rate_passenger", models.Rating{Score: 3, RequestID: "first"})
+		// sent after the window was drained, the rating is never taken
+		s.env.SignalWorkflow("signal_rate_passenger", models.Rating{Score: 5, RequestID: "second"})
 	}, time.Millisecond*3)
+	s.env.RegisterDelayedCallback(func() {
+		s.Equal(models.RatingEarly, s.queryRatingReply(models.RaterDriver, "early"))
+		s.Equal(models.RatingInvalid, s.queryRatingReply(models.RaterDriver, "invalid"))
+		s.Equal(models.RatingAccepted, s.queryRatingReply(models.RaterDriver, "first"))
+		s.Equal(models.RatingDuplicate, s.queryRatingReply(models.RaterDriver, "second"))
+		// the window of the passenger is not open yet
+		s.Equal(models.RatingPending, s.queryRatingReply(models.RaterPassenger, "lost"))
+		s.env.SignalWorkflow("signal_payment", models.PaymentResult{Paid: true})
+	}, time.Millisecond*4)
+	s.env.RegisterDelayedCallback(func() {
+		// the passenger rates after the window closed
+		s.env.SignalWorkflow("signal_rate_driver", models.Rating{Score: 2, RequestID: "lost"})
+	}, 2*RatingWindow)
+
+	s.env.ExecuteWorkflow(MainWorkFlow, 1)
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.NoError(s.env.GetWorkflowError())
+	s.Equal(models.RatingLate, s.queryRatingReply(models.RaterPassenger, "lost"))
+}
+
+func (s *UnitTestSuite) queryRatingReply(rater string, requestID string) models.RatingReply {
+	var reply models.RatingReply
+	res, err := s.env.QueryWorkflow("rating_reply", rater, requestID)
+	s.NoError(err)
+	s.NoError(res.Get(&reply))
+	return reply
+}
+
+func (s *UnitTestSuite) Test_MainWorkflow_NoShow() {
+	s.env.OnActivity(activities.DriverArrivedAtPickup, mock.Anything, mock.Anything, 1, testMatch).Return(nil).Once()
+	s.env.OnActivity(activities.NoShow, mock.Anything, mock.Anything, 1, testMatch, NoShowFee).Return(nil).Once()
+
+	s.env.RegisterDelayedCallback(func() {
+		s.env.SignalWorkflow("signal_match", testMatch)
+	}, time.Millisecond*1)
+
+	s.env.RegisterDelayedCallback(func() {
+		s.env.SignalWorkflow("signal_driver_arrived_pickup", nil)
+	}, time.Millisecond*2)
+
+	s.env.RegisterDelayedCallback(func() {
+		// too late
+		s.env.SignalWorkflow("signal_passenger_picked_up", nil)
+	}, NoShowTimeout+time.Second)
+
+	s.env.ExecuteWorkflow(MainWorkFlow, 1)
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.NoError(s.env.GetWorkflowError())
+}
+
+func (s *UnitTestSuite) Test_MainWorkflow_DriverLate() {
+	start := s.env.Now()
+	s.env.OnActivity(activities.DriverLate, mock.Anything, "default-test-workflow-id", 1, testMatch).Return(nil).Once()
+
+	s.env.RegisterDelayedCallback(func() {
+		s.env.SignalWorkflow("signal_match", testMatch)
+	}, time.Millisecond*1)
+
+	s.env.RegisterDelayedCallback(func() {
+		// the trip was given up already
+		s.env.SignalWorkflow("signal_driver_arrived_pickup", nil)
+	}, EnRouteTimeout+time.Second)
+
+	s.env.ExecuteWorkflow(MainWorkFlow, 1)
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.NoError(s.env.GetWorkflowError())
+	s.Equal(models.StageDriverLate, s.queryStatus().Stage)
+	s.Equal(EnRouteTimeout+time.Millisecond, s.env.Now().Sub(start))
+}
+
+func (s *UnitTestSuite) Test_MainWorkflow_DriverReportsArrival() {
+	s.env.OnActivity(activities.DriverArrivedAtPickup, mock.Anything, mock.Anything, 1, testMatch).Return(nil)
+	s.env.OnActivity(activities.PickUp, mock.Anything, mock.Anything, 1, testMatch).Return(nil)
+	// the trip progress would take much longer than the driver
+	s.env.OnActivity(activities.InTrip, mock.Anything, 1, testMatch).Return(nil).After(time.Hour)
+	s.env.OnActivity(activities.Arrive, mock.Anything, 1, testMatch).Return(nil)
+	s.env.OnActivity(activities.RecordPayment, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	s.env.OnActivity(activities.PassengerEndTrip, mock.Anything, mock.Anything).Return(nil)
+	s.env.OnActivity(activities.MissRating, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	s.env.RegisterDelayedCallback(func() {
+		s.env.SignalWorkflow("signal_match", testMatch)
+		s.env.SignalWorkflow("signal_passenger_picked_up", nil)
+	}, time.Millisecond*1)
+
+	s.env.RegisterDelayedCallback(func() {
+		s.env.SignalWorkflow("signal_driver_arrived", nil)
+	}, time.Minute*10)
+
+	s.env.RegisterDelayedCallback(func() {
+		s.env.SignalWorkflow("signal_payment", models.PaymentResult{Paid: true})
+	}, time.Minute*11)
 
+	start := s.env.Now()
 	s.env.ExecuteWorkflow(MainWorkFlow, 1)
 
 	s.True(s.env.IsWorkflowCompleted())
 	s.NoError(s.env.GetWorkflowError())
+	s.Less(s.env.Now().Sub(start), time.Hour)
 }
 
 func TestUnitTestSuite(t *testing.T) {
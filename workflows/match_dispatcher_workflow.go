@@ -0,0 +1,150 @@
+package workflows
+
+import (
+	"easyRide/activities"
+	"easyRide/signals"
+	"go.temporal.io/sdk/workflow"
+	"time"
+)
+
+// DispatchOptions tunes the event-driven matcher.
+type DispatchOptions struct {
+	// BatchWindow is how long requests are collected after the first one before a round runs
+	BatchWindow time.Duration
+	// BatchThreshold is the number of collected requests that runs a round right away
+	BatchThreshold int
+	// SweepInterval runs a round when no round ran for that long
+	SweepInterval time.Duration
+	// MaxRounds is the number of rounds before the history is trimmed with a continue-as-new
+	MaxRounds int
+}
+
+// DispatchState is carried over the runs of the matcher, the zero value starts cold.
+type DispatchState struct {
+	LastRunTime time.Time
+	// Round is the state of the last round, the next one warm starts from it
+	Round activities.RoundState
+	// WarmRounds and LatencySaved add up the rounds that warm started and the solve time they saved
+	WarmRounds   int
+	LatencySaved time.Duration
+}
+
+// DefaultDispatchOptions are the options the matcher starts with.
+var DefaultDispatchOptions = DispatchOptions{
+	BatchWindow:    2 * time.Second,
+	BatchThreshold: 10,
+	SweepInterval:  30 * time.Second,
+	MaxRounds:      500,
+}
+
+// MatchDispatcherWorkflow runs match rounds as soon as passengers request trips and drivers become available,
+// instead of waiting for the next tick of the matching cron. Requests are batched in short windows,
+// a full batch is matched early, and a periodic sweep catches anything missed. The state of the rounds is carried
+// over the continue-as-new every MaxRounds rounds.
+func MatchDispatcherWorkflow(ctx workflow.Context, opts DispatchOptions, carried DispatchState) error {
+	logger := workflow.GetLogger(ctx)
+	ao := workflow.ActivityOptions{
+		StartToCloseTimeout:    60 * time.Second,
+		ScheduleToCloseTimeout: 120 * time.Second,
+	}
+	ctx = workflow.WithActivityOptions(ctx, ao)
+
+	passengerChannel := workflow.GetSignalChannel(ctx, signals.SIGNAL_PASSENGER_REQUESTED)
+	driverChannel := workflow.GetSignalChannel(ctx, signals.SIGNAL_DRIVER_AVAILABLE)
+
+	lastRunTime := carried.LastRunTime
+	// the state of the last round, the next one warm starts from it
+	round := carried.Round
+	warmRounds := carried.WarmRounds
+	latencySaved := carried.LatencySaved
+	pending := 0
+	var timerCtx workflow.Context
+	var cancelTimers workflow.CancelFunc
+	var window, sweep workflow.Future
+
+	// resetTimers drops the batch window and restarts the sweep after a round
+	resetTimers := func() {
+		if cancelTimers != nil {
+			cancelTimers()
+		}
+		timerCtx, cancelTimers = workflow.WithCancel(ctx)
+		window = nil
+		sweep = workflow.NewTimer(timerCtx, opts.SweepInterval)
+		pending = 0
+	}
+	runRound := func(reason string) {
+		thisRunTime := workflow.Now(ctx)
+		logger.Info("Match round triggered.", "Reason", reason, "Pending", pending)
+		batch := pending
+		resetTimers()
+		var next activities.RoundState
+		err := workflow.ExecuteActivity(ctx, activities.Match, lastRunTime, thisRunTime, round).Get(ctx, &next)
+		if err != nil {
+			// the waiting users are picked up again by the next round
+			logger.Error("Match job failed.", "Error", err)
+			return
+		}
+		if next.Skipped {
+			// another round holds the match lock, the batch is matched once the next window is over
+			logger.Info("Match round skipped, the batch is kept.", "Pending", batch)
+			pending += batch
+			if window == nil {
+				window = workflow.NewTimer(timerCtx, opts.BatchWindow)
+			}
+			return
+		}
+		lastRunTime = thisRunTime
+		round = next
+		if round.WarmStarted {
+			warmRounds++
+			latencySaved += round.LatencySaved()
+			logger.Info("Match round warm started.", "WarmRounds", warmRounds, "LatencySaved", latencySaved)
+		}
+	}
+	collect := func(c workflow.ReceiveChannel, more bool) {
+		var id int
+		c.Receive(ctx, &id)
+		pending++
+		if window == nil {
+			window = workflow.NewTimer(timerCtx, opts.BatchWindow)
+		}
+	}
+
+	resetTimers()
+	for rounds := 0; rounds < opts.MaxRounds; rounds++ {
+		reason := ""
+		for reason == "" {
+			selector := workflow.NewSelector(ctx)
+			selector.AddReceive(passengerChannel, collect)
+			selector.AddReceive(driverChannel, collect)
+			if window != nil {
+				selector.AddFuture(window, func(f workflow.Future) {
+					reason = "batch window"
+				})
+			}
+			selector.AddFuture(sweep, func(f workflow.Future) {
+				reason = "sweep"
+			})
+			selector.Select(ctx)
+			if reason == "" && pending >= opts.BatchThreshold {
+				reason = "batch threshold"
+			}
+		}
+		runRound(reason)
+	}
+
+	// requests received since the last round would be lost with the history, match them first
+	var id int
+	for passengerChannel.ReceiveAsync(&id) || driverChannel.ReceiveAsync(&id) {
+		pending++
+	}
+	if pending > 0 {
+		runRound("continue-as-new")
+	}
+	return workflow.NewContinueAsNewError(ctx, MatchDispatcherWorkflow, opts, DispatchState{
+		LastRunTime:  lastRunTime,
+		Round:        round,
+		WarmRounds:   warmRounds,
+		LatencySaved: latencySaved,
+	})
+}
@@ -0,0 +1,127 @@
+package workflows
+
+import (
+	"easyRide/activities"
+	"errors"
+	"github.com/stretchr/testify/mock"
+	"go.temporal.io/sdk/converter"
+	"go.temporal.io/sdk/workflow"
+	"time"
+)
+
+func (s *UnitTestSuite) Test_MatchDispatcherWorkflow_Rounds() {
+	opts := DispatchOptions{
+		BatchWindow:    2 * time.Second,
+		BatchThreshold: 3,
+		SweepInterval:  30 * time.Second,
+		MaxRounds:      3,
+	}
+	start := s.env.Now()
+	var rounds []time.Duration
+	s.env.OnActivity(activities.Match, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return(activities.RoundState{}, nil).
+		Run(func(args mock.Arguments) {
+			rounds = append(rounds, args.Get(2).(time.Time).Sub(start))
+		}).Times(3)
+
+	s.env.RegisterDelayedCallback(func() {
+		s.env.SignalWorkflow("signal_passenger_requested", 1)
+	}, time.Millisecond*1)
+	s.env.RegisterDelayedCallback(func() {
+		// a full batch does not wait for the window
+		s.env.SignalWorkflow("signal_passenger_requested", 2)
+		s.env.SignalWorkflow("signal_driver_available", 7)
+		s.env.SignalWorkflow("signal_passenger_requested", 3)
+	}, time.Second*10)
+
+	s.env.ExecuteWorkflow(MatchDispatcherWorkflow, opts, DispatchState{})
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.True(workflow.IsContinueAsNewError(s.env.GetWorkflowError()))
+	// batch window, batch threshold, then the sweep
+	s.Len(rounds, 3)
+	s.InDelta(float64(2*time.Second), float64(rounds[0]), float64(100*time.Millisecond))
+	s.InDelta(float64(10*time.Second), float64(rounds[1]), float64(100*time.Millisecond))
+	s.InDelta(float64(40*time.Second), float64(rounds[2]), float64(100*time.Millisecond))
+}
+
+func (s *UnitTestSuite) Test_MatchDispatcherWorkflow_SkippedRoundKeepsBatch() {
+	opts := DispatchOptions{
+		BatchWindow:    2 * time.Second,
+		BatchThreshold: 10,
+		SweepInterval:  30 * time.Second,
+		MaxRounds:      2,
+	}
+	start := s.env.Now()
+	var rounds []time.Duration
+	record := func(args mock.Arguments) {
+		// the skipped round is not counted as run
+		s.True(args.Get(1).(time.Time).IsZero())
+		rounds = append(rounds, args.Get(2).(time.Time).Sub(start))
+	}
+	s.env.OnActivity(activities.Match, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return(activities.RoundState{Skipped: true}, nil).Run(record).Once()
+	s.env.OnActivity(activities.Match, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return(activities.RoundState{}, nil).Run(record).Once()
+
+	s.env.RegisterDelayedCallback(func() {
+		s.env.SignalWorkflow("signal_passenger_requested", 1)
+	}, time.Millisecond*1)
+
+	s.env.ExecuteWorkflow(MatchDispatcherWorkflow, opts, DispatchState{})
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.True(workflow.IsContinueAsNewError(s.env.GetWorkflowError()))
+	// the batch is matched after another window rather than at the sweep
+	s.Len(rounds, 2)
+	s.InDelta(float64(2*time.Second), float64(rounds[0]), float64(100*time.Millisecond))
+	s.InDelta(float64(4*time.Second), float64(rounds[1]), float64(100*time.Millisecond))
+}
+
+func (s *UnitTestSuite) Test_MatchDispatcherWorkflow_WarmStartCarriedOver() {
+	opts := DispatchOptions{
+		BatchWindow:    2 * time.Second,
+		BatchThreshold: 10,
+		SweepInterval:  30 * time.Second,
+		MaxRounds:      1,
+	}
+	round := activities.RoundState{
+		Solver:        "hungarian",
+		Passengers:    []int{1, 2},
+		Drivers:       []int{7},
+		Prices:        map[int]float64{7: 0.5},
+		Assignments:   map[int]int{2: 7},
+		WarmStarted:   true,
+		SolveTime:     time.Millisecond,
+		ColdSolveTime: 3 * time.Millisecond,
+	}
+	// the carried times come back in UTC
+	start := s.env.Now().UTC()
+	s.env.OnActivity(activities.Match, mock.Anything, mock.Anything, mock.Anything, activities.RoundState{}).
+		Return(round, nil).Once()
+
+	s.env.ExecuteWorkflow(MatchDispatcherWorkflow, opts, DispatchState{WarmRounds: 4, LatencySaved: time.Millisecond})
+
+	s.True(s.env.IsWorkflowCompleted())
+	var continued *workflow.ContinueAsNewError
+	s.True(errors.As(s.env.GetWorkflowError(), &continued))
+	var carriedOpts DispatchOptions
+	var carried DispatchState
+	s.NoError(converter.GetDefaultDataConverter().FromPayloads(continued.Input, &carriedOpts, &carried))
+	s.Equal(opts, carriedOpts)
+	s.Equal(DispatchState{
+		LastRunTime:  start.Add(opts.SweepInterval),
+		Round:        round,
+		WarmRounds:   5,
+		LatencySaved: 3 * time.Millisecond,
+	}, carried)
+
+	// the first round of the next run warm starts from the last round of this one
+	env := s.NewTestWorkflowEnvironment()
+	env.OnActivity(activities.Match, mock.Anything, carried.LastRunTime, mock.Anything, round).
+		Return(activities.RoundState{}, nil).Once()
+	env.ExecuteWorkflow(MatchDispatcherWorkflow, opts, carried)
+	s.True(env.IsWorkflowCompleted())
+	s.True(workflow.IsContinueAsNewError(env.GetWorkflowError()))
+	env.AssertExpectations(s.T())
+}
@@ -9,6 +9,11 @@ import (
 // CronResult is used to pass data from one cron run to the next
 type CronResult struct {
 	RunTime time.Time
+	// Round is the state the last match round left, the next round warm starts from it
+	Round activities.RoundState
+	// WarmRounds and LatencySaved add up the rounds that warm started and the solve time they saved
+	WarmRounds   int
+	LatencySaved time.Duration
 }
 
 // MatchWorkFlow executes on the given schedule
@@ -25,22 +30,45 @@ func MatchWorkFlow(ctx workflow.Context) (*CronResult, error) {
 	ctx1 := workflow.WithActivityOptions(ctx, ao)
 
 	// Start from 0 to first cron job
-	lastRunTime := time.Time{}
+	var lastResult CronResult
 	// Update last run time if there was a previous successful job
 	if workflow.HasLastCompletionResult(ctx) {
-		var lastResult CronResult
-		if err := workflow.GetLastCompletionResult(ctx, &lastResult); err == nil {
-			lastRunTime = lastResult.RunTime
+		if err := workflow.GetLastCompletionResult(ctx, &lastResult); err != nil {
+			lastResult = CronResult{}
 		}
 	}
 	thisRunTime := workflow.Now(ctx)
+	if ctx.Err() != nil {
+		// paused before the round started
+		return nil, ctx.Err()
+	}
 
-	err := workflow.ExecuteActivity(ctx1, activities.Match, lastRunTime, thisRunTime).Get(ctx, nil)
+	// pausing the matching cancels the cron, the round in progress still completes and the cron stops after it
+	roundCtx, _ := workflow.NewDisconnectedContext(ctx1)
+	var round activities.RoundState
+	err := workflow.ExecuteActivity(roundCtx, activities.Match, lastResult.RunTime, thisRunTime, lastResult.Round).
+		Get(roundCtx, &round)
 	if err != nil {
 		// Match job failed
 		workflow.GetLogger(ctx).Error("Match job failed.", "Error", err)
 		return nil, err
 	}
 
-	return &CronResult{RunTime: thisRunTime}, nil
+	result := &CronResult{
+		RunTime:      thisRunTime,
+		Round:        round,
+		WarmRounds:   lastResult.WarmRounds,
+		LatencySaved: lastResult.LatencySaved,
+	}
+	if round.WarmStarted {
+		result.WarmRounds++
+		result.LatencySaved += round.LatencySaved()
+	}
+	workflow.GetLogger(ctx).Info("Match round done.", "WarmStarted", round.WarmStarted,
+		"WarmRounds", result.WarmRounds, "LatencySaved", result.LatencySaved)
+	if ctx.Err() != nil {
+		workflow.GetLogger(ctx).Info("Matching paused.")
+		return nil, ctx.Err()
+	}
+	return result, nil
 }
@@ -0,0 +1,123 @@
+package workflows
+
+import (
+	"easyRide/activities"
+	"errors"
+	"github.com/stretchr/testify/mock"
+	"go.temporal.io/sdk/temporal"
+	"time"
+)
+
+func (s *UnitTestSuite) Test_MatchWorkflow_FirstRun() {
+	round := activities.RoundState{Solver: "hungarian", Passengers: []int{1}, Drivers: []int{2},
+		SolveTime: time.Millisecond, ColdSolveTime: time.Millisecond}
+	// the first run matches everyone waiting, from no previous round
+	s.env.OnActivity(activities.Match, mock.Anything, time.Time{}, mock.Anything, activities.RoundState{}).
+		Return(round, nil).Once()
+
+	start := s.env.Now()
+	s.env.ExecuteWorkflow(MatchWorkFlow)
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.NoError(s.env.GetWorkflowError())
+	var result CronResult
+	s.NoError(s.env.GetWorkflowResult(&result))
+	s.True(result.RunTime.Equal(start))
+	s.Equal(0, result.WarmRounds)
+	s.Zero(result.LatencySaved)
+	s.Equal(round.Passengers, result.Round.Passengers)
+}
+
+func (s *UnitTestSuite) Test_MatchWorkflow_LastCompletionResult() {
+	lastRun := time.Date(2022, 6, 1, 10, 0, 0, 0, time.UTC)
+	prev := activities.RoundState{Solver: "hungarian", Passengers: []int{1, 3}, Drivers: []int{2},
+		Prices: map[int]float64{2: 0.5}, Assignments: map[int]int{3: 2}, ColdSolveTime: 5 * time.Millisecond}
+	s.env.SetLastCompletionResult(CronResult{RunTime: lastRun, Round: prev, WarmRounds: 2,
+		LatencySaved: 3 * time.Millisecond})
+
+	warm := activities.RoundState{Solver: "hungarian", WarmStarted: true, SolveTime: time.Millisecond,
+		ColdSolveTime: 5 * time.Millisecond}
+	s.env.OnActivity(activities.Match, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return(warm, nil).
+		Run(func(args mock.Arguments) {
+			// the round picks up from the previous run
+			s.True(args.Get(1).(time.Time).Equal(lastRun))
+			s.Equal(prev, args.Get(3).(activities.RoundState))
+		}).Once()
+
+	s.env.ExecuteWorkflow(MatchWorkFlow)
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.NoError(s.env.GetWorkflowError())
+	var result CronResult
+	s.NoError(s.env.GetWorkflowResult(&result))
+	s.Equal(3, result.WarmRounds)
+	s.Equal(7*time.Millisecond, result.LatencySaved)
+}
+
+func (s *UnitTestSuite) Test_MatchWorkflow_UnreadableLastCompletionResult() {
+	// a result left by a version with another result type is dropped
+	s.env.SetLastCompletionResult("2022-06-01")
+	s.env.OnActivity(activities.Match, mock.Anything, time.Time{}, mock.Anything, activities.RoundState{}).
+		Return(activities.RoundState{}, nil).Once()
+
+	s.env.ExecuteWorkflow(MatchWorkFlow)
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.NoError(s.env.GetWorkflowError())
+}
+
+func (s *UnitTestSuite) Test_MatchWorkflow_MatchRetried() {
+	s.env.OnActivity(activities.Match, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return(activities.RoundState{}, errors.New("connection refused")).Once()
+	s.env.OnActivity(activities.Match, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return(activities.RoundState{Solver: "hungarian"}, nil).Once()
+
+	s.env.ExecuteWorkflow(MatchWorkFlow)
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.NoError(s.env.GetWorkflowError())
+}
+
+func (s *UnitTestSuite) Test_MatchWorkflow_MatchFails() {
+	s.env.OnActivity(activities.Match, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return(activities.RoundState{}, temporal.NewNonRetryableApplicationError("unknown solver", "UnknownSolver", nil)).
+		Once()
+
+	s.env.ExecuteWorkflow(MatchWorkFlow)
+
+	s.True(s.env.IsWorkflowCompleted())
+	var appErr *temporal.ApplicationError
+	s.ErrorAs(s.env.GetWorkflowError(), &appErr)
+	s.Equal("UnknownSolver", appErr.Type())
+}
+
+func (s *UnitTestSuite) Test_MatchWorkflow_RoundTimeout() {
+	// a round that keeps failing is given up at the schedule to close timeout, the next cron run tries again
+	s.env.OnActivity(activities.Match, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return(activities.RoundState{}, errors.New("connection refused"))
+
+	start := s.env.Now()
+	s.env.ExecuteWorkflow(MatchWorkFlow)
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.Error(s.env.GetWorkflowError())
+	s.LessOrEqual(s.env.Now().Sub(start), 2*time.Minute+time.Second)
+}
+
+func (s *UnitTestSuite) Test_MatchWorkflow_PausedRoundCompletes() {
+	round := activities.RoundState{Solver: "hungarian", Passengers: []int{1}, Drivers: []int{2}}
+	s.env.OnActivity(activities.Match, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		After(10*time.Second).Return(round, nil).Once()
+	s.env.RegisterDelayedCallback(func() {
+		s.env.CancelWorkflow()
+	}, time.Second)
+
+	start := s.env.Now()
+	s.env.ExecuteWorkflow(MatchWorkFlow)
+
+	s.True(s.env.IsWorkflowCompleted())
+	// the cron stops once the round is done
+	s.True(temporal.IsCanceledError(s.env.GetWorkflowError()))
+	s.GreaterOrEqual(s.env.Now().Sub(start), 10*time.Second)
+}
@@ -0,0 +1,90 @@
+package workflows
+
+import (
+	"easyRide/activities"
+	"easyRide/models"
+	"easyRide/signals"
+	"go.temporal.io/sdk/workflow"
+	"time"
+)
+
+// MatchTimeout is how long a passenger waits for a driver before the request is given up.
+var MatchTimeout = 10 * time.Minute
+
+// awaitMatch waits for the match rounds to find the passenger a driver. A round the passenger is left out of widens
+// the match radius to the one of the time waited so far, until the match timeout cancels the request. The result is
+// not matched on a timeout.
+func awaitMatch(ctx workflow.Context, passengerID int, status *models.TripStatus) (models.MatchResult, error) {
+	logger := workflow.GetLogger(ctx)
+	matchChannel := workflow.GetSignalChannel(ctx, signals.MATCH_SIGNAL)
+	requested := workflow.Now(ctx)
+	if changeVersion(ctx, ChangeMatchTimeout) == workflow.DefaultVersion {
+		// the trips started before wait for a match as long as it takes
+		for {
+			var result models.MatchResult
+			matchChannel.Receive(ctx, &result)
+			if result.Matched {
+				status.DriverID = result.DriverID
+				status.PickupETA = result.PickupETA
+				return result, nil
+			}
+			status.MatchRounds++
+			logger.Info("Cannot match passenger, trying again.", "PassengerID", passengerID)
+		}
+	}
+
+	timerCtx, cancelTimer := workflow.WithCancel(ctx)
+	defer cancelTimer()
+	deadline := workflow.NewTimer(timerCtx, MatchTimeout)
+
+	for {
+		var result models.MatchResult
+		expired := false
+		selector := workflow.NewSelector(ctx)
+		selector.AddReceive(matchChannel, func(c workflow.ReceiveChannel, more bool) {
+			c.Receive(ctx, &result)
+		})
+		if deadline != nil {
+			selector.AddFuture(deadline, func(f workflow.Future) {
+				expired = true
+			})
+		}
+		selector.Select(ctx)
+
+		if result.Matched {
+			status.DriverID = result.DriverID
+			status.PickupETA = result.PickupETA
+			return result, nil
+		}
+		if expired {
+			deadline = nil
+			var cancelled bool
+			err := workflow.ExecuteActivity(ctx, activities.CancelTripRequest, passengerID).Get(ctx, &cancelled)
+			if err != nil {
+				return result, err
+			}
+			if cancelled {
+				logger.Info("No driver found in time, request cancelled.", "PassengerID", passengerID)
+				status.Stage = models.StageMatchTimeout
+				return result, nil
+			}
+			// matched just before the deadline, the match signal is on its way
+			continue
+		}
+
+		status.MatchRounds++
+		if deadline == nil || status.MatchRadius >= models.MaxMatchRadius {
+			continue
+		}
+		radius := models.MatchRadiusAfter(workflow.Now(ctx).Sub(requested))
+		if radius <= status.MatchRadius {
+			continue
+		}
+		logger.Info("Passenger not matched, widening the match radius.", "PassengerID", passengerID, "Radius", radius)
+		err := workflow.ExecuteActivity(ctx, activities.WidenMatchRadius, passengerID, radius).Get(ctx, nil)
+		if err != nil {
+			return result, err
+		}
+		status.MatchRadius = radius
+	}
+}
@@ -0,0 +1,93 @@
+package workflows
+
+import (
+	"easyRide/activities"
+	"easyRide/models"
+	"github.com/stretchr/testify/mock"
+	"time"
+)
+
+func (s *UnitTestSuite) Test_MainWorkflow_MatchTimeout() {
+	s.env.OnActivity(activities.WidenMatchRadius, mock.Anything, 1, 10).Return(nil).Once()
+	s.env.OnActivity(activities.WidenMatchRadius, mock.Anything, 1, 15).Return(nil).Once()
+	s.env.OnActivity(activities.CancelTripRequest, mock.Anything, 1).Return(true, nil).Once()
+
+	s.env.RegisterDelayedCallback(func() {
+		s.env.SignalWorkflow("signal_match", models.MatchResult{RoundID: "round-1"})
+	}, time.Minute)
+	s.env.RegisterDelayedCallback(func() {
+		s.env.SignalWorkflow("signal_match", models.MatchResult{RoundID: "round-1"})
+	}, 2*time.Minute)
+
+	s.env.ExecuteWorkflow(MainWorkFlow, 1)
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.NoError(s.env.GetWorkflowError())
+	res, err := s.env.QueryWorkflow("trip_status")
+	s.NoError(err)
+	var status models.TripStatus
+	s.NoError(res.Get(&status))
+	s.Equal(models.TripStatus{Stage: models.StageMatchTimeout, MatchRounds: 2, MatchRadius: 15}, status)
+}
+
+func (s *UnitTestSuite) Test_MainWorkflow_MatchRadiusByAge() {
+	// rounds every 20 seconds widen the radius once a minute
+	s.env.OnActivity(activities.WidenMatchRadius, mock.Anything, 1, 10).Return(nil).Once()
+	s.env.OnActivity(activities.CancelTripRequest, mock.Anything, 1).Return(true, nil).Once()
+
+	for i := 1; i <= 4; i++ {
+		s.env.RegisterDelayedCallback(func() {
+			s.env.SignalWorkflow("signal_match", models.MatchResult{RoundID: "round-1"})
+		}, time.Duration(i)*20*time.Second)
+	}
+	s.env.RegisterDelayedCallback(func() {
+		status := s.queryStatus()
+		s.Equal(4, status.MatchRounds)
+		s.Equal(10, status.MatchRadius)
+	}, 90*time.Second)
+
+	s.env.ExecuteWorkflow(MainWorkFlow, 1)
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.NoError(s.env.GetWorkflowError())
+}
+
+func (s *UnitTestSuite) Test_MainWorkflow_PooledRouteChange() {
+	pooled := testMatch
+	pooled.Pooled = true
+	route := []models.Stop{
+		{TripID: "trip-3", PassengerID: 3, Kind: models.StopPickup, Loc: 5},
+		{TripID: "trip-3", PassengerID: 3, Kind: models.StopDrop, Loc: 7},
+		{TripID: "default-test-workflow-id", PassengerID: 1, Kind: models.StopDrop, Loc: 9},
+	}
+	s.env.OnActivity(activities.DriverArrivedAtPickup, mock.Anything, mock.Anything, 1, pooled).Return(nil)
+	s.env.OnActivity(activities.PickUp, mock.Anything, mock.Anything, 1, pooled).Return(nil)
+	s.env.OnActivity(activities.InTrip, mock.Anything, 1, pooled).Return(nil).After(time.Minute)
+	s.env.OnActivity(activities.Arrive, mock.Anything, 1, pooled).Return(nil)
+	s.env.OnActivity(activities.RecordPayment, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	s.env.OnActivity(activities.PassengerEndTrip, mock.Anything, 1).Return(nil)
+	s.env.OnActivity(activities.MissRating, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	s.env.RegisterDelayedCallback(func() {
+		s.env.SignalWorkflow("signal_match", pooled)
+		s.env.SignalWorkflow("signal_passenger_picked_up", nil)
+	}, time.Millisecond)
+	s.env.RegisterDelayedCallback(func() {
+		// another rider joins on the way
+		s.env.SignalWorkflow("signal_route_changed", route)
+	}, time.Second)
+	s.env.RegisterDelayedCallback(func() {
+		s.env.SignalWorkflow("signal_payment", models.PaymentResult{Paid: true})
+	}, 2*time.Minute)
+
+	s.env.ExecuteWorkflow(MainWorkFlow, 1)
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.NoError(s.env.GetWorkflowError())
+	res, err := s.env.QueryWorkflow("trip_status")
+	s.NoError(err)
+	var status models.TripStatus
+	s.NoError(res.Get(&status))
+	s.Equal(models.StageCompleted, status.Stage)
+	s.Equal(route, status.Route)
+}
@@ -0,0 +1,232 @@
+package workflows
+
+import (
+	"easyRide/activities"
+	"easyRide/models"
+	"easyRide/signals"
+	"fmt"
+	"github.com/google/uuid"
+	"go.temporal.io/sdk/workflow"
+	"time"
+)
+
+// Session rules of the passengers.
+var (
+	// SessionIdleTimeout ends a session that has had no trip nor login for that long.
+	SessionIdleTimeout = 24 * time.Hour
+	// SessionEventsPerRun is the number of events a session handles before the history is trimmed with a
+	// continue-as-new: the logins, the trip requests, the trips and the idle timers fired.
+	SessionEventsPerRun = 500
+)
+
+// SessionState is carried over the runs of a passenger session.
+type SessionState struct {
+	PassengerID int
+	// SessionKey tells apart the sessions of the passenger, which run under the same workflow ID one after another,
+	// the trips are named after it
+	SessionKey string
+	// Trips counts the trips of the session over its runs, the trips are numbered after it
+	Trips int
+	// Requests are the trip requests the previous run received after its last trip
+	Requests []models.PassengerRequestBody
+}
+
+// passengerSession is the state of a running session.
+type passengerSession struct {
+	ctx            workflow.Context
+	state          SessionState
+	status         models.SessionStatus
+	loginChannel   workflow.ReceiveChannel
+	requestChannel workflow.ReceiveChannel
+	// events counts the events handled by the run
+	events int
+}
+
+// PassengerSessionWorkflow starts on the passenger's first login and runs the passenger's trips one after another,
+// each as a child MainWorkFlow. Logging in again attaches to the running session. The session ends once idle for
+// SessionIdleTimeout, and continues as new every SessionEventsPerRun events.
+func PassengerSessionWorkflow(ctx workflow.Context, state SessionState) error {
+	ao := workflow.ActivityOptions{
+		StartToCloseTimeout: 10 * time.Second,
+	}
+	ctx = workflow.WithActivityOptions(ctx, ao)
+	logger := workflow.GetLogger(ctx)
+
+	s := &passengerSession{
+		ctx:            ctx,
+		state:          state,
+		status:         models.SessionStatus{PassengerID: state.PassengerID, Trips: state.Trips},
+		loginChannel:   workflow.GetSignalChannel(ctx, signals.SIGNAL_SESSION_LOGIN),
+		requestChannel: workflow.GetSignalChannel(ctx, signals.SIGNAL_REQUEST_TRIP),
+	}
+	err := workflow.SetQueryHandler(ctx, signals.QUERY_SESSION, func() (models.SessionStatus, error) {
+		return s.status, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if s.state.SessionKey == "" {
+		key := workflow.SideEffect(ctx, func(ctx workflow.Context) interface{} {
+			return uuid.NewString()
+		})
+		if err := key.Get(&s.state.SessionKey); err != nil {
+			return err
+		}
+	}
+
+	requests := state.Requests
+	for s.events < SessionEventsPerRun {
+		if len(requests) == 0 {
+			request, requested, idle := s.awaitRequest()
+			if idle {
+				logger.Info("Passenger session idle, ended.", "PassengerID", state.PassengerID, "Trips", s.state.Trips)
+				return nil
+			}
+			if !requested {
+				break
+			}
+			requests = append(requests, request)
+		}
+		request := requests[0]
+		requests = requests[1:]
+		if err := s.runTrip(request); err != nil {
+			return err
+		}
+	}
+
+	// requests received since the last trip would be lost with the history, carry them over
+	for {
+		var request models.PassengerRequestBody
+		if !s.requestChannel.ReceiveAsync(&request) {
+			break
+		}
+		requests = append(requests, request)
+	}
+	s.drainLogins()
+	s.state.Requests = requests
+	return workflow.NewContinueAsNewError(ctx, PassengerSessionWorkflow, s.state)
+}
+
+// awaitRequest waits for the next trip request, logins keep the session alive. It reports idle when the session
+// was idle for too long, and neither requested nor idle when the run is full of the logins received.
+func (s *passengerSession) awaitRequest() (request models.PassengerRequestBody, requested bool, idle bool) {
+	ctx := s.ctx
+	timerCtx, cancelTimer := workflow.WithCancel(ctx)
+	defer func() { cancelTimer() }()
+	for {
+		idleTimer := workflow.NewTimer(timerCtx, SessionIdleTimeout)
+		expired := false
+		selector := workflow.NewSelector(ctx)
+		selector.AddReceive(s.loginChannel, func(c workflow.ReceiveChannel, more bool) {
+			c.Receive(ctx, nil)
+		})
+		selector.AddReceive(s.requestChannel, func(c workflow.ReceiveChannel, more bool) {
+			c.Receive(ctx, &request)
+			requested = true
+		})
+		selector.AddFuture(idleTimer, func(f workflow.Future) {
+			expired = true
+		})
+		selector.Select(ctx)
+		s.events++
+
+		if requested {
+			return request, true, false
+		}
+		if expired {
+			// a request sent as the session ends would be lost
+			if s.requestChannel.ReceiveAsync(&request) {
+				return request, true, false
+			}
+			s.drainLogins()
+			return request, false, true
+		}
+		if s.events >= SessionEventsPerRun {
+			return request, false, false
+		}
+		// logged in, the idle time starts over
+		cancelTimer()
+		timerCtx, cancelTimer = workflow.WithCancel(ctx)
+	}
+}
+
+// runTrip runs a trip as a child workflow until it ends. The requests received in the meantime are turned down,
+// a passenger has one trip at a time.
+func (s *passengerSession) runTrip(request models.PassengerRequestBody) error {
+	ctx := s.ctx
+	logger := workflow.GetLogger(ctx)
+	passengerID := s.state.PassengerID
+	// the session owns the passenger, never trust the identity sent along with the signal
+	request.ID = passengerID
+
+	s.state.Trips++
+	s.events++
+	tripID := fmt.Sprintf("%s-%s-trip-%d", workflow.GetInfo(ctx).WorkflowExecution.ID, s.state.SessionKey,
+		s.state.Trips)
+	childCtx, cancelTrip := workflow.WithCancel(ctx)
+	cwo := workflow.ChildWorkflowOptions{
+		WorkflowID: tripID,
+	}
+	child := workflow.ExecuteChildWorkflow(workflow.WithChildOptions(childCtx, cwo), MainWorkFlow, passengerID)
+	var execution workflow.Execution
+	if err := child.GetChildWorkflowExecution().Get(ctx, &execution); err != nil {
+		return err
+	}
+	s.status.TripID, s.status.Trips = execution.ID, s.state.Trips
+	defer func() { s.status.TripID = "" }()
+	logger.Info("Trip started.", "PassengerID", passengerID, "TripID", execution.ID)
+
+	// the trip must be running before it can be matched
+	var requested bool
+	err := workflow.ExecuteActivity(ctx, activities.RequestTrip, execution.ID, request).Get(ctx, &requested)
+	if err != nil {
+		logger.Error("Trip request failed, trip cancelled.", "PassengerID", passengerID, "Error", err)
+		cancelTrip()
+	} else if !requested {
+		// a scheduled trip of the passenger is dispatched or running
+		logger.Warn("Trip requested during another trip, turned down.", "PassengerID", passengerID)
+		s.turnDown()
+		cancelTrip()
+	}
+
+	done := false
+	for !done {
+		selector := workflow.NewSelector(ctx)
+		selector.AddFuture(child, func(f workflow.Future) {
+			if err := f.Get(ctx, nil); err != nil {
+				// the session goes on with the next trip
+				logger.Error("Trip failed.", "PassengerID", passengerID, "TripID", execution.ID, "Error", err)
+			}
+			done = true
+		})
+		selector.AddReceive(s.loginChannel, func(c workflow.ReceiveChannel, more bool) {
+			c.Receive(ctx, nil)
+			s.events++
+		})
+		selector.AddReceive(s.requestChannel, func(c workflow.ReceiveChannel, more bool) {
+			c.Receive(ctx, nil)
+			s.events++
+			logger.Warn("Trip requested during a trip, turned down.", "PassengerID", passengerID)
+			s.turnDown()
+		})
+		selector.Select(ctx)
+	}
+	return nil
+}
+
+// turnDown tells the passenger a trip request was turned down, another trip of the passenger is running.
+func (s *passengerSession) turnDown() {
+	err := workflow.ExecuteActivity(s.ctx, activities.NotifyPassenger, s.state.PassengerID,
+		"Your trip is still running, request the next one once it is over.").Get(s.ctx, nil)
+	if err != nil {
+		workflow.GetLogger(s.ctx).Error("Cannot notify the passenger.", "PassengerID", s.state.PassengerID,
+			"Error", err)
+	}
+}
+
+// drainLogins drops the logins received, they only attach to the session.
+func (s *passengerSession) drainLogins() {
+	for s.loginChannel.ReceiveAsync(nil) {
+	}
+}
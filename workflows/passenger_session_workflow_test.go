@@ -0,0 +1,168 @@
+package workflows
+
+import (
+	"easyRide/activities"
+	"easyRide/models"
+	"github.com/stretchr/testify/mock"
+	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/workflow"
+	"strings"
+	"time"
+)
+
+func (s *UnitTestSuite) Test_PassengerSessionWorkflow_Trips() {
+	// each trip takes a minute
+	s.env.RegisterWorkflowWithOptions(func(ctx workflow.Context, passengerID int) error {
+		return workflow.Sleep(ctx, time.Minute)
+	}, workflow.RegisterOptions{Name: "MainWorkFlow"})
+	var trips []string
+	s.env.OnActivity(activities.RequestTrip, mock.Anything, mock.Anything, mock.Anything).Return(true, nil).
+		Run(func(args mock.Arguments) {
+			// the request is the passenger's own, whatever the signal says
+			s.Equal(1, args.Get(2).(models.PassengerRequestBody).ID)
+			trips = append(trips, args.Get(1).(string))
+		}).Twice()
+	s.env.OnActivity(activities.NotifyPassenger, mock.Anything, 1, mock.Anything).Return(nil).Once()
+
+	s.env.RegisterDelayedCallback(func() {
+		s.env.SignalWorkflow("signal_request_trip", models.PassengerRequestBody{ID: 1, PickupLoc: 3, DropLoc: 9})
+	}, time.Second)
+	s.env.RegisterDelayedCallback(func() {
+		// a second request and a second login during the trip
+		s.env.SignalWorkflow("signal_request_trip", models.PassengerRequestBody{ID: 1, PickupLoc: 4, DropLoc: 8})
+		s.env.SignalWorkflow("signal_session_login", nil)
+	}, 2*time.Second)
+	s.env.RegisterDelayedCallback(func() {
+		status := s.querySession()
+		s.Equal(models.SessionStatus{PassengerID: 1, TripID: trips[0], Trips: 1}, status)
+	}, 30*time.Second)
+	s.env.RegisterDelayedCallback(func() {
+		s.Empty(s.querySession().TripID)
+		s.env.SignalWorkflow("signal_request_trip", models.PassengerRequestBody{ID: 7, PickupLoc: 9, DropLoc: 2})
+	}, 2*time.Minute)
+
+	start := s.env.Now()
+	s.env.ExecuteWorkflow(PassengerSessionWorkflow, SessionState{PassengerID: 1})
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.NoError(s.env.GetWorkflowError())
+	s.Len(trips, 2)
+	s.Regexp(`^default-test-workflow-id-[0-9a-f-]{36}-trip-1$`, trips[0])
+	s.Equal(strings.TrimSuffix(trips[0], "1")+"2", trips[1])
+	// the session ends once idle after the second trip
+	s.Equal(3*time.Minute+SessionIdleTimeout, s.env.Now().Sub(start))
+}
+
+func (s *UnitTestSuite) Test_PassengerSessionWorkflow_TurnedDownDuringScheduledTrip() {
+	// the trip waits for a match until cancelled
+	s.env.RegisterWorkflowWithOptions(func(ctx workflow.Context, passengerID int) error {
+		return workflow.Sleep(ctx, time.Hour)
+	}, workflow.RegisterOptions{Name: "MainWorkFlow"})
+	// a scheduled trip of the passenger holds the matching pool
+	s.env.OnActivity(activities.RequestTrip, mock.Anything, mock.Anything, mock.Anything).Return(false, nil).Once()
+	s.env.OnActivity(activities.NotifyPassenger, mock.Anything, 1,
+		"Your trip is still running, request the next one once it is over.").Return(nil).Once()
+
+	s.env.RegisterDelayedCallback(func() {
+		s.env.SignalWorkflow("signal_request_trip", models.PassengerRequestBody{ID: 1, PickupLoc: 3, DropLoc: 9})
+	}, time.Second)
+	s.env.RegisterDelayedCallback(func() {
+		s.Equal(models.SessionStatus{PassengerID: 1, Trips: 1}, s.querySession())
+	}, time.Minute)
+
+	start := s.env.Now()
+	s.env.ExecuteWorkflow(PassengerSessionWorkflow, SessionState{PassengerID: 1})
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.NoError(s.env.GetWorkflowError())
+	// the trip was cancelled at once, the session ends once idle
+	s.Equal(time.Second+SessionIdleTimeout, s.env.Now().Sub(start))
+}
+
+func (s *UnitTestSuite) Test_PassengerSessionWorkflow_LoginKeepsAlive() {
+	s.env.RegisterDelayedCallback(func() {
+		s.env.SignalWorkflow("signal_session_login", nil)
+	}, SessionIdleTimeout-time.Hour)
+
+	start := s.env.Now()
+	s.env.ExecuteWorkflow(PassengerSessionWorkflow, SessionState{PassengerID: 1})
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.NoError(s.env.GetWorkflowError())
+	s.Equal(2*SessionIdleTimeout-time.Hour, s.env.Now().Sub(start))
+}
+
+func (s *UnitTestSuite) Test_PassengerSessionWorkflow_ContinueAsNew() {
+	eventsPerRun := SessionEventsPerRun
+	SessionEventsPerRun = 1
+	defer func() { SessionEventsPerRun = eventsPerRun }()
+
+	s.env.RegisterWorkflow(MainWorkFlow)
+	s.env.OnWorkflow(MainWorkFlow, mock.Anything, 1).Return(nil)
+	// the request left by the previous run is the first trip of the run, numbered after the trips of the session
+	s.env.OnActivity(activities.RequestTrip, mock.Anything, "default-test-workflow-id-key-trip-4",
+		models.PassengerRequestBody{ID: 1, PickupLoc: 3, DropLoc: 9}).Return(true, nil).Once()
+
+	s.env.ExecuteWorkflow(PassengerSessionWorkflow, SessionState{PassengerID: 1, SessionKey: "key", Trips: 3,
+		Requests: []models.PassengerRequestBody{{ID: 1, PickupLoc: 3, DropLoc: 9}}})
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.True(workflow.IsContinueAsNewError(s.env.GetWorkflowError()))
+}
+
+func (s *UnitTestSuite) Test_PassengerSessionWorkflow_ContinueAsNewOnLogins() {
+	eventsPerRun := SessionEventsPerRun
+	SessionEventsPerRun = 3
+	defer func() { SessionEventsPerRun = eventsPerRun }()
+
+	// no trip, the logins alone fill the run
+	for i := 1; i <= 3; i++ {
+		s.env.RegisterDelayedCallback(func() {
+			s.env.SignalWorkflow("signal_session_login", nil)
+		}, time.Duration(i)*time.Hour)
+	}
+
+	start := s.env.Now()
+	s.env.ExecuteWorkflow(PassengerSessionWorkflow, SessionState{PassengerID: 1})
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.True(workflow.IsContinueAsNewError(s.env.GetWorkflowError()))
+	s.Equal(3*time.Hour, s.env.Now().Sub(start))
+}
+
+func (s *UnitTestSuite) Test_PassengerSessionWorkflow_ConsecutiveSessions() {
+	// the second session of the passenger starts once the first one ended idle, under the same workflow ID
+	session := func(env *testsuite.TestWorkflowEnvironment) string {
+		env.RegisterWorkflowWithOptions(func(ctx workflow.Context, passengerID int) error {
+			return nil
+		}, workflow.RegisterOptions{Name: "MainWorkFlow"})
+		var tripID string
+		env.OnActivity(activities.RequestTrip, mock.Anything, mock.Anything, mock.Anything).Return(true, nil).
+			Run(func(args mock.Arguments) {
+				tripID = args.Get(1).(string)
+			}).Once()
+		env.RegisterDelayedCallback(func() {
+			env.SignalWorkflow("signal_request_trip", models.PassengerRequestBody{ID: 1, PickupLoc: 3, DropLoc: 9})
+		}, time.Second)
+
+		env.ExecuteWorkflow(PassengerSessionWorkflow, SessionState{PassengerID: 1})
+
+		s.True(env.IsWorkflowCompleted())
+		s.NoError(env.GetWorkflowError())
+		env.AssertExpectations(s.T())
+		return tripID
+	}
+
+	first := session(s.env)
+	second := session(s.NewTestWorkflowEnvironment())
+	s.NotEmpty(first)
+	s.NotEqual(first, second)
+}
+
+func (s *UnitTestSuite) querySession() models.SessionStatus {
+	var status models.SessionStatus
+	res, err := s.env.QueryWorkflow("session")
+	s.NoError(err)
+	s.NoError(res.Get(&status))
+	return status
+}
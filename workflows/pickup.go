@@ -0,0 +1,86 @@
+package workflows
+
+import (
+	"easyRide/activities"
+	"easyRide/models"
+	"easyRide/signals"
+	"go.temporal.io/sdk/workflow"
+	"time"
+)
+
+var (
+	// EnRouteTimeout is how long the driver has to reach the pickup location before the passenger is released.
+	EnRouteTimeout = 30 * time.Minute
+	// NoShowTimeout is how long the driver waits at the pickup location before the passenger is a no-show.
+	NoShowTimeout = 5 * time.Minute
+	// NoShowFee is charged to a passenger who does not show up.
+	NoShowFee = 5.0
+)
+
+// pickupOutcome is how the pickup phase of a trip ended.
+type pickupOutcome int
+
+const (
+	outcomePickedUp pickupOutcome = iota
+	outcomeNoShow
+	outcomeDriverLate
+)
+
+// pickup runs the pickup phase of the trip: the driver is en route until arriving at the pickup location,
+// then waits for the passenger until the no-show timer fires. A driver still en route once EnRouteTimeout is over
+// is taken off the trip, and the passenger is released to request another one.
+func pickup(ctx workflow.Context, passengerID int, match models.MatchResult) (pickupOutcome, error) {
+	logger := workflow.GetLogger(ctx)
+	tripID := workflow.GetInfo(ctx).WorkflowExecution.ID
+	arrivedChannel := workflow.GetSignalChannel(ctx, signals.SIGNAL_DRIVER_ARRIVED_PICKUP)
+	pickedUpChannel := workflow.GetSignalChannel(ctx, signals.SIGNAL_PASSENGER_PICKED_UP)
+
+	// en route to pickup, a driver may report the pickup without reporting the arrival first
+	pickedUp, late := false, false
+	selector := workflow.NewSelector(ctx)
+	selector.AddReceive(arrivedChannel, func(c workflow.ReceiveChannel, more bool) {
+		c.Receive(ctx, nil)
+	})
+	selector.AddReceive(pickedUpChannel, func(c workflow.ReceiveChannel, more bool) {
+		c.Receive(ctx, nil)
+		pickedUp = true
+	})
+	timerCtx, cancelEnRoute := workflow.WithCancel(ctx)
+	selector.AddFuture(workflow.NewTimer(timerCtx, EnRouteTimeout), func(f workflow.Future) {
+		late = true
+	})
+	selector.Select(ctx)
+	cancelEnRoute()
+	if late {
+		logger.Info("Driver did not reach the pickup location in time.", "PassengerID", passengerID,
+			"DriverID", match.DriverID)
+		err := workflow.ExecuteActivity(ctx, activities.DriverLate, tripID, passengerID, match).Get(ctx, nil)
+		return outcomeDriverLate, err
+	}
+	err := workflow.ExecuteActivity(ctx, activities.DriverArrivedAtPickup, tripID, passengerID, match).Get(ctx, nil)
+	if err != nil {
+		return outcomeNoShow, err
+	}
+
+	// waiting at pickup
+	if !pickedUp {
+		logger.Info("Driver is waiting at the pickup location.", "PassengerID", passengerID)
+		timerCtx, cancelTimer := workflow.WithCancel(ctx)
+		noShowTimer := workflow.NewTimer(timerCtx, NoShowTimeout)
+		selector = workflow.NewSelector(ctx)
+		selector.AddReceive(pickedUpChannel, func(c workflow.ReceiveChannel, more bool) {
+			c.Receive(ctx, nil)
+			pickedUp = true
+		})
+		selector.AddFuture(noShowTimer, func(f workflow.Future) {})
+		selector.Select(ctx)
+		cancelTimer()
+	}
+
+	if !pickedUp {
+		err = workflow.ExecuteActivity(ctx, activities.NoShow, tripID, passengerID, match, NoShowFee).Get(ctx, nil)
+		return outcomeNoShow, err
+	}
+	err = workflow.ExecuteActivity(ctx, activities.PickUp, tripID, passengerID, match).Get(ctx, nil)
+	return outcomePickedUp, err
+}
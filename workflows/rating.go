@@ -0,0 +1,114 @@
+package workflows
+
+import (
+	"easyRide/activities"
+	"easyRide/models"
+	"go.temporal.io/sdk/workflow"
+	"time"
+)
+
+// RatingWindow is how long a party has to rate the trip once it is asked to.
+var RatingWindow = 15 * time.Second
+
+// ratingReplies holds the reply of the trip to each rating signal by request ID.
+type ratingReplies map[string]models.RatingReply
+
+func (r ratingReplies) set(rating models.Rating, reply models.RatingReply) {
+	if rating.RequestID != "" {
+		r[rating.RequestID] = reply
+	}
+}
+
+// reply is the reply to the rating of the rater sent with the request ID. A rating not taken once the window of the
+// rater is closed, or the trip is over, came too late and is lost: a duplicate when the rater rated, late otherwise.
+func (r ratingReplies) reply(tripStatus *models.TripStatus, rater string, requestID string) models.RatingReply {
+	if reply, ok := r[requestID]; ok {
+		return reply
+	}
+	switch tripStatus.Ratings[rater] {
+	case models.RatingRated:
+		return models.RatingDuplicate
+	case models.RatingMissed:
+		return models.RatingLate
+	}
+	switch tripStatus.Stage {
+	case models.StageCompleted, models.StageNoShow, models.StageDriverLate, models.StageMatchTimeout:
+		return models.RatingLate
+	}
+	return models.RatingPending
+}
+
+// awaitRating opens a rating window for the rater and stores the first valid rating received on the signal.
+// A rating sent before the window opened is rejected, invalid ratings are rejected and the window stays open, a
+// rating arriving after the first one or after the deadline is rejected. A missed window is recorded on the trip.
+// Each rating taken gets a reply in replies, which the client that sent it queries.
+func awaitRating(ctx workflow.Context, tripStatus *models.TripStatus, replies ratingReplies, signalName string,
+	rater string, passengerID int, driverID int) error {
+	// the trips started before the rating window run the Rate activity for both ratings, the first gate decides
+	if changeVersion(ctx, ChangeRatingWindow) == workflow.DefaultVersion {
+		return workflow.ExecuteActivity(ctx, activities.Rate).Get(ctx, nil)
+	}
+	logger := workflow.GetLogger(ctx)
+	tripID := workflow.GetInfo(ctx).WorkflowExecution.ID
+	ratingChannel := workflow.GetSignalChannel(ctx, signalName)
+
+	// the rater was not asked to rate yet
+	var early models.Rating
+	for ratingChannel.ReceiveAsync(&early) {
+		logger.Warn("Rejected rating received before the rating window.", "Rater", rater, "Rating", early.Score)
+		replies.set(early, models.RatingEarly)
+	}
+	if tripStatus.Ratings == nil {
+		tripStatus.Ratings = map[string]models.RatingState{}
+	}
+	tripStatus.Ratings[rater] = models.RatingOpen
+
+	timerCtx, cancelTimer := workflow.WithCancel(ctx)
+	deadline := workflow.NewTimer(timerCtx, RatingWindow)
+
+	var rating *models.Rating
+	expired := false
+	for rating == nil && !expired {
+		selector := workflow.NewSelector(ctx)
+		selector.AddReceive(ratingChannel, func(c workflow.ReceiveChannel, more bool) {
+			var r models.Rating
+			c.Receive(ctx, &r)
+			if !models.ValidRating(r.Score) {
+				logger.Warn("Rejected invalid rating.", "Rater", rater, "Rating", r.Score)
+				replies.set(r, models.RatingInvalid)
+				return
+			}
+			replies.set(r, models.RatingAccepted)
+			rating = &r
+		})
+		selector.AddFuture(deadline, func(f workflow.Future) {
+			expired = true
+		})
+		selector.Select(ctx)
+	}
+	cancelTimer()
+
+	// the window is closed, anything still pending is a duplicate or came too late, anything sent from now on is lost
+	var rejected models.Rating
+	for ratingChannel.ReceiveAsync(&rejected) {
+		logger.Warn("Rejected rating received outside the rating window.", "Rater", rater, "Rating", rejected.Score)
+		if rating != nil {
+			replies.set(rejected, models.RatingDuplicate)
+		} else {
+			replies.set(rejected, models.RatingLate)
+		}
+	}
+
+	if rating == nil {
+		tripStatus.Ratings[rater] = models.RatingMissed
+		logger.Info("Rating window missed.", "Rater", rater, "TripID", tripID)
+		return workflow.ExecuteActivity(ctx, activities.MissRating, tripID, rater).Get(ctx, nil)
+	}
+	tripStatus.Ratings[rater] = models.RatingRated
+	// the workflow owns the trip, never trust the identity sent along with the signal
+	rating.TripID = tripID
+	rating.Rater = rater
+	rating.PassengerID = passengerID
+	rating.DriverID = driverID
+	return workflow.ExecuteActivity(ctx, activities.SubmitRating, *rating).Get(ctx, nil)
+}
@@ -0,0 +1,83 @@
+package workflows
+
+import (
+	"github.com/gogo/protobuf/jsonpb"
+	"github.com/stretchr/testify/assert"
+	enumspb "go.temporal.io/api/enums/v1"
+	historypb "go.temporal.io/api/history/v1"
+	"go.temporal.io/sdk/worker"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// replayedWorkflows are the workflows the histories can be recorded from. The replayer runs every history under the
+// same workflow ID, so the histories of a passenger session or of a scheduled trip, whose trips are named after their
+// own workflow ID, cannot be replayed.
+var replayedWorkflows = []interface{}{
+	MainWorkFlow,
+	PassengerSessionWorkflow,
+	MatchWorkFlow,
+	MatchDispatcherWorkflow,
+	DriverShiftWorkflow,
+	ScheduledTripWorkflow,
+}
+
+// replayHistory replays a history recorded by an earlier version of a workflow against the current code.
+// The SDK leaves out the check of the commands against the history when the replay completes the workflow, so the
+// history of a workflow that closed itself is also replayed up to its last workflow task, which checks every command
+// but the last ones. The full replay checks the workflow ends with the same result. The replay of a workflow
+// terminated, or still running, checks every command already.
+func replayHistory(t *testing.T, file string) {
+	f, err := os.Open(file)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer f.Close()
+	var history historypb.History
+	if !assert.NoError(t, jsonpb.Unmarshal(f, &history)) {
+		return
+	}
+
+	replayer := worker.NewWorkflowReplayer()
+	for _, w := range replayedWorkflows {
+		replayer.RegisterWorkflow(w)
+	}
+	assert.NoError(t, replayer.ReplayWorkflowHistory(nil, &history), "full history")
+
+	last := len(history.Events) - 1
+	if !closedByWorkflow(history.Events[last].GetEventType()) {
+		return
+	}
+	for last > 0 && history.Events[last].GetEventType() != enumspb.EVENT_TYPE_WORKFLOW_TASK_SCHEDULED {
+		last--
+	}
+	partial := &historypb.History{Events: history.Events[:last]}
+	assert.NoError(t, replayer.ReplayWorkflowHistory(nil, partial), "history up to event %d", last)
+}
+
+// closedByWorkflow tells whether the event ends a run on a command of the workflow.
+func closedByWorkflow(eventType enumspb.EventType) bool {
+	switch eventType {
+	case enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_COMPLETED,
+		enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_FAILED,
+		enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_CANCELED,
+		enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_CONTINUED_AS_NEW:
+		return true
+	}
+	return false
+}
+
+// TestReplayHistories replays every history of testdata/histories, exported from running workflows with
+// go run ./history.
+func TestReplayHistories(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "histories", "*.json"))
+	assert.NoError(t, err)
+	assert.NotEmpty(t, files)
+	for _, file := range files {
+		file := file
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			replayHistory(t, file)
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package workflows
+
+import (
+	"easyRide/activities"
+	"easyRide/models"
+	"easyRide/signals"
+	"fmt"
+	"go.temporal.io/sdk/workflow"
+	"time"
+)
+
+var (
+	// ScheduleLeadTime is how long before the pickup time a scheduled trip enters the matching pool.
+	ScheduleLeadTime = 15 * time.Minute
+	// ScheduleReminders are sent to the passenger that long before the pickup time.
+	ScheduleReminders = []time.Duration{24 * time.Hour, time.Hour}
+	// ScheduleRetryInterval is how often the dispatch is tried again while the passenger is on another trip.
+	ScheduleRetryInterval = time.Minute
+	// ScheduleMaxDelay is how long past the pickup time the dispatch waits for the passenger's other trip to end.
+	ScheduleMaxDelay = 30 * time.Minute
+)
+
+// ScheduledTripWorkflow holds a trip booked ahead until the lead time before the pickup, then runs the trip
+// as a child MainWorkFlow matched with priority. Until then the trip can be cancelled or rescheduled,
+// and the passenger is reminded of it.
+func ScheduledTripWorkflow(ctx workflow.Context, trip models.ScheduledTrip) error {
+	ao := workflow.ActivityOptions{
+		StartToCloseTimeout: 10 * time.Second,
+	}
+	ctx = workflow.WithActivityOptions(ctx, ao)
+	logger := workflow.GetLogger(ctx)
+	logger.Info("Trip scheduled.", "PassengerID", trip.PassengerID, "PickupAt", trip.PickupAt)
+
+	trip.Status = models.ScheduleBooked
+	err := workflow.SetQueryHandler(ctx, signals.QUERY_SCHEDULED_TRIP, func() (models.ScheduledTrip, error) {
+		return trip, nil
+	})
+	if err != nil {
+		return err
+	}
+	notify := func(message string) error {
+		return workflow.ExecuteActivity(ctx, activities.NotifyPassenger, trip.PassengerID, message).Get(ctx, nil)
+	}
+	cancelChannel := workflow.GetSignalChannel(ctx, signals.SIGNAL_CANCEL_SCHEDULED_TRIP)
+	rescheduleChannel := workflow.GetSignalChannel(ctx, signals.SIGNAL_RESCHEDULE_TRIP)
+
+	reminded := make(map[time.Duration]bool)
+	for trip.Status == models.ScheduleBooked && err == nil {
+		now := workflow.Now(ctx)
+		timerCtx, cancelTimers := workflow.WithCancel(ctx)
+		selector := workflow.NewSelector(ctx)
+
+		dispatchIn := trip.PickupAt.Sub(now) - ScheduleLeadTime
+		if dispatchIn < 0 {
+			dispatchIn = 0
+		}
+		selector.AddFuture(workflow.NewTimer(timerCtx, dispatchIn), func(f workflow.Future) {
+			trip.Status = models.ScheduleDispatched
+		})
+		// only the next reminder due is waited for
+		for _, before := range ScheduleReminders {
+			remindIn := trip.PickupAt.Sub(now) - before
+			if reminded[before] || remindIn <= 0 || remindIn >= dispatchIn {
+				continue
+			}
+			before := before
+			selector.AddFuture(workflow.NewTimer(timerCtx, remindIn), func(f workflow.Future) {
+				reminded[before] = true
+				err = notify(fmt.Sprintf("Reminder: your trip is scheduled for %s.", trip.PickupAt.Format(time.RFC1123)))
+			})
+			break
+		}
+		selector.AddReceive(cancelChannel, func(c workflow.ReceiveChannel, more bool) {
+			c.Receive(ctx, nil)
+			trip.Status = models.ScheduleCancelled
+		})
+		selector.AddReceive(rescheduleChannel, func(c workflow.ReceiveChannel, more bool) {
+			var pickupAt time.Time
+			c.Receive(ctx, &pickupAt)
+			if pickupAt.Sub(workflow.Now(ctx)) < ScheduleLeadTime {
+				logger.Warn("Rejected reschedule, the pickup time is too soon.", "PickupAt", pickupAt)
+				return
+			}
+			trip.PickupAt = pickupAt
+			reminded = make(map[time.Duration]bool)
+			err = notify(fmt.Sprintf("Your trip is rescheduled for %s.", trip.PickupAt.Format(time.RFC1123)))
+		})
+		selector.Select(ctx)
+		cancelTimers()
+	}
+	if err != nil {
+		return err
+	}
+	if trip.Status == models.ScheduleCancelled {
+		logger.Info("Scheduled trip cancelled.", "PassengerID", trip.PassengerID)
+		return notify("Your scheduled trip is cancelled.")
+	}
+
+	cwo := workflow.ChildWorkflowOptions{
+		WorkflowID: workflow.GetInfo(ctx).WorkflowExecution.ID + "-trip",
+	}
+	// the passenger may still be on another trip, whose request the dispatch must not overwrite
+	for waited := false; ; waited = true {
+		var dispatched bool
+		err := workflow.ExecuteActivity(ctx, activities.DispatchScheduledTrip, cwo.WorkflowID, trip).Get(ctx, &dispatched)
+		if err != nil {
+			return err
+		}
+		if dispatched {
+			break
+		}
+		if !workflow.Now(ctx).Before(trip.PickupAt.Add(ScheduleMaxDelay)) {
+			trip.Status = models.ScheduleCancelled
+			logger.Info("Scheduled trip dropped, the passenger is on another trip.", "PassengerID", trip.PassengerID)
+			return notify("Your scheduled trip is cancelled, you were still on another trip.")
+		}
+		if !waited {
+			logger.Info("Scheduled trip deferred, the passenger is on another trip.", "PassengerID", trip.PassengerID)
+			if err := notify("Your scheduled trip starts once your current trip is over."); err != nil {
+				return err
+			}
+		}
+		timerCtx, cancelTimer := workflow.WithCancel(ctx)
+		selector := workflow.NewSelector(ctx)
+		selector.AddFuture(workflow.NewTimer(timerCtx, ScheduleRetryInterval), func(f workflow.Future) {})
+		selector.AddReceive(cancelChannel, func(c workflow.ReceiveChannel, more bool) {
+			c.Receive(ctx, nil)
+			trip.Status = models.ScheduleCancelled
+		})
+		selector.Select(ctx)
+		cancelTimer()
+		if trip.Status == models.ScheduleCancelled {
+			logger.Info("Scheduled trip cancelled.", "PassengerID", trip.PassengerID)
+			return notify("Your scheduled trip is cancelled.")
+		}
+	}
+	// a match found before the trip runs fails to signal it, and is undone until the next round
+	child := workflow.ExecuteChildWorkflow(workflow.WithChildOptions(ctx, cwo), MainWorkFlow, trip.PassengerID)
+	logger.Info("Scheduled trip dispatched.", "PassengerID", trip.PassengerID, "TripID", cwo.WorkflowID)
+	return child.Get(ctx, nil)
+}
@@ -0,0 +1,99 @@
+package workflows
+
+import (
+	"easyRide/activities"
+	"easyRide/models"
+	"github.com/stretchr/testify/mock"
+	"time"
+)
+
+func (s *UnitTestSuite) Test_ScheduledTripWorkflow_Dispatch() {
+	start := s.env.Now()
+	trip := models.ScheduledTrip{PassengerID: 1, PickupLoc: 3, DropLoc: 9, PickupAt: start.Add(2 * time.Hour)}
+	var dispatchedAt time.Time
+	// the reminder an hour ahead, the day ahead is already past
+	s.env.OnActivity(activities.NotifyPassenger, mock.Anything, 1, mock.Anything).Return(nil).Once()
+	s.env.OnActivity(activities.DispatchScheduledTrip, mock.Anything, mock.Anything, mock.Anything).Return(true, nil).
+		Run(func(args mock.Arguments) {
+			dispatchedAt = s.env.Now()
+		}).Once()
+	s.env.RegisterWorkflow(MainWorkFlow)
+	s.env.OnWorkflow(MainWorkFlow, mock.Anything, 1).Return(nil).Once()
+
+	s.env.ExecuteWorkflow(ScheduledTripWorkflow, trip)
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.NoError(s.env.GetWorkflowError())
+	s.Equal(trip.PickupAt.Add(-ScheduleLeadTime), dispatchedAt)
+}
+
+func (s *UnitTestSuite) Test_ScheduledTripWorkflow_DeferredDispatch() {
+	start := s.env.Now()
+	trip := models.ScheduledTrip{PassengerID: 1, PickupLoc: 3, DropLoc: 9, PickupAt: start.Add(ScheduleLeadTime)}
+	// the passenger's other trip is over at the third try
+	s.env.OnActivity(activities.DispatchScheduledTrip, mock.Anything, "default-test-workflow-id-trip", mock.Anything).
+		Return(false, nil).Twice()
+	var dispatchedAt time.Time
+	s.env.OnActivity(activities.DispatchScheduledTrip, mock.Anything, "default-test-workflow-id-trip", mock.Anything).
+		Return(true, nil).Run(func(args mock.Arguments) {
+		dispatchedAt = s.env.Now()
+	}).Once()
+	s.env.OnActivity(activities.NotifyPassenger, mock.Anything, 1, "Your scheduled trip starts once your current trip is over.").
+		Return(nil).Once()
+	s.env.RegisterWorkflow(MainWorkFlow)
+	s.env.OnWorkflow(MainWorkFlow, mock.Anything, 1).Return(nil).Once()
+
+	s.env.ExecuteWorkflow(ScheduledTripWorkflow, trip)
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.NoError(s.env.GetWorkflowError())
+	s.Equal(start.Add(2*ScheduleRetryInterval), dispatchedAt)
+}
+
+func (s *UnitTestSuite) Test_ScheduledTripWorkflow_DispatchGivenUp() {
+	start := s.env.Now()
+	trip := models.ScheduledTrip{PassengerID: 1, PickupLoc: 3, DropLoc: 9, PickupAt: start.Add(ScheduleLeadTime)}
+	s.env.OnActivity(activities.DispatchScheduledTrip, mock.Anything, mock.Anything, mock.Anything).Return(false, nil)
+	s.env.OnActivity(activities.NotifyPassenger, mock.Anything, 1, "Your scheduled trip starts once your current trip is over.").
+		Return(nil).Once()
+	s.env.OnActivity(activities.NotifyPassenger, mock.Anything, 1, "Your scheduled trip is cancelled, you were still on another trip.").
+		Return(nil).Once()
+
+	s.env.ExecuteWorkflow(ScheduledTripWorkflow, trip)
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.NoError(s.env.GetWorkflowError())
+	s.Equal(trip.PickupAt.Add(ScheduleMaxDelay), s.env.Now())
+	res, err := s.env.QueryWorkflow("scheduled_trip")
+	s.NoError(err)
+	var status models.ScheduledTrip
+	s.NoError(res.Get(&status))
+	s.Equal(models.ScheduleCancelled, status.Status)
+}
+
+func (s *UnitTestSuite) Test_ScheduledTripWorkflow_RescheduleAndCancel() {
+	start := s.env.Now()
+	trip := models.ScheduledTrip{PassengerID: 1, PickupLoc: 3, DropLoc: 9, PickupAt: start.Add(48 * time.Hour)}
+	// the reminder a day ahead, the reschedule and the cancellation
+	s.env.OnActivity(activities.NotifyPassenger, mock.Anything, 1, mock.Anything).Return(nil).Times(3)
+
+	s.env.RegisterDelayedCallback(func() {
+		// too soon
+		s.env.SignalWorkflow("signal_reschedule_trip", s.env.Now().Add(time.Minute))
+		s.env.SignalWorkflow("signal_reschedule_trip", start.Add(50*time.Hour))
+	}, 30*time.Hour)
+	s.env.RegisterDelayedCallback(func() {
+		s.env.SignalWorkflow("signal_cancel_scheduled_trip", nil)
+	}, 40*time.Hour)
+
+	s.env.ExecuteWorkflow(ScheduledTripWorkflow, trip)
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.NoError(s.env.GetWorkflowError())
+	res, err := s.env.QueryWorkflow("scheduled_trip")
+	s.NoError(err)
+	var status models.ScheduledTrip
+	s.NoError(res.Get(&status))
+	s.Equal(models.ScheduleCancelled, status.Status)
+	s.True(start.Add(50 * time.Hour).Equal(status.PickupAt))
+}
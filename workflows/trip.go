@@ -0,0 +1,53 @@
+package workflows
+
+import (
+	"easyRide/activities"
+	"easyRide/models"
+	"easyRide/signals"
+	"go.temporal.io/sdk/workflow"
+	"time"
+)
+
+var (
+	// MaxTripDuration bounds a single attempt of the trip progress.
+	MaxTripDuration = 2 * time.Hour
+	// TripHeartbeatTimeout is how long the trip progress can go silent before it is retried.
+	TripHeartbeatTimeout = 30 * time.Second
+)
+
+// inTrip runs the trip progress until the driver reaches the destination or reports the arrival.
+func inTrip(ctx workflow.Context, passengerID int, match models.MatchResult) error {
+	ao := workflow.ActivityOptions{
+		StartToCloseTimeout: MaxTripDuration,
+		HeartbeatTimeout:    TripHeartbeatTimeout,
+	}
+	tripCtx, cancelTrip := workflow.WithCancel(workflow.WithActivityOptions(ctx, ao))
+	trip := workflow.ExecuteActivity(tripCtx, activities.InTrip, passengerID, match)
+
+	var err error
+	selector := workflow.NewSelector(ctx)
+	selector.AddFuture(trip, func(f workflow.Future) {
+		err = f.Get(ctx, nil)
+	})
+	selector.AddReceive(workflow.GetSignalChannel(ctx, signals.SIGNAL_DRIVER_ARRIVED), func(c workflow.ReceiveChannel, more bool) {
+		c.Receive(ctx, nil)
+		workflow.GetLogger(ctx).Info("Driver reported the arrival.", "PassengerID", passengerID)
+		cancelTrip()
+	})
+	selector.Select(ctx)
+	return err
+}
+
+// watchRoute keeps the status of a pooled ride up to date with the riders joining the route.
+func watchRoute(ctx workflow.Context, passengerID int, status *models.TripStatus) {
+	routeChannel := workflow.GetSignalChannel(ctx, signals.SIGNAL_ROUTE_CHANGED)
+	workflow.Go(ctx, func(ctx workflow.Context) {
+		for {
+			var stops []models.Stop
+			routeChannel.Receive(ctx, &stops)
+			workflow.GetLogger(ctx).Info("Another rider joined the route.", "PassengerID", passengerID,
+				"StopsLeft", len(stops))
+			status.Route = stops
+		}
+	})
+}
@@ -0,0 +1,48 @@
+package workflows
+
+import "go.temporal.io/sdk/workflow"
+
+// Workflows run for as long as a trip or a shift, so a deploy finds them halfway and replays their history on the new
+// code. A change to the activities, timers or child workflows a released workflow issues goes behind a
+// workflow.GetVersion gate, keyed by one of the change IDs below:
+//
+//   - the workflows that started before the change replay with workflow.DefaultVersion and keep the old path;
+//   - the latest version of the change is raised in supportedVersions when its code ships;
+//   - the old path is removed once no workflow of its version runs anymore, the minimum version of the gate is raised
+//     then, and the histories recorded on the old path are removed from testdata/histories.
+//
+// Only MainWorkFlow and MatchWorkFlow are released, the other workflows have no run to replay and change without a
+// gate until they ship. A change that keeps the commands, such as new activity arguments or options, a query or a
+// signal payload that still reads the old one, replays as it is and needs no gate: MatchWorkFlow has none so far.
+//
+// Each path taken by a running version has a history recorded under testdata/histories, which the replay tests run
+// against the current code.
+const (
+	// ChangeMatchTimeout widens the match radius of a waiting passenger and gives up the request after the match
+	// timeout, the trips started before wait for the match signal alone.
+	ChangeMatchTimeout = "match-timeout"
+	// ChangePickupPhase waits for the driver to reach the pickup location and for the passenger to get in, the trips
+	// started before go on the ride once matched.
+	ChangePickupPhase = "pickup-phase"
+	// ChangeRatingWindow collects the ratings through signals within a rating window, the trips started before run
+	// the Rate activity.
+	ChangeRatingWindow = "rating-window"
+	// ChangeTripCompensation records the payment and undoes the steps of a trip that failed halfway.
+	ChangeTripCompensation = "trip-compensation"
+)
+
+// supportedVersions are the oldest and the latest version of each change the current code runs, a change not
+// shipped yet is at workflow.DefaultVersion.
+var supportedVersions = map[string]struct{ min, latest workflow.Version }{
+	ChangeMatchTimeout:     {workflow.DefaultVersion, 1},
+	ChangePickupPhase:      {workflow.DefaultVersion, 1},
+	ChangeRatingWindow:     {workflow.DefaultVersion, 1},
+	ChangeTripCompensation: {workflow.DefaultVersion, 1},
+}
+
+// changeVersion is the version of the change the workflow runs: the latest for a new workflow, the recorded one when
+// replaying.
+func changeVersion(ctx workflow.Context, changeID string) workflow.Version {
+	supported := supportedVersions[changeID]
+	return workflow.GetVersion(ctx, changeID, supported.min, supported.latest)
+}